@@ -20,6 +20,48 @@ const _ = grpc.SupportPackageIsVersion7
 type AgentServiceClient interface {
 	ExecuteCommand(ctx context.Context, in *ExecuteCommandRequest, opts ...grpc.CallOption) (*ExecuteCommandResponse, error)
 	ExecuteCommandStream(ctx context.Context, opts ...grpc.CallOption) (AgentService_ExecuteCommandStreamClient, error)
+	// Returns information about the agent, e.g. to find out which features it supports.
+	GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error)
+	// Writes a file atomically. The first request carries the metadata, the following ones the content.
+	WriteFile(ctx context.Context, opts ...grpc.CallOption) (AgentService_WriteFileClient, error)
+	// Reads a file. The first response carries the metadata, the following ones the content.
+	ReadFile(ctx context.Context, in *ReadFileRequest, opts ...grpc.CallOption) (AgentService_ReadFileClient, error)
+	// Extracts a tar archive into a directory. The first request carries the options, the following ones the archive.
+	PushDir(ctx context.Context, opts ...grpc.CallOption) (AgentService_PushDirClient, error)
+	// Archives a directory as tar and streams the archive.
+	PullDir(ctx context.Context, in *PullDirRequest, opts ...grpc.CallOption) (AgentService_PullDirClient, error)
+	// Returns information about a file.
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error)
+	// Lists a directory in pages ordered by name.
+	ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirResponse, error)
+	// Creates a directory, optionally including its parents.
+	Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*MkdirResponse, error)
+	// Removes a file or an empty directory, optionally including its contents.
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
+	// Renames a file, replacing the destination if it exists.
+	Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameResponse, error)
+	// Changes the permission bits of a file.
+	Chmod(ctx context.Context, in *ChmodRequest, opts ...grpc.CallOption) (*ChmodResponse, error)
+	// Changes the owner of a file.
+	Chown(ctx context.Context, in *ChownRequest, opts ...grpc.CallOption) (*ChownResponse, error)
+	// Lists all entries below a directory recursively, e.g. to find out which ones need to be synced.
+	GetManifest(ctx context.Context, in *GetManifestRequest, opts ...grpc.CallOption) (AgentService_GetManifestClient, error)
+	// Starts a command detached from the call, so that it keeps running once the call finished.
+	// With authentication, only the identity that started a process may list, wait for, kill or attach to it.
+	StartProcess(ctx context.Context, in *StartProcessRequest, opts ...grpc.CallOption) (*StartProcessResponse, error)
+	// Lists the processes started by StartProcess, which are kept for a while once they exited.
+	ListProcesses(ctx context.Context, in *ListProcessesRequest, opts ...grpc.CallOption) (*ListProcessesResponse, error)
+	// Waits for a process started by StartProcess to exit.
+	WaitProcess(ctx context.Context, in *WaitProcessRequest, opts ...grpc.CallOption) (*WaitProcessResponse, error)
+	// Sends a signal to the process group of a process started by StartProcess.
+	KillProcess(ctx context.Context, in *KillProcessRequest, opts ...grpc.CallOption) (*KillProcessResponse, error)
+	// Replays the buffered output of a process started by StartProcess and, if requested, follows its
+	// live output and forwards stdin until it exited.
+	AttachProcess(ctx context.Context, opts ...grpc.CallOption) (AgentService_AttachProcessClient, error)
+	// Executes many commands over a single stream, each in a session identified by an ID chosen by
+	// the client. Sessions are flow controlled independently. Ending the stream kills all commands
+	// still running.
+	ExecuteSessions(ctx context.Context, opts ...grpc.CallOption) (AgentService_ExecuteSessionsClient, error)
 }
 
 type agentServiceClient struct {
@@ -70,12 +112,388 @@ func (x *agentServiceExecuteCommandStreamClient) Recv() (*ExecuteCommandStreamRe
 	return m, nil
 }
 
+func (c *agentServiceClient) GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error) {
+	out := new(GetInfoResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/GetInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) WriteFile(ctx context.Context, opts ...grpc.CallOption) (AgentService_WriteFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[1], "/api.agent.v1.AgentService/WriteFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceWriteFileClient{stream}
+	return x, nil
+}
+
+type AgentService_WriteFileClient interface {
+	Send(*WriteFileRequest) error
+	CloseAndRecv() (*WriteFileResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceWriteFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceWriteFileClient) Send(m *WriteFileRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceWriteFileClient) CloseAndRecv() (*WriteFileResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteFileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) ReadFile(ctx context.Context, in *ReadFileRequest, opts ...grpc.CallOption) (AgentService_ReadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[2], "/api.agent.v1.AgentService/ReadFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceReadFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AgentService_ReadFileClient interface {
+	Recv() (*ReadFileResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceReadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceReadFileClient) Recv() (*ReadFileResponse, error) {
+	m := new(ReadFileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) PushDir(ctx context.Context, opts ...grpc.CallOption) (AgentService_PushDirClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[3], "/api.agent.v1.AgentService/PushDir", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServicePushDirClient{stream}
+	return x, nil
+}
+
+type AgentService_PushDirClient interface {
+	Send(*PushDirRequest) error
+	CloseAndRecv() (*PushDirResponse, error)
+	grpc.ClientStream
+}
+
+type agentServicePushDirClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServicePushDirClient) Send(m *PushDirRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServicePushDirClient) CloseAndRecv() (*PushDirResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PushDirResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) PullDir(ctx context.Context, in *PullDirRequest, opts ...grpc.CallOption) (AgentService_PullDirClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[4], "/api.agent.v1.AgentService/PullDir", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServicePullDirClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AgentService_PullDirClient interface {
+	Recv() (*PullDirResponse, error)
+	grpc.ClientStream
+}
+
+type agentServicePullDirClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServicePullDirClient) Recv() (*PullDirResponse, error) {
+	m := new(PullDirResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error) {
+	out := new(StatResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/Stat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirResponse, error) {
+	out := new(ReadDirResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/ReadDir", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*MkdirResponse, error) {
+	out := new(MkdirResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/Mkdir", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameResponse, error) {
+	out := new(RenameResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/Rename", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Chmod(ctx context.Context, in *ChmodRequest, opts ...grpc.CallOption) (*ChmodResponse, error) {
+	out := new(ChmodResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/Chmod", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) Chown(ctx context.Context, in *ChownRequest, opts ...grpc.CallOption) (*ChownResponse, error) {
+	out := new(ChownResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/Chown", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) GetManifest(ctx context.Context, in *GetManifestRequest, opts ...grpc.CallOption) (AgentService_GetManifestClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[5], "/api.agent.v1.AgentService/GetManifest", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceGetManifestClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AgentService_GetManifestClient interface {
+	Recv() (*GetManifestResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceGetManifestClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceGetManifestClient) Recv() (*GetManifestResponse, error) {
+	m := new(GetManifestResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) StartProcess(ctx context.Context, in *StartProcessRequest, opts ...grpc.CallOption) (*StartProcessResponse, error) {
+	out := new(StartProcessResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/StartProcess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) ListProcesses(ctx context.Context, in *ListProcessesRequest, opts ...grpc.CallOption) (*ListProcessesResponse, error) {
+	out := new(ListProcessesResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/ListProcesses", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) WaitProcess(ctx context.Context, in *WaitProcessRequest, opts ...grpc.CallOption) (*WaitProcessResponse, error) {
+	out := new(WaitProcessResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/WaitProcess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) KillProcess(ctx context.Context, in *KillProcessRequest, opts ...grpc.CallOption) (*KillProcessResponse, error) {
+	out := new(KillProcessResponse)
+	err := c.cc.Invoke(ctx, "/api.agent.v1.AgentService/KillProcess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentServiceClient) AttachProcess(ctx context.Context, opts ...grpc.CallOption) (AgentService_AttachProcessClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[6], "/api.agent.v1.AgentService/AttachProcess", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceAttachProcessClient{stream}
+	return x, nil
+}
+
+type AgentService_AttachProcessClient interface {
+	Send(*AttachProcessRequest) error
+	Recv() (*AttachProcessResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceAttachProcessClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceAttachProcessClient) Send(m *AttachProcessRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceAttachProcessClient) Recv() (*AttachProcessResponse, error) {
+	m := new(AttachProcessResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentServiceClient) ExecuteSessions(ctx context.Context, opts ...grpc.CallOption) (AgentService_ExecuteSessionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AgentService_ServiceDesc.Streams[7], "/api.agent.v1.AgentService/ExecuteSessions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentServiceExecuteSessionsClient{stream}
+	return x, nil
+}
+
+type AgentService_ExecuteSessionsClient interface {
+	Send(*SessionRequest) error
+	Recv() (*SessionResponse, error)
+	grpc.ClientStream
+}
+
+type agentServiceExecuteSessionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentServiceExecuteSessionsClient) Send(m *SessionRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *agentServiceExecuteSessionsClient) Recv() (*SessionResponse, error) {
+	m := new(SessionResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // AgentServiceServer is the server API for AgentService service.
 // All implementations should embed UnimplementedAgentServiceServer
 // for forward compatibility
 type AgentServiceServer interface {
 	ExecuteCommand(context.Context, *ExecuteCommandRequest) (*ExecuteCommandResponse, error)
 	ExecuteCommandStream(AgentService_ExecuteCommandStreamServer) error
+	// Returns information about the agent, e.g. to find out which features it supports.
+	GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error)
+	// Writes a file atomically. The first request carries the metadata, the following ones the content.
+	WriteFile(AgentService_WriteFileServer) error
+	// Reads a file. The first response carries the metadata, the following ones the content.
+	ReadFile(*ReadFileRequest, AgentService_ReadFileServer) error
+	// Extracts a tar archive into a directory. The first request carries the options, the following ones the archive.
+	PushDir(AgentService_PushDirServer) error
+	// Archives a directory as tar and streams the archive.
+	PullDir(*PullDirRequest, AgentService_PullDirServer) error
+	// Returns information about a file.
+	Stat(context.Context, *StatRequest) (*StatResponse, error)
+	// Lists a directory in pages ordered by name.
+	ReadDir(context.Context, *ReadDirRequest) (*ReadDirResponse, error)
+	// Creates a directory, optionally including its parents.
+	Mkdir(context.Context, *MkdirRequest) (*MkdirResponse, error)
+	// Removes a file or an empty directory, optionally including its contents.
+	Remove(context.Context, *RemoveRequest) (*RemoveResponse, error)
+	// Renames a file, replacing the destination if it exists.
+	Rename(context.Context, *RenameRequest) (*RenameResponse, error)
+	// Changes the permission bits of a file.
+	Chmod(context.Context, *ChmodRequest) (*ChmodResponse, error)
+	// Changes the owner of a file.
+	Chown(context.Context, *ChownRequest) (*ChownResponse, error)
+	// Lists all entries below a directory recursively, e.g. to find out which ones need to be synced.
+	GetManifest(*GetManifestRequest, AgentService_GetManifestServer) error
+	// Starts a command detached from the call, so that it keeps running once the call finished.
+	// With authentication, only the identity that started a process may list, wait for, kill or attach to it.
+	StartProcess(context.Context, *StartProcessRequest) (*StartProcessResponse, error)
+	// Lists the processes started by StartProcess, which are kept for a while once they exited.
+	ListProcesses(context.Context, *ListProcessesRequest) (*ListProcessesResponse, error)
+	// Waits for a process started by StartProcess to exit.
+	WaitProcess(context.Context, *WaitProcessRequest) (*WaitProcessResponse, error)
+	// Sends a signal to the process group of a process started by StartProcess.
+	KillProcess(context.Context, *KillProcessRequest) (*KillProcessResponse, error)
+	// Replays the buffered output of a process started by StartProcess and, if requested, follows its
+	// live output and forwards stdin until it exited.
+	AttachProcess(AgentService_AttachProcessServer) error
+	// Executes many commands over a single stream, each in a session identified by an ID chosen by
+	// the client. Sessions are flow controlled independently. Ending the stream kills all commands
+	// still running.
+	ExecuteSessions(AgentService_ExecuteSessionsServer) error
 }
 
 // UnimplementedAgentServiceServer should be embedded to have forward compatible implementations.
@@ -88,6 +506,63 @@ func (UnimplementedAgentServiceServer) ExecuteCommand(context.Context, *ExecuteC
 func (UnimplementedAgentServiceServer) ExecuteCommandStream(AgentService_ExecuteCommandStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method ExecuteCommandStream not implemented")
 }
+func (UnimplementedAgentServiceServer) GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
+}
+func (UnimplementedAgentServiceServer) WriteFile(AgentService_WriteFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method WriteFile not implemented")
+}
+func (UnimplementedAgentServiceServer) ReadFile(*ReadFileRequest, AgentService_ReadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReadFile not implemented")
+}
+func (UnimplementedAgentServiceServer) PushDir(AgentService_PushDirServer) error {
+	return status.Errorf(codes.Unimplemented, "method PushDir not implemented")
+}
+func (UnimplementedAgentServiceServer) PullDir(*PullDirRequest, AgentService_PullDirServer) error {
+	return status.Errorf(codes.Unimplemented, "method PullDir not implemented")
+}
+func (UnimplementedAgentServiceServer) Stat(context.Context, *StatRequest) (*StatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedAgentServiceServer) ReadDir(context.Context, *ReadDirRequest) (*ReadDirResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadDir not implemented")
+}
+func (UnimplementedAgentServiceServer) Mkdir(context.Context, *MkdirRequest) (*MkdirResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Mkdir not implemented")
+}
+func (UnimplementedAgentServiceServer) Remove(context.Context, *RemoveRequest) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedAgentServiceServer) Rename(context.Context, *RenameRequest) (*RenameResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rename not implemented")
+}
+func (UnimplementedAgentServiceServer) Chmod(context.Context, *ChmodRequest) (*ChmodResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Chmod not implemented")
+}
+func (UnimplementedAgentServiceServer) Chown(context.Context, *ChownRequest) (*ChownResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Chown not implemented")
+}
+func (UnimplementedAgentServiceServer) GetManifest(*GetManifestRequest, AgentService_GetManifestServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetManifest not implemented")
+}
+func (UnimplementedAgentServiceServer) StartProcess(context.Context, *StartProcessRequest) (*StartProcessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartProcess not implemented")
+}
+func (UnimplementedAgentServiceServer) ListProcesses(context.Context, *ListProcessesRequest) (*ListProcessesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProcesses not implemented")
+}
+func (UnimplementedAgentServiceServer) WaitProcess(context.Context, *WaitProcessRequest) (*WaitProcessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WaitProcess not implemented")
+}
+func (UnimplementedAgentServiceServer) KillProcess(context.Context, *KillProcessRequest) (*KillProcessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KillProcess not implemented")
+}
+func (UnimplementedAgentServiceServer) AttachProcess(AgentService_AttachProcessServer) error {
+	return status.Errorf(codes.Unimplemented, "method AttachProcess not implemented")
+}
+func (UnimplementedAgentServiceServer) ExecuteSessions(AgentService_ExecuteSessionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExecuteSessions not implemented")
+}
 
 // UnsafeAgentServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to AgentServiceServer will
@@ -144,17 +619,448 @@ func (x *agentServiceExecuteCommandStreamServer) Recv() (*ExecuteCommandStreamRe
 	return m, nil
 }
 
-// AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var AgentService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "api.agent.v1.AgentService",
-	HandlerType: (*AgentServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "ExecuteCommand",
-			Handler:    _AgentService_ExecuteCommand_Handler,
-		},
+func _AgentService_GetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).GetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/GetInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).GetInfo(ctx, req.(*GetInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_WriteFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).WriteFile(&agentServiceWriteFileServer{stream})
+}
+
+type AgentService_WriteFileServer interface {
+	SendAndClose(*WriteFileResponse) error
+	Recv() (*WriteFileRequest, error)
+	grpc.ServerStream
+}
+
+type agentServiceWriteFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceWriteFileServer) SendAndClose(m *WriteFileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceWriteFileServer) Recv() (*WriteFileRequest, error) {
+	m := new(WriteFileRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_ReadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServiceServer).ReadFile(m, &agentServiceReadFileServer{stream})
+}
+
+type AgentService_ReadFileServer interface {
+	Send(*ReadFileResponse) error
+	grpc.ServerStream
+}
+
+type agentServiceReadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceReadFileServer) Send(m *ReadFileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AgentService_PushDir_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).PushDir(&agentServicePushDirServer{stream})
+}
+
+type AgentService_PushDirServer interface {
+	SendAndClose(*PushDirResponse) error
+	Recv() (*PushDirRequest, error)
+	grpc.ServerStream
+}
+
+type agentServicePushDirServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServicePushDirServer) SendAndClose(m *PushDirResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServicePushDirServer) Recv() (*PushDirRequest, error) {
+	m := new(PushDirRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_PullDir_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PullDirRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServiceServer).PullDir(m, &agentServicePullDirServer{stream})
+}
+
+type AgentService_PullDirServer interface {
+	Send(*PullDirResponse) error
+	grpc.ServerStream
+}
+
+type agentServicePullDirServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServicePullDirServer) Send(m *PullDirResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AgentService_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/Stat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_ReadDir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadDirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).ReadDir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/ReadDir",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).ReadDir(ctx, req.(*ReadDirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Mkdir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MkdirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Mkdir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/Mkdir",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Mkdir(ctx, req.(*MkdirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Rename_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Rename(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/Rename",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Rename(ctx, req.(*RenameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Chmod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChmodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Chmod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/Chmod",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Chmod(ctx, req.(*ChmodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_Chown_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChownRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Chown(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/Chown",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Chown(ctx, req.(*ChownRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_GetManifest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetManifestRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentServiceServer).GetManifest(m, &agentServiceGetManifestServer{stream})
+}
+
+type AgentService_GetManifestServer interface {
+	Send(*GetManifestResponse) error
+	grpc.ServerStream
+}
+
+type agentServiceGetManifestServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceGetManifestServer) Send(m *GetManifestResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AgentService_StartProcess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).StartProcess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/StartProcess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).StartProcess(ctx, req.(*StartProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_ListProcesses_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProcessesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).ListProcesses(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/ListProcesses",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).ListProcesses(ctx, req.(*ListProcessesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_WaitProcess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WaitProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).WaitProcess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/WaitProcess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).WaitProcess(ctx, req.(*WaitProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_KillProcess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KillProcessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServiceServer).KillProcess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.agent.v1.AgentService/KillProcess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).KillProcess(ctx, req.(*KillProcessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AgentService_AttachProcess_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).AttachProcess(&agentServiceAttachProcessServer{stream})
+}
+
+type AgentService_AttachProcessServer interface {
+	Send(*AttachProcessResponse) error
+	Recv() (*AttachProcessRequest, error)
+	grpc.ServerStream
+}
+
+type agentServiceAttachProcessServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceAttachProcessServer) Send(m *AttachProcessResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceAttachProcessServer) Recv() (*AttachProcessRequest, error) {
+	m := new(AttachProcessRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AgentService_ExecuteSessions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AgentServiceServer).ExecuteSessions(&agentServiceExecuteSessionsServer{stream})
+}
+
+type AgentService_ExecuteSessionsServer interface {
+	Send(*SessionResponse) error
+	Recv() (*SessionRequest, error)
+	grpc.ServerStream
+}
+
+type agentServiceExecuteSessionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentServiceExecuteSessionsServer) Send(m *SessionResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *agentServiceExecuteSessionsServer) Recv() (*SessionRequest, error) {
+	m := new(SessionRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AgentService_ServiceDesc is the grpc.ServiceDesc for AgentService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AgentService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "api.agent.v1.AgentService",
+	HandlerType: (*AgentServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ExecuteCommand",
+			Handler:    _AgentService_ExecuteCommand_Handler,
+		},
+		{
+			MethodName: "GetInfo",
+			Handler:    _AgentService_GetInfo_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _AgentService_Stat_Handler,
+		},
+		{
+			MethodName: "ReadDir",
+			Handler:    _AgentService_ReadDir_Handler,
+		},
+		{
+			MethodName: "Mkdir",
+			Handler:    _AgentService_Mkdir_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _AgentService_Remove_Handler,
+		},
+		{
+			MethodName: "Rename",
+			Handler:    _AgentService_Rename_Handler,
+		},
+		{
+			MethodName: "Chmod",
+			Handler:    _AgentService_Chmod_Handler,
+		},
+		{
+			MethodName: "Chown",
+			Handler:    _AgentService_Chown_Handler,
+		},
+		{
+			MethodName: "StartProcess",
+			Handler:    _AgentService_StartProcess_Handler,
+		},
+		{
+			MethodName: "ListProcesses",
+			Handler:    _AgentService_ListProcesses_Handler,
+		},
+		{
+			MethodName: "WaitProcess",
+			Handler:    _AgentService_WaitProcess_Handler,
+		},
+		{
+			MethodName: "KillProcess",
+			Handler:    _AgentService_KillProcess_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -163,6 +1069,43 @@ var AgentService_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "WriteFile",
+			Handler:       _AgentService_WriteFile_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ReadFile",
+			Handler:       _AgentService_ReadFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PushDir",
+			Handler:       _AgentService_PushDir_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PullDir",
+			Handler:       _AgentService_PullDir_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetManifest",
+			Handler:       _AgentService_GetManifest_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "AttachProcess",
+			Handler:       _AgentService_AttachProcess_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ExecuteSessions",
+			Handler:       _AgentService_ExecuteSessions_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "api/agent/v1/agent.proto",
 }
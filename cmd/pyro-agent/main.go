@@ -3,9 +3,12 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/sirkrypt0/pyro/internal/agent"
+	"github.com/sirkrypt0/pyro/pkg/auth"
+	"github.com/sirkrypt0/pyro/pkg/certs"
 	"github.com/sirkrypt0/pyro/pkg/logging"
-	"net"
+	"github.com/sirkrypt0/pyro/pkg/transport"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,16 +18,56 @@ import (
 func main() {
 	log := logging.GetLogger("pyro-agent")
 
-	bindAddress := flag.String("bind", "127.0.0.1:3000", "Address to bind to")
+	bindAddress := flag.String("bind", "127.0.0.1:3000",
+		"Address to bind to, either host:port for TCP, vsock://CID:PORT for AF_VSOCK or unix:///path for a unix socket")
+	maxOutputSize := flag.Int("max-output-size", agent.DefaultMaxOutputSize,
+		fmt.Sprintf("Maximum number of bytes of stdout and stderr each returned by non-streaming command execution, "+
+			"at most %d to stay below gRPC's maximum message size", agent.MaxOutputSizeLimit))
+	processBufferSize := flag.Int("process-buffer-size", agent.DefaultProcessOutputBufferSize,
+		"Number of bytes of the combined stdout and stderr buffered for each process started detached")
+	var tlsFiles certs.Files
+	flag.StringVar(&tlsFiles.Cert, "tls-cert", "", "Certificate file of the agent, enables mutual TLS")
+	flag.StringVar(&tlsFiles.Key, "tls-key", "", "Private key file of the agent's certificate")
+	flag.StringVar(&tlsFiles.CA, "tls-ca", "", "CA file used to verify the certificates of clients")
+	tokensFile := flag.String("auth-tokens", "",
+		"File with lines of the form IDENTITY TOKEN listing static bearer tokens, enables authentication")
+	hmacSecretFile := flag.String("auth-hmac-secret", "",
+		"File containing the secret short-lived bearer tokens are signed with, enables authentication")
+	policyFile := flag.String("auth-policy", "",
+		"JSON policy file restricting the RPCs and commands of each identity, requires authentication")
+	enableReflection := flag.Bool("reflection", false, "Enable the gRPC server reflection service, e.g. for grpcurl")
 	flag.Parse()
 
-	srv, err := agent.NewGRPCServer()
+	opts := []agent.Option{
+		agent.WithMaxOutputSize(*maxOutputSize), agent.WithProcessOutputBufferSize(*processBufferSize),
+	}
+	authOpt, err := authentication(*tokensFile, *hmacSecretFile, *policyFile)
+	if err != nil {
+		log.WithError(err).Fatal("Error loading authentication configuration!")
+	}
+	if authOpt != nil {
+		opts = append(opts, authOpt)
+	}
+	if *enableReflection {
+		opts = append(opts, agent.WithReflection())
+	}
+	if tlsFiles.Enabled() {
+		tlsConfig, err := certs.ServerConfig(tlsFiles)
+		if err != nil {
+			log.WithError(err).Fatal("Error loading TLS configuration!")
+		}
+		opts = append(opts, agent.WithTLSConfig(tlsConfig))
+	} else {
+		log.Warn("Serving without TLS, anyone able to connect may execute arbitrary commands!")
+	}
+
+	srv, err := agent.NewGRPCServer(opts...)
 	if err != nil {
 		log.WithError(err).Fatal("Error creating new GRPC server!")
 	}
 
 	go func() {
-		l, err := net.Listen("tcp", *bindAddress)
+		l, err := transport.Listen(*bindAddress)
 		if err != nil {
 			log.WithError(err).Fatal("Error during listening")
 		}
@@ -44,3 +87,36 @@ func main() {
 	log.Info("Received SIGINT, shutting down ...")
 	srv.GracefulStop()
 }
+
+// authentication returns the option enabling authentication and authorization, if configured.
+func authentication(tokensFile, hmacSecretFile, policyFile string) (agent.Option, error) {
+	var authenticators auth.Authenticators
+	if tokensFile != "" {
+		tokens, err := auth.LoadStaticTokens(tokensFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if hmacSecretFile != "" {
+		secret, err := auth.LoadHMACSecret(hmacSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, auth.NewHMACTokens(secret))
+	}
+	if len(authenticators) == 0 {
+		if policyFile != "" {
+			return nil, errors.New("a policy requires authentication using static or HMAC signed tokens")
+		}
+		return nil, nil
+	}
+	var policy *agent.Policy
+	if policyFile != "" {
+		var err error
+		if policy, err = agent.LoadPolicy(policyFile); err != nil {
+			return nil, err
+		}
+	}
+	return agent.WithAuthentication(authenticators, policy), nil
+}
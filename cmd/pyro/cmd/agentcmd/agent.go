@@ -1,18 +1,29 @@
 package agentcmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/certs"
 	"github.com/sirkrypt0/pyro/pkg/client"
+	"github.com/sirkrypt0/pyro/pkg/transport"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"io"
+	"os"
+	"strings"
 )
 
 var (
-	agentAddr string
-	apiClient *client.Client
-	closeConn func() error
+	agentAddr     string
+	tlsFiles      certs.Files
+	tlsServerName string
+	token         string
+	tokenFile     string
+	apiClient     *client.Client
+	closeConn     func() error
 )
 
 func NewAgentCmd(inr io.Reader, outw, errw io.WriteCloser) *cobra.Command {
@@ -22,27 +33,109 @@ func NewAgentCmd(inr io.Reader, outw, errw io.WriteCloser) *cobra.Command {
 		PersistentPreRunE:  newAgentServiceClient,
 		PersistentPostRunE: closeAgentServiceClient,
 	}
-	cmd.PersistentFlags().StringVarP(&agentAddr, "addr", "a", "127.0.0.1:3000", "Address of the pyro agent")
+	cmd.PersistentFlags().StringVarP(&agentAddr, "addr", "a", "127.0.0.1:3000",
+		"Address of the pyro agent, either host:port for TCP, vsock://CID:PORT for AF_VSOCK, unix:///path "+
+			"for a unix socket or fc-vsock:///path:PORT for a Firecracker guest's vsock exposed on the host")
+
+	cmd.PersistentFlags().StringVar(&tlsFiles.Cert, "tls-cert", os.Getenv("PYRO_TLS_CERT"),
+		"Client certificate file, enables mutual TLS ($PYRO_TLS_CERT)")
+	cmd.PersistentFlags().StringVar(&tlsFiles.Key, "tls-key", os.Getenv("PYRO_TLS_KEY"),
+		"Private key file of the client certificate ($PYRO_TLS_KEY)")
+	cmd.PersistentFlags().StringVar(&tlsFiles.CA, "tls-ca", os.Getenv("PYRO_TLS_CA"),
+		"CA file used to verify the agent's certificate ($PYRO_TLS_CA)")
+	cmd.PersistentFlags().StringVar(&tlsServerName, "tls-server-name", os.Getenv("PYRO_TLS_SERVER_NAME"),
+		"Name the agent's certificate must be valid for, defaults to the host of a TCP address "+
+			"and localhost otherwise ($PYRO_TLS_SERVER_NAME)")
+	cmd.PersistentFlags().StringVar(&token, "token", os.Getenv("PYRO_TOKEN"),
+		"Bearer token to authenticate with ($PYRO_TOKEN)")
+	cmd.PersistentFlags().StringVar(&tokenFile, "token-file", os.Getenv("PYRO_TOKEN_FILE"),
+		"File containing the bearer token to authenticate with ($PYRO_TOKEN_FILE)")
 
 	cmd.AddCommand(newExecCmd(inr, outw, errw))
+	cmd.AddCommand(newHealthCmd(outw))
+	cmd.AddCommand(newInfoCmd(outw))
+	cmd.AddCommand(newCpCmd(inr, outw))
+	cmd.AddCommand(newFsCmd(outw))
+	cmd.AddCommand(newSyncCmd(outw))
+	cmd.AddCommand(newRunCmd(inr, outw, errw))
+	cmd.AddCommand(newAttachCmd(inr, outw, errw))
+	cmd.AddCommand(newLogsCmd(outw, errw))
+	cmd.AddCommand(newPsCmd(outw))
+	cmd.AddCommand(newWaitCmd(outw))
+	cmd.AddCommand(newKillCmd())
 
 	return cmd
 }
 
 func newAgentServiceClient(_ *cobra.Command, _ []string) error {
-	cc, err := grpc.Dial(agentAddr, grpc.WithInsecure(), grpc.WithBlock())
+	clientOpts, err := clientOptions()
+	if err != nil {
+		return err
+	}
+	cc, err := dialAgent(grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
 	if err != nil {
-		return fmt.Errorf("error connecting to agent: %w", err)
+		return err
 	}
 	closeConn = cc.Close
 	agent := agentv1.NewAgentServiceClient(cc)
-	apiClient, err = client.NewClient(agent)
+	apiClient, err = client.NewClient(agent, clientOpts...)
 	if err != nil {
 		return fmt.Errorf("error creating new api client: %w", err)
 	}
 	return nil
 }
 
+// dialAgent connects to the agent at the configured address using the configured transport credentials.
+func dialAgent(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	creds, err := transportCredentials()
+	if err != nil {
+		return nil, err
+	}
+	cc, err := client.Dial(context.Background(), agentAddr, append(opts, creds)...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to agent: %w", err)
+	}
+	return cc, nil
+}
+
+// transportCredentials returns the dial option securing the connection with mutual TLS, if configured.
+func transportCredentials() (grpc.DialOption, error) {
+	if !tlsFiles.Enabled() {
+		return grpc.WithInsecure(), nil
+	}
+	serverName := tlsServerName
+	if serverName == "" && !transport.IsTCP(agentAddr) {
+		// Other addresses contain no host name, so expect the one certificates for local use are issued for.
+		serverName = "localhost"
+	}
+	config, err := certs.ClientConfig(tlsFiles, serverName)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS configuration: %w", err)
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+// clientOptions returns the options authenticating the client with a bearer token, if configured.
+func clientOptions() ([]client.Option, error) {
+	if token != "" && tokenFile != "" {
+		return nil, errors.New("only one of --token and --token-file may be given")
+	}
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, nil
+	}
+	if !tlsFiles.Enabled() && transport.IsTCP(agentAddr) {
+		return nil, errors.New("a token is only sent to a TCP address using TLS, use TLS or a vsock or unix address")
+	}
+	return []client.Option{client.WithPerRPCCredentials(client.NewTokenCredentials(agentAddr, token))}, nil
+}
+
 func closeAgentServiceClient(_ *cobra.Command, _ []string) error {
 	if err := closeConn(); err != nil {
 		return fmt.Errorf("error closing connection to agent: %w", err)
@@ -0,0 +1,209 @@
+package agentcmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirkrypt0/pyro/pkg/archive"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// remotePrefix marks paths on the agent.
+const remotePrefix = "remote:"
+
+// stdioPath denotes stdin or stdout instead of a local file.
+const stdioPath = "-"
+
+type cpFlags struct {
+	preserve     bool
+	recursive    bool
+	compress     string
+	allowDevices bool
+}
+
+func newCpCmd(inr io.Reader, outw io.Writer) *cobra.Command {
+	flags := &cpFlags{}
+	cmd := &cobra.Command{
+		Use:   "cp <local> remote:<path> | cp remote:<path> <local>",
+		Short: "copy a file or directory to or from the agent",
+		Long: "Copy a file or, using -r, a directory to or from the agent. " +
+			"Remote paths are absolute and prefixed with remote:. " +
+			"If the destination ends with a slash or is an existing local directory, the source's name is appended. " +
+			"A local path of - denotes stdin or stdout, which carry the tar archive itself when using -r. " +
+			"Directories are transferred as tar archive, whose entries are rejected if they would end up outside " +
+			"the destination.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src, dst := args[0], args[1]
+			srcRemote, dstRemote := strings.HasPrefix(src, remotePrefix), strings.HasPrefix(dst, remotePrefix)
+			ctx := cmd.Context()
+			if flags.recursive {
+				compression, err := archive.ParseCompression(flags.compress)
+				if err != nil {
+					return err
+				}
+				switch {
+				case !srcRemote && dstRemote:
+					return uploadDir(ctx, inr, src, strings.TrimPrefix(dst, remotePrefix), compression, flags)
+				case srcRemote && !dstRemote:
+					return downloadDir(ctx, outw, strings.TrimPrefix(src, remotePrefix), dst, compression, flags)
+				default:
+					return errors.New("exactly one of source and destination must be a remote path")
+				}
+			}
+			switch {
+			case !srcRemote && dstRemote:
+				return upload(ctx, inr, src, strings.TrimPrefix(dst, remotePrefix), flags)
+			case srcRemote && !dstRemote:
+				return download(ctx, outw, strings.TrimPrefix(src, remotePrefix), dst, flags)
+			default:
+				return errors.New("exactly one of source and destination must be a remote path")
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&flags.preserve, "preserve", "p", false,
+		"preserve the modification time, with -r the owners as modification times are always preserved")
+	cmd.Flags().BoolVarP(&flags.recursive, "recursive", "r", false, "copy a directory recursively")
+	cmd.Flags().StringVar(&flags.compress, "compress", "none",
+		"compression of directories in transit, either none or gzip")
+	cmd.Flags().BoolVar(&flags.allowDevices, "allow-devices", false,
+		"allow copying character and block devices with -r")
+	return cmd
+}
+
+func upload(ctx context.Context, inr io.Reader, local, remote string, flags *cpFlags) error {
+	var opts []client.FileOption
+	r := inr
+	if local != stdioPath {
+		f, err := os.Open(local)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", local)
+		}
+		opts = append(opts, client.WithFileMode(info.Mode()))
+		if flags.preserve {
+			opts = append(opts, client.WithModTime(info.ModTime()))
+		}
+		r = f
+	}
+	if strings.HasSuffix(remote, "/") {
+		if local == stdioPath {
+			return errors.New("remote destination must be a file when copying from stdin")
+		}
+		remote = path.Join(remote, filepath.Base(local))
+	}
+	_, err := apiClient.WriteFile(ctx, remote, r, opts...)
+	return err
+}
+
+func download(ctx context.Context, outw io.Writer, remote, local string, flags *cpFlags) error {
+	if local == stdioPath {
+		_, err := apiClient.ReadFile(ctx, remote, outw)
+		return err
+	}
+	if info, err := os.Stat(local); strings.HasSuffix(local, string(filepath.Separator)) || (err == nil && info.IsDir()) {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	// Write to a temporary file first, so that an existing file is only replaced once the copy succeeded.
+	f, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".pyro-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	info, err := apiClient.ReadFile(ctx, remote, f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(info.Mode.Perm()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if flags.preserve && !info.ModTime.IsZero() {
+		if err := os.Chtimes(f.Name(), info.ModTime, info.ModTime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(f.Name(), local)
+}
+
+func uploadDir(
+	ctx context.Context, inr io.Reader, local, remote string, compression archive.Compression, flags *cpFlags,
+) error {
+	opts := []client.DirOption{client.WithCompression(compression)}
+	if flags.preserve {
+		opts = append(opts, client.WithPreserveOwner())
+	}
+	if flags.allowDevices {
+		opts = append(opts, client.WithAllowDevices())
+	}
+	if local == stdioPath {
+		_, err := apiClient.PushDir(ctx, remote, inr, opts...)
+		return err
+	}
+	if info, err := os.Stat(local); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is no directory", local)
+	}
+	if strings.HasSuffix(remote, "/") {
+		remote = path.Join(remote, filepath.Base(local))
+	}
+	// The archive is created while it is sent, so that it is never buffered as a whole.
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(archive.Create(pw, local, compression))
+	}()
+	_, err := apiClient.PushDir(ctx, remote, pr, opts...)
+	_ = pr.CloseWithError(err)
+	return err
+}
+
+func downloadDir(
+	ctx context.Context, outw io.Writer, remote, local string, compression archive.Compression, flags *cpFlags,
+) error {
+	if local == stdioPath {
+		return apiClient.PullDir(ctx, remote, outw, client.WithCompression(compression))
+	}
+	if info, err := os.Stat(local); strings.HasSuffix(local, string(filepath.Separator)) || (err == nil && info.IsDir()) {
+		local = filepath.Join(local, path.Base(remote))
+	}
+	pr, pw := io.Pipe()
+	pulled := make(chan error, 1)
+	go func() {
+		err := apiClient.PullDir(ctx, remote, pw, client.WithCompression(compression))
+		_ = pw.CloseWithError(err)
+		pulled <- err
+	}()
+	_, err := archive.Extract(pr, local, archive.ExtractOptions{
+		Compression:   compression,
+		AllowDevices:  flags.allowDevices,
+		PreserveOwner: flags.preserve,
+	})
+	if err == nil {
+		// Consume the padding following the end of the archive.
+		_, err = io.Copy(io.Discard, pr)
+	}
+	_ = pr.CloseWithError(err)
+	// Unless pulling failed because extracting did, it reports the cause.
+	if pullErr := <-pulled; pullErr != nil && (err == nil || !errors.Is(pullErr, err)) {
+		return pullErr
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package agentcmd
+
+import (
+	"bufio"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"os"
+	"strings"
+)
+
+var environmentModes = map[string]agentv1.EnvironmentMode{
+	"clean":   agentv1.EnvironmentMode_ENVIRONMENT_MODE_CLEAN,
+	"inherit": agentv1.EnvironmentMode_ENVIRONMENT_MODE_INHERIT,
+	"merge":   agentv1.EnvironmentMode_ENVIRONMENT_MODE_MERGE,
+}
+
+type envFlags struct {
+	mode     string
+	vars     []string
+	files    []string
+	fromHost []string
+}
+
+// environment collects the environment of the command. Variables given directly take
+// precedence over ones copied from the host, which in turn take precedence over env files.
+func (f *envFlags) environment() (map[string]string, error) {
+	env := make(map[string]string)
+	for _, path := range f.files {
+		if err := readEnvFile(path, env); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range f.fromHost {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+	for _, kv := range f.vars {
+		if err := parseEnvVar(kv, env); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// environmentMode returns the mode given by the user. Without one, the agent's default
+// merge mode applies, which does not require the agent to support environment modes.
+func (f *envFlags) environmentMode() (agentv1.EnvironmentMode, error) {
+	if f.mode == "" {
+		return agentv1.EnvironmentMode_ENVIRONMENT_MODE_UNSPECIFIED, nil
+	}
+	mode, ok := environmentModes[f.mode]
+	if !ok {
+		return 0, fmt.Errorf("invalid environment mode %q, must be one of clean, inherit or merge", f.mode)
+	}
+	return mode, nil
+}
+
+// readEnvFile reads KEY=VALUE lines from the file into env.
+// Empty lines and lines starting with # are ignored.
+func readEnvFile(path string, env map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening env file: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parseEnvVar(line, env); err != nil {
+			return fmt.Errorf("error in env file %s line %d: %w", path, lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading env file: %w", err)
+	}
+	return nil
+}
+
+// parseEnvVar parses a KEY=VALUE pair into env. A KEY without value copies the value from the host.
+func parseEnvVar(kv string, env map[string]string) error {
+	key, value := kv, ""
+	i := strings.IndexByte(kv, '=')
+	if i >= 0 {
+		key, value = kv[:i], kv[i+1:]
+	}
+	if key == "" {
+		return fmt.Errorf("invalid environment variable %q", kv)
+	}
+	if i < 0 {
+		var ok bool
+		if value, ok = os.LookupEnv(key); !ok {
+			return nil
+		}
+	}
+	env[key] = value
+	return nil
+}
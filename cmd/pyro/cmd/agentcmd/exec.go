@@ -1,14 +1,93 @@
 package agentcmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/client"
 	"github.com/spf13/cobra"
 	"io"
 	"os"
+	"strings"
+	"time"
 )
 
+// processFlags configure the process of a command executed or started on the agent.
+type processFlags struct {
+	workingDir string
+	user       string
+	timeout    time.Duration
+	env        envFlags
+}
+
 type execFlags struct {
+	processFlags
 	interactive bool
+	tty         bool
+	verbose     bool
+	maxStdin    int64
+	retention   string
+	merge       bool
+	timestamps  bool
+}
+
+var outputRetentions = map[string]agentv1.OutputRetention{
+	"head": agentv1.OutputRetention_OUTPUT_RETENTION_HEAD,
+	"tail": agentv1.OutputRetention_OUTPUT_RETENTION_TAIL,
+}
+
+// execOptions returns the client options corresponding to the flags.
+func (f *execFlags) execOptions() ([]client.ExecOption, error) {
+	retention, ok := outputRetentions[f.retention]
+	if !ok {
+		return nil, fmt.Errorf("invalid output retention %q, must be either head or tail", f.retention)
+	}
+	opts, err := f.processOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, client.WithOutputRetention(retention))
+	if f.merge {
+		opts = append(opts, client.WithMergedOutput())
+	}
+	return opts, nil
+}
+
+// processOptions returns the client options corresponding to the process flags.
+func (f *processFlags) processOptions() ([]client.ExecOption, error) {
+	env, err := f.env.environment()
+	if err != nil {
+		return nil, err
+	}
+	envMode, err := f.env.environmentMode()
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.ExecOption{client.WithEnvironment(env), client.WithEnvironmentMode(envMode)}
+	if f.workingDir != "" {
+		opts = append(opts, client.WithWorkingDir(f.workingDir))
+	}
+	if f.user != "" {
+		user, group := splitUserGroup(f.user)
+		opts = append(opts, client.WithUser(user))
+		if group != "" {
+			opts = append(opts, client.WithGroup(group))
+		}
+	}
+	if f.timeout > 0 {
+		opts = append(opts, client.WithTimeout(f.timeout))
+	}
+	return opts, nil
+}
+
+// splitUserGroup splits a user specification of the form user[:group].
+func splitUserGroup(spec string) (user, group string) {
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
 }
 
 func newExecCmd(inr io.Reader, outw, errw io.WriteCloser) *cobra.Command {
@@ -20,21 +99,150 @@ func newExecCmd(inr io.Reader, outw, errw io.WriteCloser) *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			// The writers stay open, so that the result can still be reported once the command finished.
+			out, errOut := nopWriteCloser{outw}, nopWriteCloser{errw}
+			opts, err := flags.execOptions()
+			if err != nil {
+				return err
+			}
+			result := &client.Result{}
+			opts = append(opts, client.WithResult(result))
+			in := inr
+			if flags.timestamps {
+				if flags.tty {
+					return errors.New("--timestamps cannot be combined with --tty")
+				}
+				// The output is streamed to print it as soon as it was read, but stdin only if requested.
+				if !flags.interactive && !isPiped(inr) {
+					in = bytes.NewReader(nil)
+				}
+				printer := &timestampPrinter{outw: outw, errw: errw, outLineStart: true, errLineStart: true}
+				opts = append(opts, client.WithTimestamps(printer.print))
+				out, errOut = nopWriteCloser{io.Discard}, nopWriteCloser{io.Discard}
+			}
 			var exitCode int
-			var err error
-			if flags.interactive {
-				exitCode, err = apiClient.ExecuteInteractively(args, ctx, inr, outw, errw)
+			if flags.interactive || flags.tty || flags.timestamps {
+				exitCode, err = executeInteractively(ctx, flags, args, in, out, errOut, opts)
 			} else {
-				exitCode, err = apiClient.Execute(args, ctx, outw, errw)
+				if isPiped(inr) {
+					opts = append(opts, client.WithStdin(inr), client.WithMaxStdinSize(flags.maxStdin))
+				}
+				exitCode, err = apiClient.Execute(args, ctx, out, errOut, opts...)
 			}
 			if err != nil {
 				return fmt.Errorf("error executing command: %w", err)
 			}
+			warnTruncated(errw, "stdout", result.Stdout)
+			warnTruncated(errw, "stderr", result.Stderr)
+			if flags.verbose {
+				fmt.Fprintln(errw, result)
+			} else if result.TimedOut {
+				fmt.Fprintf(errw, "command timed out after %s\n", flags.timeout)
+			}
 			os.Exit(exitCode)
 			return nil
 		},
 	}
 
 	cmdExec.Flags().BoolVarP(&flags.interactive, "interactive", "i", false, "execute command interactively")
+	cmdExec.Flags().BoolVarP(&flags.tty, "tty", "t", false,
+		"allocate a pseudo-terminal for the command, implies --interactive")
+	cmdExec.Flags().BoolVarP(&flags.verbose, "verbose", "v", false,
+		"print a summary of how the command terminated and its resource usage")
+	addProcessFlags(cmdExec, &flags.processFlags)
+	cmdExec.Flags().Int64Var(&flags.maxStdin, "max-stdin-size", client.DefaultMaxStdinSize,
+		"maximum number of bytes read from piped stdin when not executing interactively")
+	cmdExec.Flags().StringVar(&flags.retention, "output-retention", "head",
+		"whether the head or tail of the output is kept if it exceeds the agent's maximum output size")
+	cmdExec.Flags().BoolVar(&flags.merge, "merge-output", false,
+		"merge stderr into stdout at the agent, preserving the order in which the command wrote them")
+	cmdExec.Flags().BoolVar(&flags.timestamps, "timestamps", false,
+		"prefix every line of output with the time the agent read it, which streams the output like --interactive")
 	return cmdExec
 }
+
+// addProcessFlags adds the flags configuring the process of a command to cmd.
+func addProcessFlags(cmd *cobra.Command, flags *processFlags) {
+	cmd.Flags().StringVarP(&flags.workingDir, "workdir", "w", "", "working directory of the command on the agent")
+	cmd.Flags().StringVarP(&flags.user, "user", "u", "",
+		"user to run the command as, in the form user[:group] using names or numeric ids")
+	cmd.Flags().DurationVar(&flags.timeout, "timeout", 0,
+		"terminate the command if it runs longer than the given duration, e.g. 30s")
+	cmd.Flags().StringArrayVarP(&flags.env.vars, "env", "e", nil,
+		"set an environment variable in the form KEY=VALUE, or KEY to copy it from the host")
+	cmd.Flags().StringArrayVar(&flags.env.files, "env-file", nil,
+		"read environment variables from a file with KEY=VALUE lines")
+	cmd.Flags().StringArrayVar(&flags.env.fromHost, "env-from-host", nil,
+		"copy the environment variable from the host, if it is set")
+	cmd.Flags().StringVar(&flags.env.mode, "env-mode", "",
+		"how the environment is combined with the agent's one: clean, inherit or merge (default merge)")
+}
+
+// warnTruncated warns if the output was truncated by the agent.
+func warnTruncated(errw io.Writer, name string, output client.OutputInfo) {
+	if output.Truncated {
+		fmt.Fprintf(errw, "warning: %s was truncated, the command wrote %d bytes in total. "+
+			"Use --interactive to stream the full output.\n", name, output.TotalBytes)
+	}
+}
+
+func executeInteractively(
+	ctx context.Context, flags *execFlags, args []string, inr io.Reader, outw, errw io.WriteCloser,
+	opts []client.ExecOption,
+) (int, error) {
+	opts = append(opts, client.WithSignalForwarding(client.DefaultForwardedSignals...))
+	if !flags.tty {
+		return apiClient.ExecuteInteractively(args, ctx, inr, outw, errw, opts...)
+	}
+	terminal, err := newLocalTerminal(inr)
+	if err != nil {
+		return 0, err
+	}
+	defer terminal.restore()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts = append(opts, terminal.execOptions(ctx)...)
+	return apiClient.ExecuteInteractively(args, ctx, inr, outw, errw, opts...)
+}
+
+// timestampFormat is the format of the timestamps prefixed to the output, which has a fixed width.
+const timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// timestampPrinter prints the output of a command line by line, each prefixed with the time the agent read it.
+type timestampPrinter struct {
+	outw, errw io.Writer
+	// outLineStart and errLineStart report whether the next output starts a new line.
+	outLineStart, errLineStart bool
+}
+
+func (p *timestampPrinter) print(chunk client.OutputChunk) error {
+	w, lineStart := p.outw, &p.outLineStart
+	if chunk.Stderr {
+		w, lineStart = p.errw, &p.errLineStart
+	}
+	prefix := chunk.Time.UTC().Format(timestampFormat) + " "
+	var b bytes.Buffer
+	for data := chunk.Data; len(data) != 0; {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		if *lineStart {
+			b.WriteString(prefix)
+		}
+		b.Write(line)
+		*lineStart = line[len(line)-1] == '\n'
+		data = data[len(line):]
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// nopWriteCloser is a writer that ignores Close.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,366 @@
+package agentcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// fileEntry is the output of the fs commands describing files.
+type fileEntry struct {
+	Path          string    `json:"path"`
+	Type          string    `json:"type"`
+	Mode          string    `json:"mode"`
+	UID           uint32    `json:"uid"`
+	GID           uint32    `json:"gid"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"modTime"`
+	SymlinkTarget string    `json:"symlinkTarget,omitempty"`
+}
+
+func newFileEntry(info *client.FileInfo) *fileEntry {
+	entry := &fileEntry{
+		Path:          info.Path,
+		Type:          fileTypeName(info.Mode),
+		Mode:          fmt.Sprintf("%04o", chmodBits(info.Mode)),
+		Size:          info.Size,
+		ModTime:       info.ModTime.Local(),
+		SymlinkTarget: info.SymlinkTarget,
+	}
+	if info.UID != nil {
+		entry.UID = *info.UID
+	}
+	if info.GID != nil {
+		entry.GID = *info.GID
+	}
+	return entry
+}
+
+func fileTypeName(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "char device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	default:
+		return "unknown"
+	}
+}
+
+// chmodBits returns the permission and special bits of the mode as in chmod(1).
+func chmodBits(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// parseChmodBits parses octal permission and special bits as in chmod(1).
+func parseChmodBits(s string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || bits&^0o7777 != 0 {
+		return 0, fmt.Errorf("invalid mode %q, must be octal like 0755", s)
+	}
+	mode := os.FileMode(bits).Perm()
+	if bits&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+func validateOutputFormat(output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("invalid output format %q, must be either table or json", output)
+	}
+	return nil
+}
+
+func newFsCmd(outw io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fs",
+		Short: "inspect and modify the agent's filesystem",
+		Long:  "Inspect and modify the agent's filesystem without executing commands. All paths are absolute.",
+	}
+	cmd.AddCommand(newFsLsCmd(outw))
+	cmd.AddCommand(newFsStatCmd(outw))
+	cmd.AddCommand(newFsMkdirCmd())
+	cmd.AddCommand(newFsRmCmd())
+	cmd.AddCommand(newFsMvCmd())
+	cmd.AddCommand(newFsChmodCmd())
+	cmd.AddCommand(newFsChownCmd())
+	return cmd
+}
+
+func newFsLsCmd(outw io.Writer) *cobra.Command {
+	var long bool
+	var output string
+	var pageSize int
+	cmd := &cobra.Command{
+		Use:   "ls <path>",
+		Short: "list a directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			ctx := context.Background()
+			encoder := json.NewEncoder(outw)
+			tw := tabwriter.NewWriter(outw, 0, 0, 1, ' ', 0)
+			var token string
+			// Entries are written page by page, so that huge directories are not buffered as a whole.
+			for {
+				entries, next, err := apiClient.ReadDirPage(ctx, args[0], token, pageSize)
+				if err != nil {
+					return err
+				}
+				for _, info := range entries {
+					if err := writeLsEntry(outw, tw, encoder, info, long, output); err != nil {
+						return err
+					}
+				}
+				if next == "" {
+					break
+				}
+				token = next
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "show mode, owner, size and modification time")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format, either table or json with one entry per line")
+	cmd.Flags().IntVar(&pageSize, "page-size", 0, "number of entries requested at once, defaults to the agent's one")
+	return cmd
+}
+
+func writeLsEntry(
+	outw io.Writer, tw *tabwriter.Writer, encoder *json.Encoder, info *client.FileInfo, long bool, output string,
+) error {
+	if output == "json" {
+		return encoder.Encode(newFileEntry(info))
+	}
+	name := path.Base(info.Path)
+	if !long {
+		_, err := fmt.Fprintln(outw, name)
+		return err
+	}
+	if info.SymlinkTarget != "" {
+		name += " -> " + info.SymlinkTarget
+	}
+	entry := newFileEntry(info)
+	_, err := fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n",
+		info.Mode, entry.UID, entry.GID, entry.Size, entry.ModTime.Format("2006-01-02 15:04"), name)
+	return err
+}
+
+func newFsStatCmd(outw io.Writer) *cobra.Command {
+	var follow bool
+	var output string
+	cmd := &cobra.Command{
+		Use:   "stat <path>",
+		Short: "show information about a file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			stat := apiClient.Lstat
+			if follow {
+				stat = apiClient.Stat
+			}
+			info, err := stat(context.Background(), args[0])
+			if err != nil {
+				return err
+			}
+			entry := newFileEntry(info)
+			if output == "json" {
+				encoder := json.NewEncoder(outw)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entry)
+			}
+			tw := tabwriter.NewWriter(outw, 0, 0, 2, ' ', 0)
+			rows := [][2]string{
+				{"Path", entry.Path},
+				{"Type", entry.Type},
+				{"Mode", fmt.Sprintf("%s (%s)", entry.Mode, info.Mode)},
+				{"Owner", fmt.Sprintf("%d:%d", entry.UID, entry.GID)},
+				{"Size", strconv.FormatInt(entry.Size, 10)},
+				{"Modified", entry.ModTime.Format(time.RFC3339)},
+			}
+			if entry.SymlinkTarget != "" {
+				rows = append(rows, [2]string{"Target", entry.SymlinkTarget})
+			}
+			for _, row := range rows {
+				if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+					return err
+				}
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "dereference", "L", false, "describe the target of a symlink")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format, either table or json")
+	return cmd
+}
+
+func newFsMkdirCmd() *cobra.Command {
+	var parents bool
+	var mode string
+	cmd := &cobra.Command{
+		Use:   "mkdir <path>...",
+		Short: "create directories",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			perm, err := parseChmodBits(mode)
+			if err != nil {
+				return err
+			}
+			mkdir := apiClient.Mkdir
+			if parents {
+				mkdir = apiClient.MkdirAll
+			}
+			for _, dir := range args {
+				if err := mkdir(context.Background(), dir, perm); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&parents, "parents", "p", false, "create missing parents and do not fail if the directory exists")
+	cmd.Flags().StringVarP(&mode, "mode", "m", "0755", "mode of created directories before applying the agent's umask")
+	return cmd
+}
+
+func newFsRmCmd() *cobra.Command {
+	var recursive bool
+	cmd := &cobra.Command{
+		Use:   "rm <path>...",
+		Short: "remove files or directories",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remove := apiClient.Remove
+			if recursive {
+				remove = apiClient.RemoveAll
+			}
+			for _, file := range args {
+				if err := remove(context.Background(), file); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "remove directories including their contents")
+	return cmd
+}
+
+func newFsMvCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mv <old-path> <new-path>",
+		Short: "rename a file, replacing the destination if it exists",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return apiClient.Rename(context.Background(), args[0], args[1])
+		},
+	}
+}
+
+func newFsChmodCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "chmod <mode> <path>...",
+		Short: "change the mode of files",
+		Long:  "Change the mode of files. The mode is octal like 0755 and may contain the setuid, setgid and sticky bits.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mode, err := parseChmodBits(args[0])
+			if err != nil {
+				return err
+			}
+			for _, file := range args[1:] {
+				if err := apiClient.Chmod(context.Background(), file, mode); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newFsChownCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "chown <uid>[:<gid>] <path>...",
+		Short: "change the owner of files",
+		Long: "Change the owner of files to the numeric uid and, if given, gid. " +
+			"An empty uid like in :100 leaves it unchanged.",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			uid, gid, err := parseOwner(args[0])
+			if err != nil {
+				return err
+			}
+			for _, file := range args[1:] {
+				if err := apiClient.Chown(context.Background(), file, uid, gid); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// parseOwner parses uid[:gid], where an omitted id is returned as -1.
+func parseOwner(s string) (uid, gid int, err error) {
+	parseID := func(id string) (int, error) {
+		if id == "" {
+			return -1, nil
+		}
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid owner %q, must be numeric uid[:gid]", s)
+		}
+		return int(n), nil
+	}
+	userID, groupID := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		userID, groupID = s[:i], s[i+1:]
+	}
+	if uid, err = parseID(userID); err != nil {
+		return 0, 0, err
+	}
+	if gid, err = parseID(groupID); err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
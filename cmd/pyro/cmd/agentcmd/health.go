@@ -0,0 +1,74 @@
+package agentcmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"io"
+	"time"
+)
+
+const healthPollInterval = 500 * time.Millisecond
+
+func newHealthCmd(outw io.Writer) *cobra.Command {
+	var (
+		wait    bool
+		timeout time.Duration
+		service string
+	)
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "check whether the agent is serving",
+		Args:  cobra.NoArgs,
+		// The agent may not be reachable yet, so don't connect to it up front.
+		PersistentPreRunE:  func(*cobra.Command, []string) error { return nil },
+		PersistentPostRunE: func(*cobra.Command, []string) error { return nil },
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cc, err := dialAgent()
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			status, err := checkHealth(ctx, healthpb.NewHealthClient(cc), service, wait)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(outw, status)
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&wait, "wait", false, "poll until the agent is serving")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "maximum duration to wait for the agent")
+	cmd.Flags().StringVar(&service, "service", "", "service to check, by default the agent as a whole")
+	return cmd
+}
+
+// checkHealth returns the status of the service. If wait is set, it polls until the service
+// is serving or ctx is done. Otherwise, it fails if the service is not serving.
+func checkHealth(
+	ctx context.Context, health healthpb.HealthClient, service string, wait bool,
+) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+	for {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		status := resp.GetStatus()
+		if err == nil && status == healthpb.HealthCheckResponse_SERVING {
+			return status, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("agent is %s", status)
+		}
+		if !wait {
+			return status, fmt.Errorf("error checking health: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return status, fmt.Errorf("agent is not serving after waiting: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package agentcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// agentInfo is the output of the info command.
+type agentInfo struct {
+	Version    string     `json:"version"`
+	Commit     string     `json:"commit"`
+	APIVersion string     `json:"apiVersion"`
+	Features   []string   `json:"features"`
+	OS         string     `json:"os"`
+	Kernel     string     `json:"kernel,omitempty"`
+	Arch       string     `json:"arch"`
+	Hostname   string     `json:"hostname,omitempty"`
+	BootTime   *time.Time `json:"bootTime,omitempty"`
+}
+
+func newAgentInfo(resp *agentv1.GetInfoResponse) *agentInfo {
+	info := &agentInfo{
+		Version:    resp.Version,
+		Commit:     resp.Commit,
+		APIVersion: resp.ApiVersion,
+		Features:   make([]string, len(resp.Features)),
+		OS:         resp.Os,
+		Kernel:     resp.Kernel,
+		Arch:       resp.Arch,
+		Hostname:   resp.Hostname,
+	}
+	for i, feature := range resp.Features {
+		info.Features[i] = client.FeatureName(feature)
+	}
+	if resp.BootTime != nil {
+		bootTime := resp.BootTime.AsTime().Local()
+		info.BootTime = &bootTime
+	}
+	return info
+}
+
+func (i *agentInfo) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	rows := [][2]string{
+		{"Version", i.Version},
+		{"Commit", i.Commit},
+		{"API version", i.APIVersion},
+		{"Features", strings.Join(i.Features, ", ")},
+		{"OS", i.OS},
+		{"Kernel", i.Kernel},
+		{"Arch", i.Arch},
+		{"Hostname", i.Hostname},
+	}
+	if i.BootTime != nil {
+		rows = append(rows, [2]string{"Boot time", i.BootTime.Format(time.RFC3339)})
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func newInfoCmd(outw io.Writer) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "info",
+		Short: "show the agent's version, supported features and system",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			resp, err := apiClient.Info(context.Background())
+			if err != nil {
+				return err
+			}
+			info := newAgentInfo(resp)
+			if output == "json" {
+				encoder := json.NewEncoder(outw)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(info)
+			}
+			return info.writeTable(outw)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format, either table or json")
+	return cmd
+}
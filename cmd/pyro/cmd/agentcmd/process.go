@@ -0,0 +1,265 @@
+package agentcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// processEntry is the output of the ps command describing a process.
+type processEntry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Command   []string  `json:"command"`
+	PID       int       `json:"pid"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"startedAt"`
+	ExitCode  *int      `json:"exitCode,omitempty"`
+}
+
+func newProcessEntry(p *client.Process) *processEntry {
+	entry := &processEntry{
+		ID:        p.ID,
+		Name:      p.Name,
+		Command:   p.Command,
+		PID:       p.PID,
+		State:     "running",
+		StartedAt: p.StartedAt.Local(),
+	}
+	if p.Result != nil {
+		entry.State = "exited"
+		entry.ExitCode = &p.Result.ExitCode
+	}
+	return entry
+}
+
+// parseSignal parses a signal given by its name, with or without the SIG prefix, or its number.
+func parseSignal(s string) (agentv1.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if _, ok := agentv1.Signal_name[int32(n)]; ok && n != 0 {
+			return agentv1.Signal(n), nil
+		}
+	} else if v, ok := agentv1.Signal_value["SIGNAL_"+strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok && v != 0 {
+		return agentv1.Signal(v), nil
+	}
+	return 0, fmt.Errorf("unknown signal %q", s)
+}
+
+func newRunCmd(inr io.Reader, outw, errw io.Writer) *cobra.Command {
+	flags := &processFlags{}
+	var detach, interactive, verbose bool
+	var name string
+	cmd := &cobra.Command{
+		Use:   "run <command...>",
+		Short: "start a command on the agent detached from the cli",
+		Long: "Start a command on the agent, which keeps running independently of the cli and whose output is buffered " +
+			"by the agent. Unless using -d, the cli attaches to it and exits with its exit code once it exited. " +
+			"Otherwise, the process id is printed, which can be used with attach, logs, ps, wait and kill.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := flags.processOptions()
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				opts = append(opts, client.WithName(name))
+			}
+			if interactive {
+				opts = append(opts, client.WithOpenStdin())
+			}
+			ctx := context.Background()
+			p, err := apiClient.StartProcess(ctx, args, opts...)
+			if err != nil {
+				return err
+			}
+			if detach {
+				_, err := fmt.Fprintln(outw, p.ID)
+				return err
+			}
+			var stdin io.Reader
+			if interactive {
+				stdin = inr
+			}
+			if p, err = apiClient.AttachProcess(ctx, p.ID, stdin, outw, errw, client.WithFromStart()); err != nil {
+				return err
+			}
+			exitWithResult(errw, p, verbose)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&detach, "detach", "d", false, "print the process id instead of attaching to the process")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false,
+		"keep stdin of the process open, forwarding the local stdin unless detached")
+	cmd.Flags().StringVar(&name, "name", "", "unique name of the process, which can be used instead of its id")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"print a summary of how the command terminated and its resource usage")
+	addProcessFlags(cmd, flags)
+	return cmd
+}
+
+// exitWithResult exits with the exit code of the exited process.
+func exitWithResult(errw io.Writer, p *client.Process, verbose bool) {
+	if verbose {
+		fmt.Fprintln(errw, p.Result)
+	}
+	os.Exit(p.Result.ExitCode)
+}
+
+func newAttachCmd(inr io.Reader, outw, errw io.Writer) *cobra.Command {
+	var fromStart, noStdin, verbose bool
+	cmd := &cobra.Command{
+		Use:   "attach <id>",
+		Short: "attach to a process started by run",
+		Long: "Attach to the process, given by id or name, and exit with its exit code once it exited. " +
+			"If the process was started with -i, the local stdin is forwarded to it. " +
+			"If the connection to the agent is lost, the cli reattaches and continues where it left off.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opts []client.AttachOption
+			if fromStart {
+				opts = append(opts, client.WithFromStart())
+			}
+			stdin := inr
+			if noStdin {
+				stdin = nil
+			}
+			p, err := apiClient.AttachProcess(context.Background(), args[0], stdin, outw, errw, opts...)
+			if err != nil {
+				return err
+			}
+			exitWithResult(errw, p, verbose)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fromStart, "from-start", false, "replay the output buffered by the agent before following it")
+	cmd.Flags().BoolVar(&noStdin, "no-stdin", false, "do not forward the local stdin")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false,
+		"print a summary of how the command terminated and its resource usage")
+	return cmd
+}
+
+func newLogsCmd(outw, errw io.Writer) *cobra.Command {
+	var follow bool
+	cmd := &cobra.Command{
+		Use:   "logs <id>",
+		Short: "print the output of a process started by run",
+		Long: "Print the output of the process, given by id or name, buffered by the agent. " +
+			"Only the most recent output is buffered.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			if follow {
+				_, err := apiClient.AttachProcess(ctx, args[0], nil, outw, errw, client.WithFromStart())
+				return err
+			}
+			_, err := apiClient.ProcessOutput(ctx, args[0], outw, errw)
+			return err
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "follow the output until the process exited")
+	return cmd
+}
+
+func newPsCmd(outw io.Writer) *cobra.Command {
+	var all bool
+	var output string
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "list the processes started by run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(output); err != nil {
+				return err
+			}
+			state := agentv1.ProcessState_PROCESS_STATE_RUNNING
+			if all {
+				state = agentv1.ProcessState_PROCESS_STATE_UNSPECIFIED
+			}
+			processes, err := apiClient.ListProcesses(context.Background(), state)
+			if err != nil {
+				return err
+			}
+			entries := make([]*processEntry, len(processes))
+			for i, p := range processes {
+				entries[i] = newProcessEntry(p)
+			}
+			if output == "json" {
+				encoder := json.NewEncoder(outw)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(entries)
+			}
+			return writeProcessTable(outw, entries)
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all", false, "include exited processes")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format, either table or json")
+	return cmd
+}
+
+func writeProcessTable(outw io.Writer, entries []*processEntry) error {
+	tw := tabwriter.NewWriter(outw, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPID\tSTATUS\tSTARTED\tCOMMAND")
+	for _, e := range entries {
+		state := e.State
+		if e.ExitCode != nil {
+			state = fmt.Sprintf("exited (%d)", *e.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			e.ID, e.Name, e.PID, state, e.StartedAt.Format("2006-01-02 15:04:05"), strings.Join(e.Command, " "))
+	}
+	return tw.Flush()
+}
+
+func newWaitCmd(outw io.Writer) *cobra.Command {
+	return &cobra.Command{
+		Use:   "wait <id>...",
+		Short: "wait for processes to exit and print their exit codes",
+		Long:  "Wait for the processes, given by id or name, to exit and print their exit codes, one per line.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, id := range args {
+				p, err := apiClient.WaitProcess(context.Background(), id)
+				if err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintln(outw, p.Result.ExitCode); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newKillCmd() *cobra.Command {
+	var sig string
+	cmd := &cobra.Command{
+		Use:   "kill <id>...",
+		Short: "send a signal to processes",
+		Long:  "Send a signal to the process groups of the processes, given by id or name.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			signal, err := parseSignal(sig)
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				if err := apiClient.KillProcess(context.Background(), id, signal); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&sig, "signal", "s", "TERM", "signal to send, given by name like TERM or number like 15")
+	return cmd
+}
@@ -0,0 +1,88 @@
+package agentcmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirkrypt0/pyro/pkg/archive"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+)
+
+type syncFlags struct {
+	delete   bool
+	checksum bool
+	dryRun   bool
+	verbose  bool
+	excludes []string
+	compress string
+}
+
+func newSyncCmd(outw io.Writer) *cobra.Command {
+	flags := &syncFlags{}
+	cmd := &cobra.Command{
+		Use:   "sync <local> remote:<path>",
+		Short: "sync a local directory to the agent",
+		Long: "Sync a local directory to the agent by only sending entries that are missing or changed. " +
+			"Entries are compared by type, mode, size and modification time or, using --checksum, content. " +
+			"Paths matching the patterns in the local directory's " + client.IgnoreFile + " file or given by --exclude " +
+			"are skipped and never deleted. The patterns follow a subset of the .gitignore syntax.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !strings.HasPrefix(args[1], remotePrefix) || strings.HasPrefix(args[0], remotePrefix) {
+				return errors.New("source must be a local and destination a remote path")
+			}
+			compression, err := archive.ParseCompression(flags.compress)
+			if err != nil {
+				return err
+			}
+			opts := []client.SyncOption{client.WithExcludes(flags.excludes...), client.WithSyncCompression(compression)}
+			if flags.delete {
+				opts = append(opts, client.WithDelete())
+			}
+			if flags.checksum {
+				opts = append(opts, client.WithChecksum())
+			}
+			if flags.dryRun {
+				opts = append(opts, client.WithDryRun())
+			}
+			result, err := apiClient.Sync(cmd.Context(), args[0], strings.TrimPrefix(args[1], remotePrefix), opts...)
+			if err != nil {
+				return err
+			}
+			return writeSyncResult(outw, result, flags)
+		},
+	}
+	cmd.Flags().BoolVar(&flags.delete, "delete", false, "delete entries on the agent that do not exist locally")
+	cmd.Flags().BoolVarP(&flags.checksum, "checksum", "c", false,
+		"compare regular files of the same size by checksum instead of modification time")
+	cmd.Flags().BoolVarP(&flags.dryRun, "dry-run", "n", false, "only show what would be done")
+	cmd.Flags().BoolVarP(&flags.verbose, "verbose", "v", false, "list uploaded and deleted entries")
+	cmd.Flags().StringArrayVar(&flags.excludes, "exclude", nil, "additional pattern of paths to skip, may be repeated")
+	cmd.Flags().StringVar(&flags.compress, "compress", "none",
+		"compression of changed entries in transit, either none or gzip")
+	return cmd
+}
+
+func writeSyncResult(w io.Writer, result *client.SyncResult, flags *syncFlags) error {
+	if flags.verbose || flags.dryRun {
+		for _, rel := range result.Deleted {
+			if _, err := fmt.Fprintf(w, "deleting %s\n", rel); err != nil {
+				return err
+			}
+		}
+		for _, rel := range result.Uploaded {
+			if _, err := fmt.Fprintf(w, "uploading %s\n", rel); err != nil {
+				return err
+			}
+		}
+	}
+	prefix := ""
+	if flags.dryRun {
+		prefix = "would have "
+	}
+	_, err := fmt.Fprintf(w, "%suploaded %d entries (%d bytes), %sdeleted %d, %d unchanged\n",
+		prefix, len(result.Uploaded), result.Bytes, prefix, len(result.Deleted), result.Unchanged)
+	return err
+}
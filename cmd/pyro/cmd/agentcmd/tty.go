@@ -0,0 +1,67 @@
+package agentcmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"golang.org/x/term"
+	"io"
+	"os"
+)
+
+const defaultTerm = "xterm"
+
+var errNotATerminal = errors.New("the input device is not a terminal")
+
+// isPiped reports whether the input is a file, like a pipe, that is not a terminal.
+func isPiped(inr io.Reader) bool {
+	f, ok := inr.(*os.File)
+	return ok && !term.IsTerminal(int(f.Fd()))
+}
+
+// localTerminal is the terminal the cli is running in.
+type localTerminal struct {
+	fd    int
+	state *term.State
+}
+
+// newLocalTerminal returns the terminal connected to inr and puts it into raw mode.
+func newLocalTerminal(inr io.Reader) (*localTerminal, error) {
+	f, ok := inr.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil, errNotATerminal
+	}
+	fd := int(f.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("error putting terminal into raw mode: %w", err)
+	}
+	return &localTerminal{fd: fd, state: state}, nil
+}
+
+// restore restores the terminal to the state before it was put into raw mode.
+func (t *localTerminal) restore() {
+	_ = term.Restore(t.fd, t.state)
+}
+
+func (t *localTerminal) size() client.WindowSize {
+	cols, rows, err := term.GetSize(t.fd)
+	if err != nil {
+		return client.WindowSize{}
+	}
+	return client.WindowSize{Rows: uint32(rows), Cols: uint32(cols)}
+}
+
+// execOptions returns the options attaching the remote command to a terminal
+// mirroring the local one, until ctx is done.
+func (t *localTerminal) execOptions(ctx context.Context) []client.ExecOption {
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = defaultTerm
+	}
+	return []client.ExecOption{
+		client.WithTerminal(termType, t.size()),
+		client.WithResize(t.watchResize(ctx)),
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package agentcmd
+
+import (
+	"context"
+	"github.com/sirkrypt0/pyro/pkg/client"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchResize sends the current window size whenever the terminal is resized, until ctx is done.
+func (t *localTerminal) watchResize(ctx context.Context) <-chan client.WindowSize {
+	sizes := make(chan client.WindowSize)
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		defer signal.Stop(winch)
+		defer close(sizes)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-winch:
+				select {
+				case sizes <- t.size():
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return sizes
+}
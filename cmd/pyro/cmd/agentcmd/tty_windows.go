@@ -0,0 +1,11 @@
+package agentcmd
+
+import (
+	"context"
+	"github.com/sirkrypt0/pyro/pkg/client"
+)
+
+// watchResize is not supported on Windows, as there is no SIGWINCH.
+func (t *localTerminal) watchResize(_ context.Context) <-chan client.WindowSize {
+	return nil
+}
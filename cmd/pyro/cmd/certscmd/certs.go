@@ -0,0 +1,38 @@
+package certscmd
+
+import (
+	"fmt"
+	"github.com/sirkrypt0/pyro/pkg/certs"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+func NewCertsCmd(outw io.Writer) *cobra.Command {
+	var (
+		dir  string
+		opts certs.GenerateOptions
+	)
+	cmd := &cobra.Command{
+		Use:   "certs",
+		Short: "Generate a throwaway CA plus agent and client certificates for development setups",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			server, client, err := certs.Generate(dir, opts)
+			if err != nil {
+				return fmt.Errorf("error generating certificates: %w", err)
+			}
+			_, err = fmt.Fprintf(outw, "Start the agent with:\n  pyro-agent -tls-cert %s -tls-key %s -tls-ca %s\n"+
+				"Connect to it with:\n  pyro agent --tls-cert %s --tls-key %s --tls-ca %s ...\n",
+				server.Cert, server.Key, server.CA, client.Cert, client.Key, client.CA)
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&dir, "out", "o", "certs", "directory to write the certificates and keys to")
+	cmd.Flags().StringSliceVar(&opts.Hosts, "host", certs.DefaultHosts,
+		"DNS names and IP addresses the agent's certificate is valid for")
+	cmd.Flags().StringVar(&opts.ClientName, "client-name", certs.DefaultClientName,
+		"common name of the client certificate")
+	cmd.Flags().DurationVar(&opts.Validity, "validity", certs.DefaultValidity, "duration the certificates are valid for")
+	cmd.Flags().BoolVarP(&opts.Overwrite, "force", "f", false, "overwrite existing files")
+	return cmd
+}
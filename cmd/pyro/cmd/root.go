@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"github.com/sirkrypt0/pyro/cmd/pyro/cmd/agentcmd"
+	"github.com/sirkrypt0/pyro/cmd/pyro/cmd/certscmd"
+	"github.com/sirkrypt0/pyro/cmd/pyro/cmd/tokencmd"
 	"github.com/spf13/cobra"
 	"io"
 )
@@ -12,5 +14,7 @@ func NewPyroCommand(inr io.Reader, outw, errw io.WriteCloser) *cobra.Command {
 		Short: "A cli for interacting with pyro services",
 	}
 	root.AddCommand(agentcmd.NewAgentCmd(inr, outw, errw))
+	root.AddCommand(certscmd.NewCertsCmd(outw))
+	root.AddCommand(tokencmd.NewTokenCmd(outw))
 	return root
 }
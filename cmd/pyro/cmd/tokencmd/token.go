@@ -0,0 +1,40 @@
+package tokencmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirkrypt0/pyro/pkg/auth"
+	"github.com/spf13/cobra"
+	"io"
+	"time"
+)
+
+const defaultValidity = time.Hour
+
+func NewTokenCmd(outw io.Writer) *cobra.Command {
+	var (
+		secretFile string
+		validity   time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "token <identity>",
+		Short: "Issue a short-lived bearer token for the identity, signed with the agent's HMAC secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if validity <= 0 {
+				return errors.New("validity must be positive")
+			}
+			secret, err := auth.LoadHMACSecret(secretFile)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(outw, auth.NewHMACTokens(secret).Issue(args[0], validity))
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&secretFile, "secret-file", "s", "",
+		"file containing the secret the agent verifies tokens with")
+	cmd.Flags().DurationVar(&validity, "validity", defaultValidity, "duration the token is valid for")
+	_ = cmd.MarkFlagRequired("secret-file")
+	return cmd
+}
@@ -3,10 +3,12 @@ module github.com/sirkrypt0/pyro
 go 1.16
 
 require (
+	github.com/creack/pty v1.1.13
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.2.1
 	github.com/stretchr/testify v1.7.0
-	golang.org/x/sys v0.0.0-20210806184541-e5e7981a1069 // indirect
+	golang.org/x/sys v0.0.0-20210806184541-e5e7981a1069
+	golang.org/x/term v0.0.0-20210503060354-a79de5458b56
 	google.golang.org/grpc v1.39.1
 	google.golang.org/protobuf v1.27.1
 )
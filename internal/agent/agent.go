@@ -1,33 +1,94 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	api "github.com/sirkrypt0/pyro/api/agent/v1"
 	"github.com/sirkrypt0/pyro/pkg/logging"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"time"
 )
 
 var _ api.AgentServiceServer = (*server)(nil)
 
 type server struct {
 	api.UnimplementedAgentServiceServer
-	logger *logrus.Entry
+	logger        *logrus.Entry
+	maxOutputSize int
+	tlsConfig     *tls.Config
+	authorizer    *authorizer
+	reflection    bool
+	processes     *processRegistry
+	// processBufferSize is the number of output bytes buffered per started process.
+	processBufferSize int
 }
 
-func NewGRPCServer() (gsrv *grpc.Server, err error) {
-	gsrv = grpc.NewServer()
-	srv, err := NewServer()
+// GRPCServer is the gRPC server of the agent. Besides the agent service, it serves the standard
+// health service, which reports the agent as serving until it is stopped.
+type GRPCServer struct {
+	*grpc.Server
+	health *health.Server
+}
+
+// GracefulStop reports the agent as not serving and stops it once all pending calls finished.
+func (s *GRPCServer) GracefulStop() {
+	s.health.Shutdown()
+	s.Server.GracefulStop()
+}
+
+// Stop reports the agent as not serving and stops it immediately.
+func (s *GRPCServer) Stop() {
+	s.health.Shutdown()
+	s.Server.Stop()
+}
+
+func NewGRPCServer(opts ...Option) (gsrv *GRPCServer, err error) {
+	srv, err := NewServer(opts...)
 	if err != nil {
 		return nil, err
 	}
+	var serverOpts []grpc.ServerOption
+	if srv.tlsConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(srv.tlsConfig)))
+	}
+	if srv.authorizer != nil {
+		serverOpts = append(serverOpts,
+			grpc.ChainUnaryInterceptor(srv.authorizer.unaryInterceptor),
+			grpc.ChainStreamInterceptor(srv.authorizer.streamInterceptor),
+		)
+	}
+	gsrv = &GRPCServer{Server: grpc.NewServer(serverOpts...), health: health.NewServer()}
 	api.RegisterAgentServiceServer(gsrv, srv)
+	healthpb.RegisterHealthServer(gsrv, gsrv.health)
+	gsrv.health.SetServingStatus(api.AgentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	if srv.reflection {
+		reflection.Register(gsrv)
+	}
 	return gsrv, nil
 }
 
-func NewServer() (srv *server, err error) {
-	srv = &server{logger: logging.GetLogger("agent")}
+func NewServer(opts ...Option) (srv *server, err error) {
+	srv = &server{
+		logger:            logging.GetLogger("agent"),
+		maxOutputSize:     DefaultMaxOutputSize,
+		processes:         newProcessRegistry(),
+		processBufferSize: DefaultProcessOutputBufferSize,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	if srv.maxOutputSize <= 0 || srv.maxOutputSize > MaxOutputSizeLimit {
+		return nil, fmt.Errorf("maximum output size %d must be between 1 and %d", srv.maxOutputSize, MaxOutputSizeLimit)
+	}
 	return srv, nil
 }
 
@@ -35,23 +96,83 @@ func (s *server) ExecuteCommand(
 	ctx context.Context, req *api.ExecuteCommandRequest,
 ) (*api.ExecuteCommandResponse, error) {
 	s.logger.WithField("executeCommandRequest", req).Debug("Got execute command request")
+	spec := specFromRequest(req)
+	cmd, err := newCommand(spec)
+	if err != nil {
+		return nil, err
+	}
+	stdout := newLimitedBuffer(s.maxOutputSize, req.OutputRetention)
+	stderr := newLimitedBuffer(s.maxOutputSize, req.OutputRetention)
+	cmd.Stdin = bytes.NewReader(req.Stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if spec.mergeOutput {
+		// The command shares a single pipe for both, if stdout and stderr are the same writer.
+		cmd.Stderr = stdout
+	}
+	startedAt := time.Now()
+	if err := withUmask(cmd, spec.umask, cmd.Start); err != nil {
+		return nil, startError(err)
+	}
+	stop := supervise(ctx, cmd, spec.timeout, spec.gracePeriod)
+	err = waitError(cmd.Wait())
+	timedOut := stop()
+	if err != nil {
+		return nil, err
+	}
+	result := newExecuteResult(cmd.ProcessState, startedAt, time.Now())
+	result.TimedOut = timedOut
+	s.logger.WithField("result", result).Debug("Command exited")
 	return &api.ExecuteCommandResponse{
-		Stdout:   &api.ExecuteIO{Close: true, Data: []byte("stdout")},
-		Stderr:   &api.ExecuteIO{Close: true, Data: []byte("stderr")},
-		ExitCode: 0,
+		Stdout:   stdout.executeIO(),
+		Stderr:   stderr.executeIO(),
+		ExitCode: result.ExitCode,
+		Result:   result,
 	}, nil
 }
 
 func (s *server) ExecuteCommandStream(stream api.AgentService_ExecuteCommandStreamServer) error {
 	s.logger.WithField("executeCommandStreamServer", stream).Debug("Got execute command request")
-	err := stream.Send(&api.ExecuteCommandStreamResponse{
-		Stdout: &api.ExecuteIO{Close: true, Data: []byte("stdout")},
-		Stderr: &api.ExecuteIO{Close: true, Data: []byte("stderr")},
-		Result: &api.ExecuteResult{
-			Exited:   true,
-			ExitCode: 0,
-		},
-	})
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed receiving execute command stream request: %w", err)
+	}
+	if req.Prepare == nil {
+		return status.Error(codes.InvalidArgument, "first request must contain prepare")
+	}
+	spec := specFromPrepare(req.Prepare)
+	cmd, err := newCommand(spec)
+	if err != nil {
+		return err
+	}
+	startedAt := time.Now()
+	proc, err := startProcess(cmd, spec, req.Prepare.Terminal)
+	if err != nil {
+		return err
+	}
+
+	stop := supervise(stream.Context(), cmd, spec.timeout, spec.gracePeriod)
+
+	sender := &streamSender{stream: stream, timestamps: req.Prepare.Timestamps}
+	// If sending fails, the call ended, so the command is killed and forwarding its output fails as well.
+	_ = sender.Send(&api.ExecuteCommandStreamResponse{Started: true})
+
+	go s.forwardInput(stream, proc)
+
+	outputErr := forwardOutputs(proc, sender)
+
+	err = waitError(proc.wait())
+	timedOut := stop()
+	if outputErr != nil {
+		return outputErr
+	}
+	if err != nil {
+		return err
+	}
+	result := newExecuteResult(cmd.ProcessState, startedAt, time.Now())
+	result.TimedOut = timedOut
+	s.logger.WithField("result", result).Debug("Command exited")
+	err = sender.Send(&api.ExecuteCommandStreamResponse{Result: result})
 	if err != nil {
 		return fmt.Errorf("failed sending execute command stream response: %w", err)
 	}
@@ -1,13 +1,35 @@
 package agent
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"fmt"
 	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/archive"
+	"github.com/sirkrypt0/pyro/pkg/auth"
+	"github.com/sirkrypt0/pyro/pkg/certs"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 type ServerTestSuite struct {
@@ -26,7 +48,7 @@ func (s *ServerTestSuite) SetupTest() {
 	s.teardownServer = teardown
 }
 
-func (s *ServerTestSuite) TeardownTest() {
+func (s *ServerTestSuite) TearDownTest() {
 	s.teardownServer()
 }
 
@@ -37,8 +59,8 @@ func (s *ServerTestSuite) TestExecuteCommand() {
 		Environment: map[string]string{"PATH": "/bin"},
 	}
 	expectedResponse := &api.ExecuteCommandResponse{
-		Stdout:   &api.ExecuteIO{Close: true, Data: []byte("stdout")},
-		Stderr:   &api.ExecuteIO{Close: true, Data: []byte("stderr")},
+		Stdout:   &api.ExecuteIO{Close: true, Data: []byte("hello world\n")},
+		Stderr:   &api.ExecuteIO{Close: true, Data: nil},
 		ExitCode: 0,
 	}
 	resp, err := s.client.ExecuteCommand(ctx, req)
@@ -50,6 +72,314 @@ func (s *ServerTestSuite) TestExecuteCommand() {
 	s.Require().NotNil(resp.Stderr)
 	s.Equal(expectedResponse.Stderr.Close, resp.Stderr.Close)
 	s.Equal(expectedResponse.Stderr.Data, resp.Stderr.Data)
+	s.Equal(expectedResponse.ExitCode, resp.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandSeparatesOutputAndExitCode() {
+	ctx := context.Background()
+	req := &api.ExecuteCommandRequest{
+		Command:     []string{"sh", "-c", "echo out; echo err >&2; echo $FOO; exit 3"},
+		Environment: map[string]string{"FOO": "bar"},
+	}
+	resp, err := s.client.ExecuteCommand(ctx, req)
+	s.Require().NoError(err)
+	s.Equal([]byte("out\nbar\n"), resp.Stdout.Data)
+	s.Equal([]byte("err\n"), resp.Stderr.Data)
+	s.Equal(int32(3), resp.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandMergesOutput() {
+	req := &api.ExecuteCommandRequest{
+		Command:     []string{"sh", "-c", "echo out; echo err >&2; echo out"},
+		MergeOutput: true,
+	}
+	resp, err := s.client.ExecuteCommand(context.Background(), req)
+	s.Require().NoError(err)
+	s.Equal("out\nerr\nout\n", string(resp.Stdout.Data))
+	s.Empty(resp.Stderr.Data)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStdin() {
+	ctx := context.Background()
+	req := &api.ExecuteCommandRequest{
+		Command: []string{"sh", "-c", "cat; echo"},
+		Stdin:   []byte(`{"hello": "world"}`),
+	}
+	resp, err := s.client.ExecuteCommand(ctx, req)
+	s.Require().NoError(err)
+	s.Equal("{\"hello\": \"world\"}\n", string(resp.Stdout.Data))
+	s.Equal(int32(0), resp.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandTruncatesOutput() {
+	client, teardown := newTestServer(s.T(), WithMaxOutputSize(4))
+	defer teardown()
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		retention api.OutputRetention
+		stdout    string
+		stderr    string
+	}{
+		{name: "default", stdout: "0123", stderr: "ab"},
+		{name: "head", retention: api.OutputRetention_OUTPUT_RETENTION_HEAD, stdout: "0123", stderr: "ab"},
+		{name: "tail", retention: api.OutputRetention_OUTPUT_RETENTION_TAIL, stdout: "6789", stderr: "ab"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			req := &api.ExecuteCommandRequest{
+				Command:         []string{"sh", "-c", "printf 01234; printf 56789; printf ab >&2"},
+				OutputRetention: tt.retention,
+			}
+			resp, err := client.ExecuteCommand(ctx, req)
+			s.Require().NoError(err)
+			s.Equal(tt.stdout, string(resp.Stdout.Data))
+			s.True(resp.Stdout.Truncated)
+			s.Equal(uint64(10), resp.Stdout.TotalBytes)
+			s.Equal(tt.stderr, string(resp.Stderr.Data))
+			s.False(resp.Stderr.Truncated)
+			s.Equal(uint64(2), resp.Stderr.TotalBytes)
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestExecuteCommandOutputFitsMessageAtLimit() {
+	client, teardown := newTestServer(s.T(), WithMaxOutputSize(MaxOutputSizeLimit))
+	defer teardown()
+	size := strconv.Itoa(MaxOutputSizeLimit + 1)
+	resp, err := client.ExecuteCommand(context.Background(), &api.ExecuteCommandRequest{
+		Command: []string{"sh", "-c", "head -c " + size + " /dev/zero; head -c " + size + " /dev/zero >&2"},
+	})
+	s.Require().NoError(err)
+	s.Len(resp.Stdout.Data, MaxOutputSizeLimit)
+	s.Len(resp.Stderr.Data, MaxOutputSizeLimit)
+	s.True(resp.Stdout.Truncated)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandReportsTermination() {
+	ctx := context.Background()
+	req := &api.ExecuteCommandRequest{
+		Command: []string{"sh", "-c", "kill -KILL $$"},
+	}
+	resp, err := s.client.ExecuteCommand(ctx, req)
+	s.Require().NoError(err)
+	s.Require().NotNil(resp.Result)
+	s.True(resp.Result.Exited)
+	s.Equal(int32(-1), resp.Result.ExitCode)
+	s.Equal(api.Signal_SIGNAL_KILL, resp.Result.Signal)
+	s.False(resp.Result.CoreDumped)
+	s.Require().NotNil(resp.Result.StartedAt)
+	s.Require().NotNil(resp.Result.FinishedAt)
+	s.False(resp.Result.FinishedAt.AsTime().Before(resp.Result.StartedAt.AsTime()))
+	s.NotNil(resp.Result.UserTime)
+	s.NotNil(resp.Result.SystemTime)
+	s.Positive(resp.Result.MaxRssBytes)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandEnvironmentModes() {
+	ctx := context.Background()
+	for _, name := range []string{"PYRO_AGENT_VAR", "PYRO_OVERRIDDEN_VAR"} {
+		s.Require().NoError(os.Setenv(name, "agent"))
+		defer os.Unsetenv(name)
+	}
+	tests := []struct {
+		name     string
+		mode     api.EnvironmentMode
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "default merges",
+			env:      map[string]string{"PYRO_OVERRIDDEN_VAR": "request"},
+			expected: "agent request\n",
+		},
+		{
+			name:     "merge",
+			mode:     api.EnvironmentMode_ENVIRONMENT_MODE_MERGE,
+			env:      map[string]string{"PYRO_OVERRIDDEN_VAR": "request"},
+			expected: "agent request\n",
+		},
+		{
+			name:     "inherit",
+			mode:     api.EnvironmentMode_ENVIRONMENT_MODE_INHERIT,
+			expected: "agent agent\n",
+		},
+		{
+			name:     "clean",
+			mode:     api.EnvironmentMode_ENVIRONMENT_MODE_CLEAN,
+			env:      map[string]string{"PYRO_OVERRIDDEN_VAR": "request"},
+			expected: " request\n",
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			req := &api.ExecuteCommandRequest{
+				Command:         []string{"/bin/sh", "-c", "echo \"$PYRO_AGENT_VAR $PYRO_OVERRIDDEN_VAR\""},
+				Environment:     tt.env,
+				EnvironmentMode: tt.mode,
+			}
+			resp, err := s.client.ExecuteCommand(ctx, req)
+			s.Require().NoError(err)
+			s.Equal(tt.expected, string(resp.Stdout.Data))
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestExecuteCommandWorkingDirAndUmask() {
+	ctx := context.Background()
+	dir := s.T().TempDir()
+	umask := uint32(0o027)
+	req := &api.ExecuteCommandRequest{
+		Command:    []string{"sh", "-c", "pwd; umask"},
+		WorkingDir: dir,
+		Umask:      &umask,
+	}
+	resp, err := s.client.ExecuteCommand(ctx, req)
+	s.Require().NoError(err)
+	s.Equal(dir+"\n0027\n", string(resp.Stdout.Data))
+}
+
+func (s *ServerTestSuite) TestExecuteCommandUmaskKeepsAgentUmask() {
+	ctx := context.Background()
+	umask := uint32(0o077)
+	previous := syscall.Umask(0o022)
+	defer syscall.Umask(previous)
+
+	resp, err := s.client.ExecuteCommand(ctx, &api.ExecuteCommandRequest{
+		Command:     []string{"sh", "-c", "umask; env"},
+		Environment: map[string]string{"A": "1"},
+		Umask:       &umask,
+	})
+	s.Require().NoError(err)
+	s.Equal("0077\n", strings.SplitAfterN(string(resp.Stdout.Data), "\n", 2)[0])
+	s.Contains(string(resp.Stdout.Data), "A=1\n")
+	s.Equal(0o022, syscall.Umask(0o022), "agent umask")
+
+	stream, err := s.client.ExecuteCommandStream(ctx)
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{
+			Command:  []string{"sh", "-c", "umask"},
+			Terminal: &api.Terminal{},
+			Umask:    &umask,
+		},
+	}))
+	var stdout string
+	var result *api.ExecuteResult
+	for result == nil {
+		resp, err := stream.Recv()
+		s.Require().NoError(err)
+		if resp.Stdout != nil {
+			stdout += string(resp.Stdout.Data)
+		}
+		result = resp.Result
+	}
+	s.Equal("0077\r\n", stdout)
+	s.Equal(int32(0), result.ExitCode)
+
+	for _, command := range []string{"missing-executable", "/does/not/exist"} {
+		_, err = s.client.ExecuteCommand(ctx, &api.ExecuteCommandRequest{Command: []string{command}, Umask: &umask})
+		s.Equal(codes.NotFound, status.Code(err), command)
+	}
+}
+
+func (s *ServerTestSuite) TestExecuteCommandUser() {
+	if os.Geteuid() != 0 {
+		s.T().Skip("switching users requires root")
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		req      *api.ExecuteCommandRequest
+		expected string
+	}{
+		{
+			name:     "name",
+			req:      &api.ExecuteCommandRequest{User: "nobody"},
+			expected: "65534 65534\n",
+		},
+		{
+			name:     "numeric ids",
+			req:      &api.ExecuteCommandRequest{User: "1234", Group: "4321", SupplementaryGroups: []string{"5678"}},
+			expected: "1234 4321 5678\n",
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			tt.req.Command = []string{"sh", "-c", "echo $(id -u) $(id -G)"}
+			resp, err := s.client.ExecuteCommand(ctx, tt.req)
+			s.Require().NoError(err)
+			s.Equal(tt.expected, string(resp.Stdout.Data))
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestExecuteCommandTimeout() {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		script string
+		signal api.Signal
+	}{
+		{name: "terminated", script: "sleep 10", signal: api.Signal_SIGNAL_TERM},
+		{name: "killed after grace period", script: "trap '' TERM; sleep 10", signal: api.Signal_SIGNAL_KILL},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			req := &api.ExecuteCommandRequest{
+				Command:            []string{"sh", "-c", tt.script},
+				Timeout:            durationpb.New(100 * time.Millisecond),
+				TimeoutGracePeriod: durationpb.New(100 * time.Millisecond),
+			}
+			resp, err := s.client.ExecuteCommand(ctx, req)
+			s.Require().NoError(err)
+			s.True(resp.Result.TimedOut)
+			s.Equal(tt.signal, resp.Result.Signal)
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestExecuteCommandDeadline() {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := s.client.ExecuteCommand(ctx, &api.ExecuteCommandRequest{Command: []string{"sleep", "10"}})
+	s.Equal(codes.DeadlineExceeded, status.Code(err))
+	s.Less(time.Since(start), 5*time.Second)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandErrors() {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		command    []string
+		workingDir string
+		user       string
+		env        map[string]string
+		envMode    api.EnvironmentMode
+		code       codes.Code
+	}{
+		{name: "empty", command: nil, code: codes.InvalidArgument},
+		{name: "not found", command: []string{"pyro-does-not-exist"}, code: codes.NotFound},
+		{name: "permission denied", command: []string{"/dev/null"}, code: codes.PermissionDenied},
+		{name: "working dir not found", command: []string{"true"}, workingDir: "/does/not/exist", code: codes.NotFound},
+		{name: "unknown user", command: []string{"true"}, user: "pyro-unknown-user", code: codes.InvalidArgument},
+		{
+			name: "environment with inherit mode", command: []string{"true"}, env: map[string]string{"A": "B"},
+			envMode: api.EnvironmentMode_ENVIRONMENT_MODE_INHERIT, code: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			req := &api.ExecuteCommandRequest{
+				Command: tt.command, WorkingDir: tt.workingDir, User: tt.user,
+				Environment: tt.env, EnvironmentMode: tt.envMode,
+			}
+			_, err := s.client.ExecuteCommand(ctx, req)
+			s.Require().Error(err)
+			s.Equal(tt.code, status.Code(err))
+		})
+	}
 }
 
 func (s *ServerTestSuite) TestExecuteCommandStream() {
@@ -61,37 +391,1034 @@ func (s *ServerTestSuite) TestExecuteCommandStream() {
 		},
 		Stdin: nil,
 	}
-	expectedResponse := &api.ExecuteCommandStreamResponse{
-		Stdout: &api.ExecuteIO{Close: true, Data: []byte("stdout")},
-		Stderr: &api.ExecuteIO{Close: true, Data: []byte("stderr")},
-		Result: &api.ExecuteResult{
-			Exited:   true,
-			ExitCode: 0,
+
+	stream, err := s.client.ExecuteCommandStream(ctx)
+	s.Require().NoError(err)
+
+	err = stream.Send(req)
+	s.Require().NoError(err)
+
+	stdout, stderr, result := s.collectStream(stream)
+	s.Equal("hello world\n", stdout)
+	s.Empty(stderr)
+	s.Require().NotNil(result)
+	s.True(result.Exited)
+	s.Equal(int32(0), result.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStreamForwardsStdin() {
+	ctx := context.Background()
+	stream, err := s.client.ExecuteCommandStream(ctx)
+	s.Require().NoError(err)
+
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{
+			Command: []string{"sh", "-c", "cat; echo done >&2; exit 4"},
 		},
+	}))
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{Stdin: &api.ExecuteIO{Data: []byte("hello ")}}))
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{Stdin: &api.ExecuteIO{Data: []byte("world")}}))
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{Stdin: &api.ExecuteIO{Close: true}}))
+
+	stdout, stderr, result := s.collectStream(stream)
+	s.Equal("hello world", stdout)
+	s.Equal("done\n", stderr)
+	s.Require().NotNil(result)
+	s.Equal(int32(4), result.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStreamOrdersOutput() {
+	for _, merge := range []bool{false, true} {
+		stream, err := s.client.ExecuteCommandStream(context.Background())
+		s.Require().NoError(err)
+		s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+			Prepare: &api.ExecuteCommandStreamRequest_Prepare{
+				Command:     []string{"sh", "-c", "echo out; sleep 0.1; echo err >&2; sleep 0.1; echo out"},
+				MergeOutput: merge,
+				Timestamps:  true,
+			},
+		}))
+		s.requireStarted(stream)
+		var output string
+		var sequence uint64
+		var stderrFrames int
+		for {
+			resp, err := stream.Recv()
+			s.Require().NoError(err)
+			if resp.Result != nil {
+				break
+			}
+			frame := resp.Stdout
+			if resp.Stderr != nil {
+				frame = resp.Stderr
+				stderrFrames++
+			}
+			s.Equal(sequence+1, frame.Sequence)
+			s.NotNil(frame.Timestamp)
+			sequence = frame.Sequence
+			output += string(frame.Data)
+		}
+		s.Equal("out\nerr\nout\n", output)
+		if merge {
+			s.Zero(stderrFrames)
+		} else {
+			s.NotZero(stderrFrames)
+		}
 	}
+}
 
+func (s *ServerTestSuite) TestExecuteCommandStreamRequiresPrepare() {
+	ctx := context.Background()
 	stream, err := s.client.ExecuteCommandStream(ctx)
 	s.Require().NoError(err)
 
-	err = stream.Send(req)
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{Stdin: &api.ExecuteIO{Data: []byte("hello")}}))
+	_, err = stream.Recv()
+	s.Require().Error(err)
+	s.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStreamTerminal() {
+	ctx := context.Background()
+	stream, err := s.client.ExecuteCommandStream(ctx)
+	s.Require().NoError(err)
+
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{
+			Command: []string{"sh", "-c", "test -t 0 && echo $TERM && stty size && read x && stty size"},
+			Terminal: &api.Terminal{
+				Term: "xterm-256color",
+				Size: &api.WindowSize{Rows: 24, Cols: 80},
+			},
+		},
+	}))
+	var stdout string
+	recvStdout := func() *api.ExecuteResult {
+		resp, err := stream.Recv()
+		s.Require().NoError(err)
+		s.Nil(resp.Stderr)
+		if resp.Stdout != nil {
+			stdout += string(resp.Stdout.Data)
+		}
+		return resp.Result
+	}
+	for !strings.HasSuffix(stdout, "24 80\r\n") {
+		s.Require().Nil(recvStdout())
+	}
+
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Resize: &api.WindowSize{Rows: 30, Cols: 100},
+	}))
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{Stdin: &api.ExecuteIO{Data: []byte("go\n")}}))
+
+	var result *api.ExecuteResult
+	for result == nil {
+		result = recvStdout()
+	}
+	s.Equal("xterm-256color\r\n24 80\r\ngo\r\n30 100\r\n", stdout)
+	s.Equal(int32(0), result.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStreamSignal() {
+	ctx := context.Background()
+	stream, err := s.client.ExecuteCommandStream(ctx)
 	s.Require().NoError(err)
 
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{
+			Command: []string{"sh", "-c", "trap 'echo interrupted; exit 7' INT; echo ready; while :; do sleep 0.1; done"},
+		},
+	}))
+	s.requireStarted(stream)
 	resp, err := stream.Recv()
 	s.Require().NoError(err)
+	s.Require().NotNil(resp.Stdout)
+	s.Equal("ready\n", string(resp.Stdout.Data))
 
-	s.Require().NotNil(resp)
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{Signal: api.Signal_SIGNAL_INT}))
+
+	stdout, _, result := s.collectStream(stream)
+	s.Equal("interrupted\n", stdout)
+	s.Equal(int32(7), result.ExitCode)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStreamConfirmsStart() {
+	stream, err := s.client.ExecuteCommandStream(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"echo", "hi"}},
+	}))
+	s.requireStarted(stream)
+	stdout, _, result := s.collectStream(stream)
+	s.Equal("hi\n", stdout)
+	s.Equal(int32(0), result.ExitCode)
+
+	stream, err = s.client.ExecuteCommandStream(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"/does/not/exist"}},
+	}))
+	_, err = stream.Recv()
+	s.Error(err)
+}
+
+func (s *ServerTestSuite) TestExecuteCommandStreamCancelKillsProcessGroup() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := s.client.ExecuteCommandStream(ctx)
+	s.Require().NoError(err)
+
+	s.Require().NoError(stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{
+			Command: []string{"sh", "-c", "sleep 100 & echo $!; wait"},
+		},
+	}))
+	s.requireStarted(stream)
+	resp, err := stream.Recv()
+	s.Require().NoError(err)
 	s.Require().NotNil(resp.Stdout)
-	s.Equal(expectedResponse.Stdout.Close, resp.Stdout.Close)
-	s.Equal(expectedResponse.Stdout.Data, resp.Stdout.Data)
-	s.Require().NotNil(resp.Stderr)
-	s.Equal(expectedResponse.Stderr.Close, resp.Stderr.Close)
-	s.Equal(expectedResponse.Stderr.Data, resp.Stderr.Data)
-	s.Require().NotNil(resp.Result)
-	s.Equal(expectedResponse.Result.Exited, resp.Result.Exited)
-	s.Equal(expectedResponse.Result.ExitCode, resp.Result.ExitCode)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(resp.Stdout.Data)))
+	s.Require().NoError(err)
+
+	cancel()
+	s.Eventually(func() bool {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *ServerTestSuite) TestGetInfo() {
+	info, err := s.client.GetInfo(context.Background(), &api.GetInfoRequest{})
+	s.Require().NoError(err)
+	s.Equal(APIVersion, info.ApiVersion)
+	s.Equal(runtime.GOOS, info.Os)
+	s.Equal(runtime.GOARCH, info.Arch)
+	s.Contains(info.Features, api.Feature_FEATURE_PTY)
+	s.NotEmpty(info.Version)
+	if runtime.GOOS == "linux" {
+		s.NotEmpty(info.Kernel)
+		s.Require().NotNil(info.BootTime)
+		s.True(info.BootTime.AsTime().Before(time.Now()))
+	}
+}
+
+func (s *ServerTestSuite) writeFile(
+	meta *api.FileMetadata, chunks [][]byte, checksum []byte,
+) (*api.WriteFileResponse, error) {
+	stream, err := s.client.WriteFile(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.WriteFileRequest{Metadata: meta}))
+	for _, chunk := range chunks {
+		if err := stream.Send(&api.WriteFileRequest{Data: chunk}); err != nil {
+			break
+		}
+	}
+	if checksum != nil {
+		_ = stream.Send(&api.WriteFileRequest{Sha256: checksum})
+	}
+	return stream.CloseAndRecv()
+}
+
+func (s *ServerTestSuite) TestWriteAndReadFile() {
+	path := filepath.Join(s.T().TempDir(), "file")
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	sum := sha256.Sum256(content)
+	mode := uint32(0o640)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	resp, err := s.writeFile(&api.FileMetadata{Path: path, Mode: &mode, Mtime: timestamppb.New(mtime)},
+		[][]byte{content[:30000], content[30000:]}, sum[:])
+	s.Require().NoError(err)
+	s.Equal(int64(len(content)), resp.Size)
+	s.Equal(sum[:], resp.Sha256)
+
+	stream, err := s.client.ReadFile(context.Background(), &api.ReadFileRequest{Path: path})
+	s.Require().NoError(err)
+	first, err := stream.Recv()
+	s.Require().NoError(err)
+	s.Require().NotNil(first.Metadata)
+	s.Equal(mode, first.Metadata.GetMode())
+	s.Equal(int64(len(content)), first.Metadata.Size)
+	s.True(mtime.Equal(first.Metadata.Mtime.AsTime()))
+	s.Equal(uint32(os.Getuid()), first.Metadata.GetUid())
+
+	var received []byte
+	var checksum []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		s.Require().NoError(err)
+		s.LessOrEqual(len(resp.Data), fileChunkSize)
+		received = append(received, resp.Data...)
+		if resp.Sha256 != nil {
+			checksum = resp.Sha256
+		}
+	}
+	s.Equal(content, received)
+	s.Equal(sum[:], checksum)
+}
+
+func (s *ServerTestSuite) TestWriteFileKeepsModeOfReplacedFile() {
+	path := filepath.Join(s.T().TempDir(), "script")
+	s.Require().NoError(os.WriteFile(path, []byte("old"), 0o755))
+
+	_, err := s.writeFile(&api.FileMetadata{Path: path}, [][]byte{[]byte("new")}, nil)
+	s.Require().NoError(err)
+	info, err := os.Stat(path)
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0o755), info.Mode().Perm())
+}
+
+func (s *ServerTestSuite) TestWriteFileChecksumMismatch() {
+	dir := s.T().TempDir()
+	path := filepath.Join(dir, "file")
+	s.Require().NoError(os.WriteFile(path, []byte("old"), 0o644))
+
+	_, err := s.writeFile(&api.FileMetadata{Path: path}, [][]byte{[]byte("new")}, []byte("wrong"))
+	s.Equal(codes.DataLoss, status.Code(err))
+
+	// Neither the file is replaced nor the temporary one is left behind.
+	content, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Equal("old", string(content))
+	entries, err := os.ReadDir(dir)
+	s.Require().NoError(err)
+	s.Len(entries, 1)
+}
+
+func (s *ServerTestSuite) TestFileErrors() {
+	dir := s.T().TempDir()
+	tests := []struct {
+		name string
+		path string
+		code codes.Code
+	}{
+		{name: "relative", path: "file", code: codes.InvalidArgument},
+		{name: "directory", path: dir, code: codes.InvalidArgument},
+		{name: "missing", path: filepath.Join(dir, "missing", "file"), code: codes.NotFound},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			_, err := s.writeFile(&api.FileMetadata{Path: tt.path}, nil, nil)
+			s.Equal(tt.code, status.Code(err), "write")
+
+			stream, err := s.client.ReadFile(context.Background(), &api.ReadFileRequest{Path: tt.path})
+			s.Require().NoError(err)
+			_, err = stream.Recv()
+			s.Equal(tt.code, status.Code(err), "read")
+		})
+	}
+
+	stream, err := s.client.WriteFile(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.WriteFileRequest{Data: []byte("data")}))
+	_, err = stream.CloseAndRecv()
+	s.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (s *ServerTestSuite) pushDir(opts *api.PushDirOptions, data []byte) (*api.PushDirResponse, error) {
+	stream, err := s.client.PushDir(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.PushDirRequest{Options: opts}))
+	for len(data) > 0 {
+		n := len(data)
+		if n > 1000 {
+			n = 1000
+		}
+		if err := stream.Send(&api.PushDirRequest{Data: data[:n]}); err != nil {
+			break
+		}
+		data = data[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func (s *ServerTestSuite) TestPushAndPullDir() {
+	src := s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(src, "sub"), 0o755))
+	s.Require().NoError(os.WriteFile(filepath.Join(src, "sub", "file"), bytes.Repeat([]byte("x"), 100000), 0o640))
+	s.Require().NoError(os.Symlink("sub/file", filepath.Join(src, "link")))
+	var buf bytes.Buffer
+	s.Require().NoError(archive.Create(&buf, src, archive.Gzip))
+
+	dst := filepath.Join(s.T().TempDir(), "dst")
+	resp, err := s.pushDir(&api.PushDirOptions{Path: dst, Compression: api.Compression_COMPRESSION_GZIP}, buf.Bytes())
+	s.Require().NoError(err)
+	s.Equal(int64(3), resp.Entries)
+	s.Equal(int64(100000), resp.Bytes)
+	info, err := os.Stat(filepath.Join(dst, "link"))
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0o640), info.Mode().Perm())
+
+	stream, err := s.client.PullDir(context.Background(), &api.PullDirRequest{Path: dst})
+	s.Require().NoError(err)
+	var pulled bytes.Buffer
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		s.Require().NoError(err)
+		s.LessOrEqual(len(resp.Data), fileChunkSize)
+		pulled.Write(resp.Data)
+	}
+	local := s.T().TempDir()
+	_, err = archive.Extract(&pulled, local, archive.ExtractOptions{})
+	s.Require().NoError(err)
+	target, err := os.Readlink(filepath.Join(local, "link"))
+	s.Require().NoError(err)
+	s.Equal("sub/file", target)
+	content, err := os.ReadFile(filepath.Join(local, "sub", "file"))
+	s.Require().NoError(err)
+	s.Len(content, 100000)
+}
+
+func (s *ServerTestSuite) TestPushDirRejectsUnsafeArchive() {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{name: "parent", headers: []*tar.Header{{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0o644}}},
+		{name: "chained symlinks", headers: []*tar.Header{
+			{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "a/b/l/../../.."},
+		}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, header := range tt.headers {
+				s.Require().NoError(tw.WriteHeader(header))
+			}
+			s.Require().NoError(tw.Close())
+			parent := s.T().TempDir()
+
+			_, err := s.pushDir(&api.PushDirOptions{Path: filepath.Join(parent, "dst")}, buf.Bytes())
+			s.Equal(codes.InvalidArgument, status.Code(err))
+			s.NoFileExists(filepath.Join(parent, "escaped"))
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestDirErrors() {
+	dir := s.T().TempDir()
+	file := filepath.Join(dir, "file")
+	s.Require().NoError(os.WriteFile(file, nil, 0o644))
+
+	_, err := s.pushDir(&api.PushDirOptions{Path: "dir"}, nil)
+	s.Equal(codes.InvalidArgument, status.Code(err), "relative push")
+	_, err = s.pushDir(&api.PushDirOptions{Path: dir, Compression: api.Compression_COMPRESSION_GZIP}, []byte("no gzip"))
+	s.Equal(codes.Internal, status.Code(err), "corrupt push")
+
+	tests := []struct {
+		name string
+		path string
+		code codes.Code
+	}{
+		{name: "relative", path: "dir", code: codes.InvalidArgument},
+		{name: "file", path: file, code: codes.InvalidArgument},
+		{name: "missing", path: filepath.Join(dir, "missing"), code: codes.NotFound},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			stream, err := s.client.PullDir(context.Background(), &api.PullDirRequest{Path: tt.path})
+			s.Require().NoError(err)
+			_, err = stream.Recv()
+			s.Equal(tt.code, status.Code(err))
+		})
+	}
+}
+
+func (s *ServerTestSuite) TestStat() {
+	ctx := context.Background()
+	dir := s.T().TempDir()
+	file := filepath.Join(dir, "file")
+	s.Require().NoError(os.WriteFile(file, []byte("content"), 0o640))
+	s.Require().NoError(os.Chmod(file, 0o640|os.ModeSetgid))
+	link := filepath.Join(dir, "link")
+	s.Require().NoError(os.Symlink("file", link))
+
+	resp, err := s.client.Stat(ctx, &api.StatRequest{Path: link})
+	s.Require().NoError(err)
+	s.Equal("link", resp.Stat.Name)
+	s.Equal(api.FileType_FILE_TYPE_SYMLINK, resp.Stat.Type)
+	s.Equal("file", resp.Stat.SymlinkTarget)
+
+	resp, err = s.client.Stat(ctx, &api.StatRequest{Path: link, FollowSymlinks: true})
+	s.Require().NoError(err)
+	s.Equal(api.FileType_FILE_TYPE_REGULAR, resp.Stat.Type)
+	s.Equal(uint32(0o2640), resp.Stat.Mode)
+	s.Equal(int64(len("content")), resp.Stat.Size)
+	s.Equal(uint32(os.Getuid()), resp.Stat.Uid)
+
+	_, err = s.client.Stat(ctx, &api.StatRequest{Path: filepath.Join(dir, "missing")})
+	s.Equal(codes.NotFound, status.Code(err))
+	_, err = s.client.Stat(ctx, &api.StatRequest{Path: "file"})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (s *ServerTestSuite) TestReadDirPagination() {
+	ctx := context.Background()
+	dir := s.T().TempDir()
+	var expected []string
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("file%02d", i)
+		expected = append(expected, name)
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	var names []string
+	var token string
+	pages := 0
+	for {
+		resp, err := s.client.ReadDir(ctx, &api.ReadDirRequest{Path: dir, PageSize: 10, PageToken: token})
+		s.Require().NoError(err)
+		pages++
+		s.LessOrEqual(len(resp.Entries), 10)
+		for _, entry := range resp.Entries {
+			names = append(names, entry.Name)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		token = resp.NextPageToken
+	}
+	s.Equal(3, pages)
+	s.Equal(expected, names)
+
+	_, err := s.client.ReadDir(ctx, &api.ReadDirRequest{Path: filepath.Join(dir, "file00")})
+	s.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = s.client.ReadDir(ctx, &api.ReadDirRequest{Path: filepath.Join(dir, "missing")})
+	s.Equal(codes.NotFound, status.Code(err))
+}
+
+func TestReadDirPage(t *testing.T) {
+	dir := t.TempDir()
+	// Spans multiple batches read from the directory.
+	var expected []string
+	for i := 0; i < 2*readDirBatchSize+100; i++ {
+		name := fmt.Sprintf("file%04d", i)
+		expected = append(expected, name)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	pageSize := len(expected) / 3
+
+	var names []string
+	after := ""
+	for page := 0; page < 3; page++ {
+		f, err := os.Open(dir)
+		require.NoError(t, err)
+		pageNames, more, err := readDirPage(f, after, pageSize)
+		require.NoError(t, f.Close())
+		require.NoError(t, err)
+		require.Len(t, pageNames, pageSize)
+		require.Equal(t, page < 2, more)
+		names = append(names, pageNames...)
+		after = pageNames[len(pageNames)-1]
+	}
+	require.Equal(t, expected, names)
+}
+
+func (s *ServerTestSuite) TestModifyFilesystem() {
+	ctx := context.Background()
+	dir := s.T().TempDir()
+	nested := filepath.Join(dir, "a", "b")
+	mode := uint32(0o700)
+
+	_, err := s.client.Mkdir(ctx, &api.MkdirRequest{Path: nested})
+	s.Equal(codes.NotFound, status.Code(err), "mkdir without parents")
+	_, err = s.client.Mkdir(ctx, &api.MkdirRequest{Path: nested, Parents: true, Mode: &mode})
+	s.Require().NoError(err)
+	info, err := os.Stat(nested)
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0o700), info.Mode().Perm())
+	_, err = s.client.Mkdir(ctx, &api.MkdirRequest{Path: nested, Parents: true})
+	s.NoError(err, "mkdir -p of existing directory")
+	_, err = s.client.Mkdir(ctx, &api.MkdirRequest{Path: nested})
+	s.Equal(codes.AlreadyExists, status.Code(err), "mkdir of existing directory")
+
+	_, err = s.client.Chmod(ctx, &api.ChmodRequest{Path: nested, Mode: 0o1755})
+	s.Require().NoError(err)
+	info, err = os.Stat(nested)
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0o755)|os.ModeSticky, info.Mode()&^os.ModeDir)
+	_, err = s.client.Chmod(ctx, &api.ChmodRequest{Path: nested, Mode: 0o10000})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+
+	uid := uint32(os.Getuid())
+	_, err = s.client.Chown(ctx, &api.ChownRequest{Path: nested, Uid: &uid})
+	s.NoError(err)
+
+	renamed := filepath.Join(dir, "c")
+	_, err = s.client.Rename(ctx, &api.RenameRequest{OldPath: filepath.Join(dir, "a"), NewPath: renamed})
+	s.Require().NoError(err)
+	s.DirExists(filepath.Join(renamed, "b"))
+	_, err = s.client.Rename(ctx, &api.RenameRequest{OldPath: filepath.Join(dir, "a"), NewPath: renamed})
+	s.Equal(codes.NotFound, status.Code(err))
+
+	_, err = s.client.Remove(ctx, &api.RemoveRequest{Path: renamed})
+	s.Equal(codes.FailedPrecondition, status.Code(err), "remove of non-empty directory")
+	_, err = s.client.Remove(ctx, &api.RemoveRequest{Path: renamed, Recursive: true})
+	s.Require().NoError(err)
+	s.NoDirExists(renamed)
+	_, err = s.client.Remove(ctx, &api.RemoveRequest{Path: renamed, Recursive: true})
+	s.Equal(codes.NotFound, status.Code(err))
+	_, err = s.client.Remove(ctx, &api.RemoveRequest{Path: "/", Recursive: true})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (s *ServerTestSuite) TestGetManifest() {
+	dir := s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(dir, "sub"), 0o750))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "sub", "file"), []byte("content"), 0o640))
+	s.Require().NoError(os.Symlink("sub/file", filepath.Join(dir, "link")))
+
+	stream, err := s.client.GetManifest(context.Background(), &api.GetManifestRequest{Path: dir, Checksums: true})
+	s.Require().NoError(err)
+	var entries []*api.ManifestEntry
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		s.Require().NoError(err)
+		entries = append(entries, resp.Entries...)
+	}
+	s.Require().Len(entries, 3)
+	s.Equal("link", entries[0].Path)
+	s.Equal(api.FileType_FILE_TYPE_SYMLINK, entries[0].Type)
+	s.Equal("sub/file", entries[0].SymlinkTarget)
+	s.Equal("sub", entries[1].Path)
+	s.Equal(uint32(0o750), entries[1].Mode)
+	s.Equal("sub/file", entries[2].Path)
+	s.Equal(int64(len("content")), entries[2].Size)
+	sum := sha256.Sum256([]byte("content"))
+	s.Equal(sum[:], entries[2].Sha256)
+
+	stream, err = s.client.GetManifest(context.Background(), &api.GetManifestRequest{Path: filepath.Join(dir, "missing")})
+	s.Require().NoError(err)
+	_, err = stream.Recv()
+	s.Equal(codes.NotFound, status.Code(err))
+}
+
+func (s *ServerTestSuite) startProcess(name string, command ...string) *api.ProcessInfo {
+	resp, err := s.client.StartProcess(context.Background(), &api.StartProcessRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: command},
+		Name:    name,
+	})
+	s.Require().NoError(err)
+	return resp.Process
+}
+
+func (s *ServerTestSuite) TestStartAndWaitProcess() {
+	ctx := context.Background()
+	started := s.startProcess("exit", "sh", "-c", "echo ignored; exit 3")
+	s.Len(started.Id, 2*processIDLength)
+	s.Equal("exit", started.Name)
+	s.Positive(started.Pid)
+
+	resp, err := s.client.WaitProcess(ctx, &api.WaitProcessRequest{Id: "exit"})
+	s.Require().NoError(err)
+	s.Equal(started.Id, resp.Process.Id)
+	s.Equal(api.ProcessState_PROCESS_STATE_EXITED, resp.Process.State)
+	s.Require().NotNil(resp.Process.Result)
+	s.Equal(int32(3), resp.Process.Result.ExitCode)
+
+	_, err = s.client.StartProcess(ctx, &api.StartProcessRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"true"}},
+		Name:    "exit",
+	})
+	s.Equal(codes.AlreadyExists, status.Code(err))
+	_, err = s.client.StartProcess(ctx, &api.StartProcessRequest{})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+	_, err = s.client.WaitProcess(ctx, &api.WaitProcessRequest{Id: "missing"})
+	s.Equal(codes.NotFound, status.Code(err))
+}
+
+func (s *ServerTestSuite) TestListAndKillProcesses() {
+	ctx := context.Background()
+	exited := s.startProcess("", "true")
+	_, err := s.client.WaitProcess(ctx, &api.WaitProcessRequest{Id: exited.Id})
+	s.Require().NoError(err)
+	running := s.startProcess("sleep", "sleep", "10")
+
+	resp, err := s.client.ListProcesses(ctx, &api.ListProcessesRequest{})
+	s.Require().NoError(err)
+	s.Require().Len(resp.Processes, 2)
+	s.Equal(exited.Id, resp.Processes[0].Id)
+	s.Equal(running.Id, resp.Processes[1].Id)
+	resp, err = s.client.ListProcesses(ctx, &api.ListProcessesRequest{State: api.ProcessState_PROCESS_STATE_RUNNING})
+	s.Require().NoError(err)
+	s.Require().Len(resp.Processes, 1)
+	s.Equal([]string{"sleep", "10"}, resp.Processes[0].Command)
+
+	_, err = s.client.KillProcess(ctx, &api.KillProcessRequest{Id: exited.Id})
+	s.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = s.client.KillProcess(ctx, &api.KillProcessRequest{Id: "sleep"})
+	s.Require().NoError(err)
+	waited, err := s.client.WaitProcess(ctx, &api.WaitProcessRequest{Id: running.Id})
+	s.Require().NoError(err)
+	s.Equal(api.Signal_SIGNAL_TERM, waited.Process.Result.Signal)
+}
+
+// attach attaches to the process and collects its output until the stream ends.
+func (s *ServerTestSuite) attach(
+	opts *api.AttachProcessRequest_Options, input ...*api.ExecuteIO,
+) (stdout, stderr string, last *api.ProcessInfo) {
+	stream, err := s.client.AttachProcess(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.AttachProcessRequest{Options: opts}))
+	for _, in := range input {
+		s.Require().NoError(stream.Send(&api.AttachProcessRequest{Stdin: in}))
+	}
+	s.Require().NoError(stream.CloseSend())
+	var out, errOut []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return string(out), string(errOut), last
+		}
+		s.Require().NoError(err)
+		out = append(out, resp.GetStdout().GetData()...)
+		errOut = append(errOut, resp.GetStderr().GetData()...)
+		if resp.Process != nil {
+			last = resp.Process
+		}
+	}
+}
+
+func (s *ServerTestSuite) TestAttachProcessReplaysOutput() {
+	p := s.startProcess("", "sh", "-c", "echo out; echo err >&2; exit 2")
+	_, err := s.client.WaitProcess(context.Background(), &api.WaitProcessRequest{Id: p.Id})
+	s.Require().NoError(err)
+
+	start := uint64(0)
+	stdout, stderr, last := s.attach(&api.AttachProcessRequest_Options{Id: p.Id, Offset: &start})
+	s.Equal("out\n", stdout)
+	s.Equal("err\n", stderr)
+	s.Require().NotNil(last.Result)
+	s.Equal(int32(2), last.Result.ExitCode)
+
+	// The order of stdout and stderr is not deterministic, but both end with a newline.
+	offset := uint64(len("out\n") + len("err\n") - 1)
+	stdout, stderr, _ = s.attach(&api.AttachProcessRequest_Options{Id: p.Id, Offset: &offset, Follow: true})
+	s.Equal("\n", stdout+stderr)
+
+	stdout, stderr, _ = s.attach(&api.AttachProcessRequest_Options{Id: p.Id})
+	s.Empty(stdout + stderr)
+}
+
+func (s *ServerTestSuite) TestAttachProcessForwardsStdin() {
+	resp, err := s.client.StartProcess(context.Background(), &api.StartProcessRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"cat"}},
+		Stdin:   true,
+	})
+	s.Require().NoError(err)
+	s.True(resp.Process.Stdin)
+	stdout, _, last := s.attach(
+		&api.AttachProcessRequest_Options{Id: resp.Process.Id, Follow: true},
+		&api.ExecuteIO{Data: []byte("hello")}, &api.ExecuteIO{Close: true},
+	)
+	s.Equal("hello", stdout)
+	s.Equal(api.ProcessState_PROCESS_STATE_EXITED, last.State)
+
+	p := s.startProcess("", "sleep", "10")
+	stream, err := s.client.AttachProcess(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&api.AttachProcessRequest{
+		Options: &api.AttachProcessRequest_Options{Id: p.Id, Follow: true},
+		Stdin:   &api.ExecuteIO{Data: []byte("ignored")},
+	}))
+	_, err = stream.Recv()
+	s.Require().NoError(err)
+	_, err = stream.Recv()
+	s.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = s.client.KillProcess(context.Background(), &api.KillProcessRequest{Id: p.Id, Signal: api.Signal_SIGNAL_KILL})
+	s.Require().NoError(err)
+}
+
+func TestAttachProcessReportsReplayStart(t *testing.T) {
+	client, teardown := newTestServer(t, WithProcessOutputBufferSize(4))
+	defer teardown()
+	ctx := context.Background()
+	started, err := client.StartProcess(ctx, &api.StartProcessRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"printf", "0123456789"}},
+	})
+	require.NoError(t, err)
+	_, err = client.WaitProcess(ctx, &api.WaitProcessRequest{Id: started.Process.Id})
+	require.NoError(t, err)
+
+	for requested, expected := range map[uint64]uint64{0: 6, 8: 8, 20: 10} {
+		stream, err := client.AttachProcess(ctx)
+		require.NoError(t, err)
+		offset := requested
+		require.NoError(t, stream.Send(&api.AttachProcessRequest{
+			Options: &api.AttachProcessRequest_Options{Id: started.Process.Id, Offset: &offset},
+		}))
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, expected, resp.Offset, "requested offset %d", requested)
+		if expected < 10 {
+			resp, err = stream.Recv()
+			require.NoError(t, err)
+			require.Equal(t, expected, resp.Offset)
+			require.Equal(t, "0123456789"[expected:], string(resp.GetStdout().GetData()))
+		}
+	}
+}
+
+// sessionOutcome collects the frames received for a session.
+type sessionOutcome struct {
+	started *api.SessionStarted
+	stdout  []byte
+	stderr  []byte
+	result  *api.ExecuteResult
+	err     *api.SessionError
+}
+
+// receiveSessions receives frames until the given number of sessions ended.
+func (s *ServerTestSuite) receiveSessions(
+	stream api.AgentService_ExecuteSessionsClient, sessions int,
+) map[uint32]*sessionOutcome {
+	outcomes := make(map[uint32]*sessionOutcome)
+	for ended := 0; ended < sessions; {
+		resp, err := stream.Recv()
+		s.Require().NoError(err)
+		o := outcomes[resp.SessionId]
+		if o == nil {
+			o = &sessionOutcome{}
+			outcomes[resp.SessionId] = o
+		}
+		if resp.Started != nil {
+			o.started = resp.Started
+		}
+		if len(resp.GetStdout().GetData())+len(resp.GetStderr().GetData()) != 0 {
+			s.Require().NotNil(o.started, "output preceded start of session %d", resp.SessionId)
+		}
+		o.stdout = append(o.stdout, resp.GetStdout().GetData()...)
+		o.stderr = append(o.stderr, resp.GetStderr().GetData()...)
+		if resp.Result != nil || resp.Error != nil {
+			o.result, o.err = resp.Result, resp.Error
+			ended++
+		}
+	}
+	return outcomes
+}
+
+func (s *ServerTestSuite) TestExecuteSessions() {
+	stream, err := s.client.ExecuteSessions(context.Background())
+	s.Require().NoError(err)
+	starts := map[uint32][]string{
+		1: {"sh", "-c", "echo one; echo err >&2; exit 1"},
+		2: {"cat"},
+		3: {"pyro-does-not-exist"},
+	}
+	for id, command := range starts {
+		s.Require().NoError(stream.Send(&api.SessionRequest{
+			SessionId: id, Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: command},
+		}))
+	}
+	s.Require().NoError(stream.Send(&api.SessionRequest{SessionId: 2, Stdin: &api.ExecuteIO{Data: []byte("two")}}))
+	s.Require().NoError(stream.Send(&api.SessionRequest{SessionId: 2, Stdin: &api.ExecuteIO{Close: true}}))
+
+	outcomes := s.receiveSessions(stream, len(starts))
+	s.Equal("one\n", string(outcomes[1].stdout))
+	s.Equal("err\n", string(outcomes[1].stderr))
+	s.Equal(int32(1), outcomes[1].result.ExitCode)
+	s.Equal("two", string(outcomes[2].stdout))
+	s.Equal(int32(0), outcomes[2].result.ExitCode)
+	s.Require().NotNil(outcomes[3].err)
+	s.Equal(int32(codes.NotFound), outcomes[3].err.Code)
+	s.Require().NoError(stream.CloseSend())
+	_, err = stream.Recv()
+	s.Equal(io.EOF, err)
+}
+
+func (s *ServerTestSuite) TestExecuteSessionsFlowControl() {
+	stream, err := s.client.ExecuteSessions(context.Background())
+	s.Require().NoError(err)
+	// The first session may only send a single byte, which must not hold up the second session.
+	s.Require().NoError(stream.Send(&api.SessionRequest{
+		SessionId: 1, WindowUpdate: 1,
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"printf", "0123456789"}},
+	}))
+	s.Require().NoError(stream.Send(&api.SessionRequest{
+		SessionId: 2, Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"echo", "unblocked"}},
+	}))
+	var first, second []byte
+	for {
+		resp, err := stream.Recv()
+		s.Require().NoError(err)
+		if resp.SessionId == 1 {
+			first = append(first, resp.GetStdout().GetData()...)
+			continue
+		}
+		second = append(second, resp.GetStdout().GetData()...)
+		if resp.Result != nil {
+			break
+		}
+	}
+	s.Equal("unblocked\n", string(second))
+	s.LessOrEqual(len(first), 1)
+
+	s.Require().NoError(stream.Send(&api.SessionRequest{SessionId: 1, WindowUpdate: 9}))
+	for {
+		resp, err := stream.Recv()
+		s.Require().NoError(err)
+		first = append(first, resp.GetStdout().GetData()...)
+		if resp.Result != nil {
+			break
+		}
+	}
+	s.Equal("0123456789", string(first))
+
+	// Exceeding the stdin window fails the stream.
+	s.Require().NoError(stream.Send(&api.SessionRequest{
+		SessionId: 3, Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"sleep", "10"}},
+	}))
+	resp, err := stream.Recv()
+	s.Require().NoError(err)
+	s.Require().NotNil(resp.Started)
+	s.Require().NoError(stream.Send(&api.SessionRequest{
+		SessionId: 3, Stdin: &api.ExecuteIO{Data: make([]byte, defaultSessionWindow+1)},
+	}))
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+}
+
+func TestNewServerValidatesMaxOutputSize(t *testing.T) {
+	for _, size := range []int{-1, 0, MaxOutputSizeLimit + 1} {
+		_, err := NewServer(WithMaxOutputSize(size))
+		require.Error(t, err, "size %d", size)
+	}
+	_, err := NewServer(WithMaxOutputSize(MaxOutputSizeLimit))
+	require.NoError(t, err)
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	serverFiles, clientFiles, err := certs.Generate(t.TempDir(), certs.GenerateOptions{})
+	require.NoError(t, err)
+	serverConfig, err := certs.ServerConfig(serverFiles)
+	require.NoError(t, err)
+	clientConfig, err := certs.ClientConfig(clientFiles, "localhost")
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := NewGRPCServer(WithTLSConfig(serverConfig))
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, server.Serve(l))
+	}()
+	defer server.Stop()
+
+	execute := func(creds grpc.DialOption) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		cc, err := grpc.DialContext(ctx, l.Addr().String(), creds)
+		require.NoError(t, err)
+		defer cc.Close()
+		_, err = api.NewAgentServiceClient(cc).ExecuteCommand(ctx, &api.ExecuteCommandRequest{Command: []string{"true"}})
+		return err
+	}
+
+	require.NoError(t, execute(grpc.WithTransportCredentials(credentials.NewTLS(clientConfig))))
+
+	withoutCert := clientConfig.Clone()
+	withoutCert.Certificates = nil
+	require.Error(t, execute(grpc.WithTransportCredentials(credentials.NewTLS(withoutCert))))
+	require.Error(t, execute(grpc.WithInsecure()))
+}
+
+func TestServerHealth(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	// The health service must be reachable without credentials.
+	server, err := NewGRPCServer(WithAuthentication(auth.StaticTokens{}, nil))
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, server.Serve(l))
+	}()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc.Close()
+	health := healthpb.NewHealthClient(cc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, service := range []string{"", api.AgentService_ServiceDesc.ServiceName} {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	}
+
+	watch, err := health.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	resp, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	// The pending watch delays stopping until the server closes it.
+	go server.GracefulStop()
+	resp, err = watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+func TestServerReflection(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var opts []Option
+		if enabled {
+			opts = append(opts, WithReflection())
+		}
+		server, err := NewGRPCServer(opts...)
+		require.NoError(t, err)
+		_, registered := server.GetServiceInfo()[reflectionpb.ServerReflection_ServiceDesc.ServiceName]
+		require.Equal(t, enabled, registered)
+	}
+}
+
+// requireStarted receives the first response of the stream, which confirms that the command started.
+func (s *ServerTestSuite) requireStarted(stream api.AgentService_ExecuteCommandStreamClient) {
+	resp, err := stream.Recv()
+	s.Require().NoError(err)
+	s.Require().True(resp.Started)
+	s.Nil(resp.Stdout)
+	s.Nil(resp.Stderr)
+	s.Nil(resp.Result)
+}
+
+// collectStream receives from the stream until a result arrives and returns the collected output.
+func (s *ServerTestSuite) collectStream(
+	stream api.AgentService_ExecuteCommandStreamClient,
+) (stdout, stderr string, result *api.ExecuteResult) {
+	var stdoutClosed, stderrClosed bool
+	for result == nil {
+		resp, err := stream.Recv()
+		s.Require().NoError(err)
+		if resp.Stdout != nil {
+			stdout += string(resp.Stdout.Data)
+			stdoutClosed = stdoutClosed || resp.Stdout.Close
+		}
+		if resp.Stderr != nil {
+			stderr += string(resp.Stderr.Data)
+			stderrClosed = stderrClosed || resp.Stderr.Close
+		}
+		result = resp.Result
+	}
+	s.True(stdoutClosed)
+	s.True(stderrClosed)
+	return stdout, stderr, result
 }
 
-func newTestServer(t *testing.T) (client api.AgentServiceClient, teardown func()) {
+func newTestServer(t *testing.T, opts ...Option) (client api.AgentServiceClient, teardown func()) {
 	t.Helper()
 
 	l, err := net.Listen("tcp", "127.0.0.1:0")
@@ -101,7 +1428,7 @@ func newTestServer(t *testing.T) (client api.AgentServiceClient, teardown func()
 	cc, err := grpc.Dial(l.Addr().String(), clientOptions...)
 	require.NoError(t, err)
 
-	server, err := NewGRPCServer()
+	server, err := NewGRPCServer(opts...)
 	require.NoError(t, err)
 
 	go func() {
@@ -111,9 +1438,9 @@ func newTestServer(t *testing.T) (client api.AgentServiceClient, teardown func()
 	client = api.NewAgentServiceClient(cc)
 
 	teardown = func() {
+		// stopping the server closes the listener as well
 		server.Stop()
 		require.NoError(t, cc.Close())
-		require.NoError(t, l.Close())
 	}
 
 	return client, teardown
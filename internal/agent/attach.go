@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+)
+
+func (s *server) AttachProcess(stream api.AgentService_AttachProcessServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed receiving attach process request: %w", err)
+	}
+	opts := req.Options
+	if opts == nil {
+		return status.Error(codes.InvalidArgument, "first request must contain options")
+	}
+	s.logger.WithField("attachProcessOptions", opts).Debug("Got attach process request")
+	p, err := s.processes.lookup(opts.Id, identityFromContext(stream.Context()))
+	if err != nil {
+		return err
+	}
+	offset := p.output.offset()
+	if opts.Offset != nil {
+		offset = p.output.start(*opts.Offset)
+	}
+	if err := stream.Send(&api.AttachProcessResponse{Process: p.info(), Offset: offset}); err != nil {
+		return fmt.Errorf("failed sending attach process response: %w", err)
+	}
+	inputErr := make(chan error, 1)
+	go func() { inputErr <- s.forwardProcessInput(stream, p, req.Stdin) }()
+
+	ctx := stream.Context()
+	for {
+		chunks, next, closed, changed := p.output.read(offset)
+		for _, chunk := range chunks {
+			if err := stream.Send(attachResponse(chunk)); err != nil {
+				return fmt.Errorf("failed sending attach process response: %w", err)
+			}
+		}
+		offset = next
+		if closed || !opts.Follow {
+			break
+		}
+		select {
+		case <-changed:
+		case err := <-inputErr:
+			if err != nil {
+				return err
+			}
+			inputErr = nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if !opts.Follow && !p.exited() {
+		return nil
+	}
+	// The output is closed shortly before the process exited.
+	select {
+	case <-p.done:
+	case err := <-inputErr:
+		if err != nil {
+			return err
+		}
+		<-p.done
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if err := stream.Send(&api.AttachProcessResponse{Process: p.info()}); err != nil {
+		return fmt.Errorf("failed sending attach process response: %w", err)
+	}
+	return nil
+}
+
+func attachResponse(chunk outputChunk) *api.AttachProcessResponse {
+	output := &api.ExecuteIO{Data: chunk.data}
+	if chunk.stderr {
+		return &api.AttachProcessResponse{Stderr: output, Offset: chunk.offset}
+	}
+	return &api.AttachProcessResponse{Stdout: output, Offset: chunk.offset}
+}
+
+// forwardProcessInput writes the input received from the stream, starting with the first request's, to
+// the process' stdin until the stream ends. The stdin is only closed if a frame with Close set is received,
+// as other clients may attach later on.
+func (s *server) forwardProcessInput(
+	stream api.AgentService_AttachProcessServer, p *managedProcess, input *api.ExecuteIO,
+) error {
+	for {
+		if input != nil {
+			if !p.stdin {
+				return status.Errorf(codes.FailedPrecondition, "process %s was started without stdin", p.id)
+			}
+			p.stdinMu.Lock()
+			if len(input.Data) != 0 {
+				if _, err := p.proc.stdin.Write(input.Data); err != nil {
+					s.logger.WithError(err).WithField("process", p.id).Debug("Error writing input to process")
+				}
+			}
+			if input.Close {
+				_ = p.proc.stdin.Close()
+			}
+			p.stdinMu.Unlock()
+		}
+		req, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.WithError(err).Debug("Stopped receiving input")
+			}
+			return nil
+		}
+		if req.Options != nil {
+			return status.Error(codes.InvalidArgument, "only the first request may contain options")
+		}
+		input = req.Stdin
+	}
+}
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "Bearer "
+	getInfoRPC          = "GetInfo"
+)
+
+// authorizer authenticates the bearer token of each call and authorizes it according to the policy.
+type authorizer struct {
+	authenticator auth.Authenticator
+	policy        *Policy
+}
+
+// identityKey is the context key of the identity a call was authenticated as.
+type identityKey struct{}
+
+// identityFromContext returns the identity the call was authenticated as, which is empty without authentication.
+func identityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
+
+// preparedRequest is implemented by streaming requests, whose first message prepares executing a command.
+type preparedRequest interface {
+	GetPrepare() *api.ExecuteCommandStreamRequest_Prepare
+}
+
+func (a *authorizer) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if isHealthCheck(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	identity, rule, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeMessage(rule, req); err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, identityKey{}, identity), req)
+}
+
+func (a *authorizer) streamInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if isHealthCheck(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	identity, rule, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	ctx := context.WithValue(ss.Context(), identityKey{}, identity)
+	stream := &authorizedStream{ServerStream: ss, ctx: ctx, rule: rule}
+	err = handler(srv, stream)
+	// Handlers may wrap the error returned when receiving, so return the denial as is.
+	if denied := stream.denied(); denied != nil {
+		return denied
+	}
+	return err
+}
+
+// isHealthCheck returns whether the method belongs to the health service, which does not require
+// authentication, so that orchestrators can check whether the agent is ready without credentials.
+func isHealthCheck(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// authorize authenticates the call and returns the identity and the policy rule allowing it, if any.
+// GetInfo is not subject to the policy, so any authenticated identity may call it.
+func (a *authorizer) authorize(ctx context.Context, fullMethod string) (string, *PolicyRule, error) {
+	identity, err := a.authenticate(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	rpc := fullMethod[strings.LastIndexByte(fullMethod, '/')+1:]
+	if a.policy == nil || rpc == getInfoRPC {
+		return identity, nil, nil
+	}
+	rule, err := a.policy.authorizeRPC(identity, rpc)
+	if err != nil {
+		return "", nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return identity, rule, nil
+}
+
+func (a *authorizer) authenticate(ctx context.Context) (identity string, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorizationHeader)
+	if len(values) != 1 || !strings.HasPrefix(values[0], bearerPrefix) {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	identity, err = a.authenticator.Authenticate(strings.TrimPrefix(values[0], bearerPrefix))
+	if errors.Is(err, auth.ErrExpiredToken) || errors.Is(err, auth.ErrInvalidToken) {
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	} else if err != nil {
+		return "", status.Errorf(codes.Internal, "error authenticating: %v", err)
+	}
+	return identity, nil
+}
+
+// authorizeMessage checks whether the rule allows executing the command of the message, if it has one.
+func authorizeMessage(rule *PolicyRule, msg interface{}) error {
+	if rule == nil {
+		return nil
+	}
+	var req commandRequest
+	switch m := msg.(type) {
+	case commandRequest:
+		req = m
+	case preparedRequest:
+		if m.GetPrepare() == nil {
+			return nil
+		}
+		req = m.GetPrepare()
+	default:
+		return nil
+	}
+	if err := rule.authorizeCommand(req); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// authorizedStream checks each received message against the rule allowing the call.
+type authorizedStream struct {
+	grpc.ServerStream
+	// ctx carries the identity the call was authenticated as.
+	ctx  context.Context
+	rule *PolicyRule
+
+	mu  sync.Mutex
+	err error
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := authorizeMessage(s.rule, m); err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *authorizedStream) denied() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
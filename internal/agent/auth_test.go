@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"context"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPolicy = `{
+  "rules": [
+    {"name": "admin", "identities": ["admin"], "rpcs": ["*"]},
+    {
+      "name": "ci-make", "identities": ["ci"], "rpcs": ["ExecuteCommand"],
+      "commands": [["true"], ["/usr/bin/make", "-C", "/src/*", "**"]],
+      "working_dirs": ["/src/*"], "users": ["ci"], "groups": ["ci", "docker"], "environment": ["MAKE*"]
+    },
+    {"name": "no-streams", "identities": ["*"], "rpcs": ["ExecuteCommandStream"], "action": "deny"}
+  ]
+}`
+
+func loadTestPolicy(t *testing.T, content string) (*Policy, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return LoadPolicy(path)
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	require.NoError(t, err)
+
+	makeCommand := func(args ...string) []string {
+		return append([]string{"/usr/bin/make", "-C", "/src/pyro"}, args...)
+	}
+	tests := []struct {
+		name     string
+		identity string
+		rpc      string
+		req      *api.ExecuteCommandRequest
+		rule     string
+		denial   string
+	}{
+		{name: "admin", identity: "admin", rpc: "ExecuteCommandStream", req: &api.ExecuteCommandRequest{
+			Command: []string{"sh"}, User: "root", WorkingDir: "/", Environment: map[string]string{"PATH": "/"},
+		}, rule: "admin"},
+		{name: "exact", identity: "ci", rpc: "ExecuteCommand", req: &api.ExecuteCommandRequest{
+			Command: []string{"true"},
+		}, rule: "ci-make"},
+		{name: "remaining args", identity: "ci", rpc: "ExecuteCommand", req: &api.ExecuteCommandRequest{
+			Command: makeCommand("-j", "4"),
+		}, rule: "ci-make"},
+		{name: "no remaining args", identity: "ci", rpc: "ExecuteCommand", req: &api.ExecuteCommandRequest{
+			Command: makeCommand(),
+		}, rule: "ci-make"},
+		{name: "allowed attributes", identity: "ci", rpc: "ExecuteCommand", req: &api.ExecuteCommandRequest{
+			Command: makeCommand(), WorkingDir: "/src/pyro", User: "ci", Group: "ci", SupplementaryGroups: []string{"docker"},
+			Environment: map[string]string{"MAKEFLAGS": "-j4"}, EnvironmentMode: api.EnvironmentMode_ENVIRONMENT_MODE_CLEAN,
+		}, rule: "ci-make"},
+		{
+			name: "extra args", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"true", "x"}},
+			denial: `command ["true" "x"] is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "missing args", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"/usr/bin/make"}},
+			denial: `command ["/usr/bin/make"] is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "joined args", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"/usr/bin/make -C /src/pyro"}},
+			denial: `command ["/usr/bin/make -C /src/pyro"] is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "working dir", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"true"}, WorkingDir: "/etc"},
+			denial: `working directory "/etc" is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "user", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"true"}, User: "root"},
+			denial: `user "root" is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "group", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"true"}, Group: "root"},
+			denial: `group "root" is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "supplementary group", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"true"}, SupplementaryGroups: []string{"ci", "wheel"}},
+			denial: `group "wheel" is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "environment", identity: "ci", rpc: "ExecuteCommand",
+			req:    &api.ExecuteCommandRequest{Command: []string{"true"}, Environment: map[string]string{"LD_PRELOAD": "x"}},
+			denial: `environment variable "LD_PRELOAD" is not allowed by rule "ci-make"`,
+		},
+		{
+			name: "denied rpc", identity: "ci", rpc: "ExecuteCommandStream",
+			denial: `identity "ci" is denied ExecuteCommandStream by rule "no-streams"`,
+		},
+		{
+			name: "no rule", identity: "guest", rpc: "ExecuteCommand",
+			denial: `no rule allows identity "guest" to call ExecuteCommand`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := policy.authorizeRPC(tt.identity, tt.rpc)
+			if err == nil {
+				err = rule.authorizeCommand(tt.req)
+			}
+			if tt.denial != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.denial, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.rule, rule.Name)
+		})
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	rule := `{"name": "a", "identities": ["*"], "rpcs": ["*"]}`
+	for name, content := range map[string]string{
+		"invalid json":   `{"rules": [`,
+		"missing name":   `{"rules": [{"identities": ["*"], "rpcs": ["*"]}]}`,
+		"duplicate name": `{"rules": [` + rule + `, ` + rule + `]}`,
+		"missing rpcs":   `{"rules": [{"name": "a", "identities": ["*"]}]}`,
+		"invalid action": `{"rules": [{"name": "a", "identities": ["*"], "rpcs": ["*"], "action": "maybe"}]}`,
+		"empty command":  `{"rules": [{"name": "a", "identities": ["*"], "rpcs": ["*"], "commands": [[]]}]}`,
+		"misplaced **":   `{"rules": [{"name": "a", "identities": ["*"], "rpcs": ["*"], "commands": [["a", "**", "b"]]}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadTestPolicy(t, content)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	policy, err := loadTestPolicy(t, testPolicy)
+	require.NoError(t, err)
+	tokens := auth.StaticTokens{"admin-token": "admin", "ci-token": "ci"}
+	client, teardown := newTestServer(t, WithAuthentication(tokens, policy))
+	defer teardown()
+
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	execute := func(ctx context.Context, command ...string) error {
+		_, err := client.ExecuteCommand(ctx, &api.ExecuteCommandRequest{Command: command})
+		return err
+	}
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(execute(context.Background(), "true")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(execute(withToken("wrong"), "true")))
+	assert.NoError(t, execute(withToken("admin-token"), "true"))
+	assert.NoError(t, execute(withToken("ci-token"), "true"))
+
+	err = execute(withToken("ci-token"), "sh", "-c", "true")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `rule "ci-make"`)
+
+	stream, err := client.ExecuteCommandStream(withToken("ci-token"))
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `rule "no-streams"`)
+}
+
+func TestServerAuthenticationDeniesStreamedCommand(t *testing.T) {
+	policy, err := loadTestPolicy(t,
+		`{"rules": [{"name": "echo-only", "identities": ["ci"], "rpcs": ["*"], "commands": [["echo", "**"]]}]}`)
+	require.NoError(t, err)
+	client, teardown := newTestServer(t, WithAuthentication(auth.StaticTokens{"ci-token": "ci"}, policy))
+	defer teardown()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer ci-token")
+
+	stream, err := client.ExecuteCommandStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"cat", "/etc/shadow"}},
+	}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `rule "echo-only"`)
+
+	stream, err = client.ExecuteCommandStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"echo", "hi"}, WorkingDir: "/root"},
+	}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `working directory "/root"`)
+
+	stream, err = client.ExecuteCommandStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ExecuteCommandStreamRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"echo", "hi"}},
+	}))
+	// The stderr close frame may precede the output.
+	var stdout []byte
+	for {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		if resp.Result != nil {
+			break
+		}
+		stdout = append(stdout, resp.GetStdout().GetData()...)
+	}
+	assert.Equal(t, "hi\n", string(stdout))
+}
+
+func TestServerAuthenticationRestrictsProcessesToOwner(t *testing.T) {
+	tokens := auth.StaticTokens{"alice-token": "alice", "bob-token": "bob"}
+	client, teardown := newTestServer(t, WithAuthentication(tokens, nil))
+	defer teardown()
+	alice := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer alice-token")
+	bob := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer bob-token")
+
+	started, err := client.StartProcess(alice, &api.StartProcessRequest{
+		Prepare: &api.ExecuteCommandStreamRequest_Prepare{Command: []string{"sleep", "60"}},
+		Name:    "job",
+	})
+	require.NoError(t, err)
+	id := started.Process.Id
+
+	listed, err := client.ListProcesses(bob, &api.ListProcessesRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, listed.Processes)
+	listed, err = client.ListProcesses(alice, &api.ListProcessesRequest{})
+	require.NoError(t, err)
+	require.Len(t, listed.Processes, 1)
+	assert.Equal(t, id, listed.Processes[0].Id)
+
+	for _, idOrName := range []string{id, "job"} {
+		_, err = client.KillProcess(bob, &api.KillProcessRequest{Id: idOrName})
+		assert.Equal(t, codes.NotFound, status.Code(err), idOrName)
+		_, err = client.WaitProcess(bob, &api.WaitProcessRequest{Id: idOrName})
+		assert.Equal(t, codes.NotFound, status.Code(err), idOrName)
+		stream, err := client.AttachProcess(bob)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&api.AttachProcessRequest{Options: &api.AttachProcessRequest_Options{Id: idOrName}}))
+		_, err = stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err), idOrName)
+	}
+
+	_, err = client.KillProcess(alice, &api.KillProcessRequest{Id: "job", Signal: api.Signal_SIGNAL_KILL})
+	require.NoError(t, err)
+	waited, err := client.WaitProcess(alice, &api.WaitProcessRequest{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, api.ProcessState_PROCESS_STATE_EXITED, waited.Process.State)
+}
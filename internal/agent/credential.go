@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupCredential resolves the user, group and supplementary groups, each given either
+// as a name or a numeric id, into the credential to start a command with.
+// If no user is given, nil is returned and the command runs as the agent's user.
+// The group and supplementary groups default to the ones of the user.
+func lookupCredential(userName, groupName string, groupNames []string) (*syscall.Credential, error) {
+	if userName == "" {
+		if groupName != "" || len(groupNames) != 0 {
+			return nil, status.Error(codes.InvalidArgument, "groups can only be set together with a user")
+		}
+		return nil, nil
+	}
+	u, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	credential := &syscall.Credential{}
+	if credential.Uid, err = parseID(u.Uid); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid uid of user %s: %v", userName, err)
+	}
+	if groupName == "" {
+		groupName = u.Gid
+	}
+	if credential.Gid, err = lookupGroupID(groupName); err != nil {
+		return nil, err
+	}
+	if len(groupNames) == 0 && u.Username != "" {
+		if groupNames, err = u.GroupIds(); err != nil {
+			return nil, status.Errorf(codes.Internal, "error looking up groups of user %s: %v", userName, err)
+		}
+	}
+	for _, name := range groupNames {
+		gid, err := lookupGroupID(name)
+		if err != nil {
+			return nil, err
+		}
+		credential.Groups = append(credential.Groups, gid)
+	}
+	return credential, nil
+}
+
+// lookupUser looks up the user by name or numeric uid. Numeric uids don't need to exist
+// in the user database, in which case a user without name and groups is returned.
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err == nil {
+		return u, nil
+	}
+	var unknownUser user.UnknownUserError
+	if !errors.As(err, &unknownUser) {
+		return nil, status.Errorf(codes.Internal, "error looking up user %s: %v", name, err)
+	}
+	if _, idErr := parseID(name); idErr != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown user %s", name)
+	}
+	u, err = user.LookupId(name)
+	var unknownID user.UnknownUserIdError
+	if errors.As(err, &unknownID) {
+		return &user.User{Uid: name, Gid: name}, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error looking up user %s: %v", name, err)
+	}
+	return u, nil
+}
+
+func lookupGroupID(name string) (uint32, error) {
+	if id, err := parseID(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		var unknownGroup user.UnknownGroupError
+		if errors.As(err, &unknownGroup) {
+			return 0, status.Errorf(codes.InvalidArgument, "unknown group %s", name)
+		}
+		return 0, status.Errorf(codes.Internal, "error looking up group %s: %v", name, err)
+	}
+	id, err := parseID(g.Gid)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "invalid gid of group %s: %v", name, err)
+	}
+	return id, nil
+}
+
+func parseID(id string) (uint32, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	return uint32(n), err
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+func (s *server) StartProcess(ctx context.Context, req *api.StartProcessRequest) (*api.StartProcessResponse, error) {
+	s.logger.WithField("startProcessRequest", req).Debug("Got start process request")
+	if req.Prepare == nil {
+		return nil, status.Error(codes.InvalidArgument, "prepare must be set")
+	}
+	id, err := s.processes.reserve(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	spec := specFromPrepare(req.Prepare)
+	cmd, err := newCommand(spec)
+	if err != nil {
+		return nil, err
+	}
+	startedAt := time.Now()
+	proc, err := startProcess(cmd, spec, req.Prepare.Terminal)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Stdin {
+		_ = proc.stdin.Close()
+	}
+	p := &managedProcess{
+		id:        id,
+		name:      req.Name,
+		command:   req.Prepare.Command,
+		proc:      proc,
+		stdin:     req.Stdin,
+		output:    newOutputLog(s.processBufferSize),
+		startedAt: startedAt,
+		owner:     identityFromContext(ctx),
+		done:      make(chan struct{}),
+	}
+	if err := s.processes.add(p); err != nil {
+		_ = proc.signal(api.Signal_SIGNAL_KILL)
+		go func() { _ = proc.wait() }()
+		return nil, err
+	}
+	// The process outlives the call, so only its own timeout terminates it.
+	stop := supervise(context.Background(), cmd, spec.timeout, spec.gracePeriod)
+	go s.superviseProcess(p, stop)
+	return &api.StartProcessResponse{Process: p.info()}, nil
+}
+
+// superviseProcess buffers the output of the process until it exited and records its result.
+func (s *server) superviseProcess(p *managedProcess, stop func() bool) {
+	logger := s.logger.WithField("process", p.id)
+	drained := make(chan struct{})
+	go func() {
+		p.output.copyFrom(p.proc.stdout, false)
+		close(drained)
+	}()
+	if p.proc.stderr != nil {
+		p.output.copyFrom(p.proc.stderr, true)
+	}
+	<-drained
+	p.output.close()
+	err := waitError(p.proc.wait())
+	timedOut := stop()
+	var result *api.ExecuteResult
+	if state := p.proc.cmd.ProcessState; state != nil {
+		result = newExecuteResult(state, p.startedAt, time.Now())
+		result.TimedOut = timedOut
+	} else {
+		logger.WithError(err).Warn("Error waiting for process")
+		result = &api.ExecuteResult{StartedAt: timestamppb.New(p.startedAt), FinishedAt: timestamppb.Now()}
+	}
+	logger.WithField("result", result).Debug("Process exited")
+	s.processes.finish(p, result)
+}
+
+func (s *server) ListProcesses(ctx context.Context, req *api.ListProcessesRequest) (*api.ListProcessesResponse, error) {
+	s.logger.WithField("listProcessesRequest", req).Debug("Got list processes request")
+	return &api.ListProcessesResponse{Processes: s.processes.list(req.State, identityFromContext(ctx))}, nil
+}
+
+func (s *server) WaitProcess(ctx context.Context, req *api.WaitProcessRequest) (*api.WaitProcessResponse, error) {
+	s.logger.WithField("waitProcessRequest", req).Debug("Got wait process request")
+	p, err := s.processes.lookup(req.Id, identityFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-p.done:
+		return &api.WaitProcessResponse{Process: p.info()}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (s *server) KillProcess(ctx context.Context, req *api.KillProcessRequest) (*api.KillProcessResponse, error) {
+	s.logger.WithField("killProcessRequest", req).Debug("Got kill process request")
+	p, err := s.processes.lookup(req.Id, identityFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	sig := req.Signal
+	if sig == api.Signal_SIGNAL_UNSPECIFIED {
+		sig = api.Signal_SIGNAL_TERM
+	}
+	if p.exited() {
+		return nil, status.Errorf(codes.FailedPrecondition, "process %s already exited", p.id)
+	}
+	if err := p.proc.signal(sig); err != nil {
+		// The process may have exited since checking.
+		if p.exited() {
+			return nil, status.Errorf(codes.FailedPrecondition, "process %s already exited", p.id)
+		}
+		return nil, err
+	}
+	return &api.KillProcessResponse{}, nil
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/archive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
+)
+
+func (s *server) PushDir(stream api.AgentService_PushDirServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed receiving push dir request: %w", err)
+	}
+	opts := req.Options
+	if opts == nil {
+		return status.Error(codes.InvalidArgument, "first request must contain options")
+	}
+	if err := validatePath(opts.Path); err != nil {
+		return err
+	}
+	compression, err := archiveCompression(opts.Compression)
+	if err != nil {
+		return err
+	}
+	s.logger.WithField("options", opts).Debug("Got push dir request")
+
+	// The archive is extracted while it is received, so that it is never buffered as a whole.
+	pr, pw := io.Pipe()
+	received := make(chan error, 1)
+	go func() {
+		err := receiveArchive(stream, req.Data, pw)
+		_ = pw.CloseWithError(err)
+		received <- err
+	}()
+	stats, err := archive.Extract(pr, opts.Path, archive.ExtractOptions{
+		Compression:   compression,
+		AllowDevices:  opts.AllowDevices,
+		PreserveOwner: opts.PreserveOwner,
+	})
+	if err == nil {
+		// Consume the padding following the end of the archive.
+		_, err = io.Copy(io.Discard, pr)
+	}
+	_ = pr.CloseWithError(err)
+	if recvErr := <-received; recvErr != nil {
+		return fmt.Errorf("failed receiving push dir request: %w", recvErr)
+	}
+	if err != nil {
+		return extractError(err)
+	}
+	return stream.SendAndClose(&api.PushDirResponse{Entries: stats.Entries, Bytes: stats.Bytes})
+}
+
+// receiveArchive writes the data of the push dir requests to w until the client closes the stream.
+func receiveArchive(stream api.AgentService_PushDirServer, data []byte, w io.Writer) error {
+	for {
+		if _, err := w.Write(data); err != nil {
+			// The extraction stopped early and reports the actual error.
+			return nil
+		}
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if req.Options != nil {
+			return status.Error(codes.InvalidArgument, "only the first request may contain options")
+		}
+		data = req.Data
+	}
+}
+
+// extractError converts an error returned when extracting an archive into a gRPC status error.
+func extractError(err error) error {
+	switch {
+	case errors.Is(err, archive.ErrUnsafePath), errors.Is(err, archive.ErrDeviceNotAllowed):
+		return status.Errorf(codes.InvalidArgument, "rejected archive: %v", err)
+	default:
+		return pathError("directory", err)
+	}
+}
+
+func (s *server) PullDir(req *api.PullDirRequest, stream api.AgentService_PullDirServer) error {
+	s.logger.WithField("pullDirRequest", req).Debug("Got pull dir request")
+	if err := validatePath(req.Path); err != nil {
+		return err
+	}
+	compression, err := archiveCompression(req.Compression)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		return pathError("directory", err)
+	}
+	if !info.IsDir() {
+		return status.Errorf(codes.InvalidArgument, "%s is no directory", req.Path)
+	}
+	w := bufio.NewWriterSize(&pullDirWriter{stream: stream}, fileChunkSize)
+	if err := archive.Create(w, req.Path, compression); err != nil {
+		return pathError("directory", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed sending pull dir response: %w", err)
+	}
+	return nil
+}
+
+// pullDirWriter sends everything written to it as pull dir responses.
+type pullDirWriter struct {
+	stream api.AgentService_PullDirServer
+}
+
+func (w *pullDirWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&api.PullDirResponse{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// archiveCompression converts the compression of a request.
+func archiveCompression(c api.Compression) (archive.Compression, error) {
+	switch c {
+	case api.Compression_COMPRESSION_UNSPECIFIED, api.Compression_COMPRESSION_NONE:
+		return archive.None, nil
+	case api.Compression_COMPRESSION_GZIP:
+		return archive.Gzip, nil
+	default:
+		return 0, status.Errorf(codes.InvalidArgument, "unsupported compression %v", c)
+	}
+}
@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"io/fs"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultTimeoutGracePeriod is the time between SIGTERM and SIGKILL once a command's timeout expired.
+const defaultTimeoutGracePeriod = 10 * time.Second
+
+// commandSpec describes a command to be executed by the agent.
+type commandSpec struct {
+	command     []string
+	environment map[string]string
+	envMode     api.EnvironmentMode
+	workingDir  string
+	user        string
+	group       string
+	groups      []string
+	umask       *uint32
+	timeout     time.Duration
+	gracePeriod time.Duration
+	// mergeOutput redirects stderr into stdout.
+	mergeOutput bool
+}
+
+func specFromRequest(req *api.ExecuteCommandRequest) *commandSpec {
+	return &commandSpec{
+		command:     req.Command,
+		environment: req.Environment,
+		envMode:     req.EnvironmentMode,
+		workingDir:  req.WorkingDir,
+		user:        req.User,
+		group:       req.Group,
+		groups:      req.SupplementaryGroups,
+		umask:       req.Umask,
+		timeout:     req.Timeout.AsDuration(),
+		gracePeriod: gracePeriod(req.TimeoutGracePeriod),
+		mergeOutput: req.MergeOutput,
+	}
+}
+
+func specFromPrepare(prep *api.ExecuteCommandStreamRequest_Prepare) *commandSpec {
+	return &commandSpec{
+		command:     prep.Command,
+		environment: prep.Environment,
+		envMode:     prep.EnvironmentMode,
+		workingDir:  prep.WorkingDir,
+		user:        prep.User,
+		group:       prep.Group,
+		groups:      prep.SupplementaryGroups,
+		umask:       prep.Umask,
+		timeout:     prep.Timeout.AsDuration(),
+		gracePeriod: gracePeriod(prep.TimeoutGracePeriod),
+		mergeOutput: prep.MergeOutput,
+	}
+}
+
+// gracePeriod returns the given grace period or the default one, if it is not set.
+func gracePeriod(d *durationpb.Duration) time.Duration {
+	if d == nil {
+		return defaultTimeoutGracePeriod
+	}
+	return d.AsDuration()
+}
+
+// newCommand creates the command described by the spec.
+// The command is started in its own process group, so that it can be signalled as a whole.
+func newCommand(spec *commandSpec) (*exec.Cmd, error) {
+	if len(spec.command) == 0 || spec.command[0] == "" {
+		return nil, status.Error(codes.InvalidArgument, "command must not be empty")
+	}
+	if spec.timeout < 0 || spec.gracePeriod < 0 {
+		return nil, status.Error(codes.InvalidArgument, "timeout and grace period must not be negative")
+	}
+	if spec.workingDir != "" {
+		if info, err := os.Stat(spec.workingDir); err != nil {
+			return nil, pathError("working directory", err)
+		} else if !info.IsDir() {
+			return nil, status.Errorf(codes.InvalidArgument, "working directory %s is not a directory", spec.workingDir)
+		}
+	}
+	env, err := environmentList(spec.envMode, spec.environment)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := lookupCredential(spec.user, spec.group, spec.groups)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(spec.command[0], spec.command[1:]...)
+	cmd.Env = env
+	cmd.Dir = spec.workingDir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: credential}
+	return cmd, nil
+}
+
+// supervise terminates the process group of the started command once the timeout expired or ctx is done.
+// Once the timeout expired, the group is sent SIGTERM and, if the command is still running after the
+// grace period, SIGKILL. Once ctx is done, the group is killed immediately. A zero timeout disables it.
+// The returned function stops the supervision and reports whether the timeout expired.
+// It must be called once the command exited.
+func supervise(ctx context.Context, cmd *exec.Cmd, timeout, gracePeriod time.Duration) (stop func() (timedOut bool)) {
+	done := make(chan struct{})
+	var timedOut int32
+	go func() {
+		var timeoutCh, graceCh <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			timeoutCh = timer.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				_ = signalGroup(cmd, syscall.SIGKILL)
+				return
+			case <-timeoutCh:
+				atomic.StoreInt32(&timedOut, 1)
+				_ = signalGroup(cmd, syscall.SIGTERM)
+				grace := time.NewTimer(gracePeriod)
+				defer grace.Stop()
+				graceCh = grace.C
+				timeoutCh = nil
+			case <-graceCh:
+				_ = signalGroup(cmd, syscall.SIGKILL)
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() bool {
+		close(done)
+		return atomic.LoadInt32(&timedOut) == 1
+	}
+}
+
+// signalGroup sends the signal to the process group of the started command.
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// environmentList combines the given environment with the agent's one according to the mode
+// and returns it as a sorted KEY=VALUE list.
+func environmentList(mode api.EnvironmentMode, environment map[string]string) ([]string, error) {
+	merged := make(map[string]string)
+	switch mode {
+	case api.EnvironmentMode_ENVIRONMENT_MODE_CLEAN:
+	case api.EnvironmentMode_ENVIRONMENT_MODE_INHERIT:
+		if len(environment) != 0 {
+			return nil, status.Error(codes.InvalidArgument, "environment must be empty when inheriting the agent's one")
+		}
+		fallthrough
+	case api.EnvironmentMode_ENVIRONMENT_MODE_UNSPECIFIED, api.EnvironmentMode_ENVIRONMENT_MODE_MERGE:
+		for _, kv := range os.Environ() {
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				merged[kv[:i]] = kv[i+1:]
+			}
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported environment mode %v", mode)
+	}
+	for k, v := range environment {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid environment variable name %q", k)
+		}
+		merged[k] = v
+	}
+	env := make([]string, 0, len(merged))
+	for k, v := range merged {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// pathError converts an error accessing the path described by what into a gRPC status error.
+func pathError(what string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Errorf(codes.NotFound, "%s not found: %v", what, err)
+	case errors.Is(err, fs.ErrPermission):
+		return status.Errorf(codes.PermissionDenied, "permission denied: %v", err)
+	// ENOTEMPTY is considered an fs.ErrExist, so it must be handled first.
+	case errors.Is(err, syscall.ENOTEMPTY), errors.Is(err, syscall.ENOTDIR), errors.Is(err, syscall.EISDIR):
+		return status.Errorf(codes.FailedPrecondition, "error accessing %s: %v", what, err)
+	case errors.Is(err, fs.ErrExist):
+		return status.Errorf(codes.AlreadyExists, "%s already exists: %v", what, err)
+	default:
+		return status.Errorf(codes.Internal, "error accessing %s: %v", what, err)
+	}
+}
+
+// startError converts an error returned when starting a command into a gRPC status error.
+func startError(err error) error {
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return status.Errorf(codes.NotFound, "executable not found: %v", err)
+	case errors.Is(err, fs.ErrPermission):
+		return status.Errorf(codes.PermissionDenied, "permission denied: %v", err)
+	default:
+		return status.Errorf(codes.Internal, "error starting command: %v", err)
+	}
+}
+
+// waitError filters the error returned when waiting for a command.
+// The command exiting unsuccessfully is not considered an error, as it is reported in the result.
+func waitError(err error) error {
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		return nil
+	}
+	return status.Errorf(codes.Internal, "error waiting for command: %v", err)
+}
@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// fileChunkSize is the maximum size of the content sent in a single ReadFile response.
+	fileChunkSize = 64 * 1024
+	// defaultFileMode is the mode of written files, if neither given nor replacing an existing file.
+	defaultFileMode = 0o644
+)
+
+func (s *server) WriteFile(stream api.AgentService_WriteFileServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed receiving write file request: %w", err)
+	}
+	meta := req.Metadata
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "first request must contain metadata")
+	}
+	if err := validatePath(meta.Path); err != nil {
+		return err
+	}
+	s.logger.WithField("metadata", meta).Debug("Got write file request")
+	w, err := newAtomicFile(meta.Path)
+	if err != nil {
+		return err
+	}
+	defer w.discard()
+
+	var checksum []byte
+	for {
+		if _, err := w.Write(req.Data); err != nil {
+			return status.Errorf(codes.Internal, "error writing file: %v", err)
+		}
+		if req.Sha256 != nil {
+			checksum = req.Sha256
+		}
+		req, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed receiving write file request: %w", err)
+		}
+		if req.Metadata != nil {
+			return status.Error(codes.InvalidArgument, "only the first request may contain metadata")
+		}
+	}
+	sum := w.hash.Sum(nil)
+	if checksum != nil && !bytes.Equal(checksum, sum) {
+		return status.Errorf(codes.DataLoss, "checksum mismatch: expected %x, got %x", checksum, sum)
+	}
+	if err := w.commit(meta); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&api.WriteFileResponse{Size: w.size, Sha256: sum})
+}
+
+func (s *server) ReadFile(req *api.ReadFileRequest, stream api.AgentService_ReadFileServer) error {
+	s.logger.WithField("readFileRequest", req).Debug("Got read file request")
+	if err := validatePath(req.Path); err != nil {
+		return err
+	}
+	f, err := os.Open(req.Path)
+	if err != nil {
+		return pathError("file", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return pathError("file", err)
+	}
+	if info.IsDir() {
+		return status.Errorf(codes.InvalidArgument, "%s is a directory", req.Path)
+	}
+	if err := stream.Send(&api.ReadFileResponse{Metadata: fileMetadata(req.Path, info)}); err != nil {
+		return fmt.Errorf("failed sending read file response: %w", err)
+	}
+
+	h := sha256.New()
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if err := stream.Send(&api.ReadFileResponse{Data: buf[:n]}); err != nil {
+				return fmt.Errorf("failed sending read file response: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return status.Errorf(codes.Internal, "error reading file: %v", err)
+		}
+	}
+	if err := stream.Send(&api.ReadFileResponse{Sha256: h.Sum(nil)}); err != nil {
+		return fmt.Errorf("failed sending read file response: %w", err)
+	}
+	return nil
+}
+
+// validatePath ensures the path is absolute, as the agent's working directory is unknown to clients.
+func validatePath(path string) error {
+	if path == "" {
+		return status.Error(codes.InvalidArgument, "path must not be empty")
+	}
+	if !filepath.IsAbs(path) {
+		return status.Errorf(codes.InvalidArgument, "path %s must be absolute", path)
+	}
+	return nil
+}
+
+// fileMetadata returns the metadata of the file at path described by info.
+func fileMetadata(path string, info fs.FileInfo) *api.FileMetadata {
+	mode := uint32(info.Mode().Perm())
+	meta := &api.FileMetadata{
+		Path:  path,
+		Mode:  &mode,
+		Mtime: timestamppb.New(info.ModTime()),
+		Size:  info.Size(),
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid := stat.Uid, stat.Gid
+		meta.Uid, meta.Gid = &uid, &gid
+	}
+	return meta
+}
+
+// atomicFile is written to a temporary file next to the destination, which replaces the destination
+// once committed. Thus, readers never see a partially written file.
+type atomicFile struct {
+	*os.File
+	path string
+	hash hash.Hash
+	size int64
+	done bool
+}
+
+func newAtomicFile(path string) (*atomicFile, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, status.Errorf(codes.InvalidArgument, "%s is a directory", path)
+	}
+	dir, name := filepath.Split(path)
+	f, err := os.CreateTemp(dir, "."+name+".pyro-*")
+	if err != nil {
+		return nil, pathError("directory", err)
+	}
+	return &atomicFile{File: f, path: path, hash: sha256.New()}, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	return n, err
+}
+
+// commit applies the metadata to the temporary file and moves it to the destination.
+func (f *atomicFile) commit(meta *api.FileMetadata) error {
+	mode := os.FileMode(defaultFileMode)
+	if meta.Mode != nil {
+		mode = os.FileMode(*meta.Mode).Perm()
+	} else if info, err := os.Stat(f.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := f.Chmod(mode); err != nil {
+		return status.Errorf(codes.Internal, "error setting mode: %v", err)
+	}
+	if meta.Uid != nil || meta.Gid != nil {
+		uid, gid := -1, -1
+		if meta.Uid != nil {
+			uid = int(*meta.Uid)
+		}
+		if meta.Gid != nil {
+			gid = int(*meta.Gid)
+		}
+		if err := f.Chown(uid, gid); err != nil {
+			return pathError("file", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return status.Errorf(codes.Internal, "error syncing file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return status.Errorf(codes.Internal, "error closing file: %v", err)
+	}
+	if meta.Mtime != nil {
+		mtime := meta.Mtime.AsTime()
+		if err := os.Chtimes(f.Name(), time.Now(), mtime); err != nil {
+			return status.Errorf(codes.Internal, "error setting modification time: %v", err)
+		}
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return pathError("file", err)
+	}
+	f.done = true
+	return nil
+}
+
+// discard removes the temporary file, unless it was committed.
+func (f *atomicFile) discard() {
+	if f.done {
+		return
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
@@ -0,0 +1,298 @@
+package agent
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+const (
+	// defaultReadDirPageSize is the number of entries returned by ReadDir, if not requested otherwise.
+	defaultReadDirPageSize = 1000
+	// maxReadDirPageSize caps the number of entries returned by ReadDir to bound the response size.
+	maxReadDirPageSize = 10000
+	// readDirBatchSize is the number of names ReadDir reads from a directory at once.
+	readDirBatchSize = 1024
+	// defaultDirMode is the mode of directories created by Mkdir, if not requested otherwise.
+	defaultDirMode = 0o755
+)
+
+func (s *server) Stat(_ context.Context, req *api.StatRequest) (*api.StatResponse, error) {
+	s.logger.WithField("statRequest", req).Debug("Got stat request")
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	stat := os.Lstat
+	if req.FollowSymlinks {
+		stat = os.Stat
+	}
+	info, err := stat(req.Path)
+	if err != nil {
+		return nil, pathError("file", err)
+	}
+	return &api.StatResponse{Stat: fileStat(req.Path, info)}, nil
+}
+
+func (s *server) ReadDir(_ context.Context, req *api.ReadDirRequest) (*api.ReadDirResponse, error) {
+	s.logger.WithField("readDirRequest", req).Debug("Got read dir request")
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultReadDirPageSize
+	case pageSize > maxReadDirPageSize:
+		pageSize = maxReadDirPageSize
+	}
+	dir, err := os.Open(req.Path)
+	if err != nil {
+		return nil, pathError("directory", err)
+	}
+	defer dir.Close()
+	// The page token is the name of the last returned entry, which remains valid if entries are added or removed.
+	names, more, err := readDirPage(dir, req.PageToken, pageSize)
+	if err != nil {
+		return nil, pathError("directory", err)
+	}
+	resp := &api.ReadDirResponse{}
+	for _, name := range names {
+		path := filepath.Join(req.Path, name)
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since reading the names.
+			continue
+		} else if err != nil {
+			return nil, pathError("file", err)
+		}
+		resp.Entries = append(resp.Entries, fileStat(path, info))
+	}
+	if more {
+		resp.NextPageToken = names[len(names)-1]
+	}
+	return resp, nil
+}
+
+// readDirPage returns the names following after in sorted order, at most limit of them, and whether there are more.
+// As directories are not ordered by name, each page requires reading all names. However, only the names of the
+// page are retained, so that memory is bounded by the page size rather than by the size of the directory.
+func readDirPage(dir *os.File, after string, limit int) ([]string, bool, error) {
+	page := make(nameHeap, 0, limit)
+	more := false
+	for {
+		names, err := dir.Readdirnames(readDirBatchSize)
+		for _, name := range names {
+			switch {
+			case name <= after:
+			case len(page) < limit:
+				heap.Push(&page, name)
+			case name < page[0]:
+				page[0] = name
+				heap.Fix(&page, 0)
+				more = true
+			default:
+				more = true
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+	sort.Strings(page)
+	return page, more, nil
+}
+
+// nameHeap is a max-heap of names, which keeps the largest name retained for a page at its root.
+type nameHeap []string
+
+func (h nameHeap) Len() int           { return len(h) }
+func (h nameHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h nameHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *nameHeap) Push(x interface{}) {
+	*h = append(*h, x.(string))
+}
+
+func (h *nameHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (s *server) Mkdir(_ context.Context, req *api.MkdirRequest) (*api.MkdirResponse, error) {
+	s.logger.WithField("mkdirRequest", req).Debug("Got mkdir request")
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	mode := fs.FileMode(defaultDirMode)
+	if req.Mode != nil {
+		mode = unixFileMode(*req.Mode)
+	}
+	mkdir := os.Mkdir
+	if req.Parents {
+		mkdir = os.MkdirAll
+	}
+	if err := mkdir(req.Path, mode); err != nil {
+		return nil, pathError("directory", err)
+	}
+	return &api.MkdirResponse{}, nil
+}
+
+func (s *server) Remove(_ context.Context, req *api.RemoveRequest) (*api.RemoveResponse, error) {
+	s.logger.WithField("removeRequest", req).Debug("Got remove request")
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	if !req.Recursive {
+		if err := os.Remove(req.Path); err != nil {
+			return nil, pathError("file", err)
+		}
+		return &api.RemoveResponse{}, nil
+	}
+	if filepath.Clean(req.Path) == "/" {
+		return nil, status.Error(codes.InvalidArgument, "refusing to remove / recursively")
+	}
+	// RemoveAll succeeds for missing paths, which should be reported like for non-recursive removals.
+	if _, err := os.Lstat(req.Path); err != nil {
+		return nil, pathError("file", err)
+	}
+	if err := os.RemoveAll(req.Path); err != nil {
+		return nil, pathError("file", err)
+	}
+	return &api.RemoveResponse{}, nil
+}
+
+func (s *server) Rename(_ context.Context, req *api.RenameRequest) (*api.RenameResponse, error) {
+	s.logger.WithField("renameRequest", req).Debug("Got rename request")
+	if err := validatePath(req.OldPath); err != nil {
+		return nil, err
+	}
+	if err := validatePath(req.NewPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(req.OldPath, req.NewPath); err != nil {
+		return nil, pathError("file", err)
+	}
+	return &api.RenameResponse{}, nil
+}
+
+func (s *server) Chmod(_ context.Context, req *api.ChmodRequest) (*api.ChmodResponse, error) {
+	s.logger.WithField("chmodRequest", req).Debug("Got chmod request")
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	if req.Mode&^0o7777 != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mode %o", req.Mode)
+	}
+	if err := os.Chmod(req.Path, unixFileMode(req.Mode)); err != nil {
+		return nil, pathError("file", err)
+	}
+	return &api.ChmodResponse{}, nil
+}
+
+func (s *server) Chown(_ context.Context, req *api.ChownRequest) (*api.ChownResponse, error) {
+	s.logger.WithField("chownRequest", req).Debug("Got chown request")
+	if err := validatePath(req.Path); err != nil {
+		return nil, err
+	}
+	uid, gid := -1, -1
+	if req.Uid != nil {
+		uid = int(*req.Uid)
+	}
+	if req.Gid != nil {
+		gid = int(*req.Gid)
+	}
+	chown := os.Chown
+	if req.NoFollowSymlinks {
+		chown = os.Lchown
+	}
+	if err := chown(req.Path, uid, gid); err != nil {
+		return nil, pathError("file", err)
+	}
+	return &api.ChownResponse{}, nil
+}
+
+// fileStat describes the file at path.
+func fileStat(path string, info fs.FileInfo) *api.FileStat {
+	stat := &api.FileStat{
+		Name:  info.Name(),
+		Type:  fileType(info.Mode()),
+		Mode:  unixMode(info.Mode()),
+		Size:  info.Size(),
+		Mtime: timestamppb.New(info.ModTime()),
+	}
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		stat.Uid, stat.Gid = sys.Uid, sys.Gid
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		// The target is informational only, so failing to read it does not fail the whole request.
+		stat.SymlinkTarget, _ = os.Readlink(path)
+	}
+	return stat
+}
+
+func fileType(mode fs.FileMode) api.FileType {
+	switch {
+	case mode.IsRegular():
+		return api.FileType_FILE_TYPE_REGULAR
+	case mode.IsDir():
+		return api.FileType_FILE_TYPE_DIRECTORY
+	case mode&fs.ModeSymlink != 0:
+		return api.FileType_FILE_TYPE_SYMLINK
+	case mode&fs.ModeNamedPipe != 0:
+		return api.FileType_FILE_TYPE_NAMED_PIPE
+	case mode&fs.ModeSocket != 0:
+		return api.FileType_FILE_TYPE_SOCKET
+	case mode&fs.ModeCharDevice != 0:
+		return api.FileType_FILE_TYPE_CHAR_DEVICE
+	case mode&fs.ModeDevice != 0:
+		return api.FileType_FILE_TYPE_BLOCK_DEVICE
+	default:
+		return api.FileType_FILE_TYPE_UNSPECIFIED
+	}
+}
+
+// unixMode returns the permission and special bits of the mode as in chmod(2).
+func unixMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
+
+// unixFileMode converts permission and special bits as in chmod(2) into a file mode.
+func unixFileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode).Perm()
+	if mode&syscall.S_ISUID != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&syscall.S_ISGID != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&syscall.S_ISVTX != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/internal/version"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"os"
+	"runtime"
+)
+
+// APIVersion is the version of the API served by the agent.
+const APIVersion = "v1"
+
+// features are the features supported by the agent.
+var features = []api.Feature{
+	api.Feature_FEATURE_STREAMING,
+	api.Feature_FEATURE_PTY,
+	api.Feature_FEATURE_SIGNALS,
+	api.Feature_FEATURE_STDIN,
+	api.Feature_FEATURE_TIMEOUTS,
+	api.Feature_FEATURE_ENVIRONMENT_MODES,
+	api.Feature_FEATURE_PROCESS_ATTRIBUTES,
+	api.Feature_FEATURE_OUTPUT_LIMITS,
+	api.Feature_FEATURE_FILE_TRANSFER,
+	api.Feature_FEATURE_DIR_TRANSFER,
+	api.Feature_FEATURE_FILESYSTEM,
+	api.Feature_FEATURE_MANIFEST,
+	api.Feature_FEATURE_PROCESSES,
+	api.Feature_FEATURE_ATTACH,
+	api.Feature_FEATURE_SESSIONS,
+	api.Feature_FEATURE_START_CONFIRMATION,
+	api.Feature_FEATURE_OUTPUT_ORDERING,
+}
+
+func (s *server) GetInfo(_ context.Context, _ *api.GetInfoRequest) (*api.GetInfoResponse, error) {
+	info := &api.GetInfoResponse{
+		Version:    version.Version,
+		Commit:     version.Commit,
+		ApiVersion: APIVersion,
+		Features:   features,
+		Os:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+	}
+	// The remaining information is best effort, as it may not be available on every system.
+	info.Hostname, _ = os.Hostname()
+	info.Kernel, _ = kernelRelease()
+	if bootTime, err := bootTime(); err == nil {
+		info.BootTime = timestamppb.New(bootTime)
+	}
+	return info, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import (
+	"errors"
+	"time"
+)
+
+var errInfoUnsupported = errors.New("not supported on this platform")
+
+func kernelRelease() (string, error) {
+	return "", errInfoUnsupported
+}
+
+func bootTime() (time.Time, error) {
+	return time.Time{}, errInfoUnsupported
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"fmt"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// manifestBatchSize is the maximum number of entries sent in a single GetManifest response.
+const manifestBatchSize = 1000
+
+func (s *server) GetManifest(req *api.GetManifestRequest, stream api.AgentService_GetManifestServer) error {
+	s.logger.WithField("getManifestRequest", req).Debug("Got get manifest request")
+	if err := validatePath(req.Path); err != nil {
+		return err
+	}
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		return pathError("directory", err)
+	}
+	if !info.IsDir() {
+		return status.Errorf(codes.InvalidArgument, "%s is no directory", req.Path)
+	}
+
+	resp := &api.GetManifestResponse{}
+	send := func() error {
+		if err := stream.Send(resp); err != nil {
+			return fmt.Errorf("failed sending get manifest response: %w", err)
+		}
+		resp = &api.GetManifestResponse{}
+		return nil
+	}
+	var sendErr error
+	err = filepath.WalkDir(req.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == req.Path {
+			return nil
+		}
+		entry, err := manifestEntry(req.Path, path, d, req.Checksums)
+		if err != nil {
+			return err
+		}
+		resp.Entries = append(resp.Entries, entry)
+		if len(resp.Entries) == manifestBatchSize {
+			if sendErr = send(); sendErr != nil {
+				return sendErr
+			}
+		}
+		return nil
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return pathError("file", err)
+	}
+	if len(resp.Entries) > 0 {
+		return send()
+	}
+	return nil
+}
+
+// manifestEntry describes the file at path below the directory root.
+func manifestEntry(root, path string, d fs.DirEntry, checksum bool) (*api.ManifestEntry, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &api.ManifestEntry{
+		Path:  filepath.ToSlash(rel),
+		Type:  fileType(info.Mode()),
+		Mode:  unixMode(info.Mode()),
+		Size:  info.Size(),
+		Mtime: timestamppb.New(info.ModTime()),
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		if entry.SymlinkTarget, err = os.Readlink(path); err != nil {
+			return nil, err
+		}
+	case info.Mode().IsRegular() && checksum:
+		if entry.Sha256, err = fileChecksum(path); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func fileChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"crypto/tls"
+	"github.com/sirkrypt0/pyro/pkg/auth"
+)
+
+// DefaultMaxOutputSize is the default maximum number of bytes of stdout and stderr each,
+// which are returned by ExecuteCommand.
+const DefaultMaxOutputSize = 1024 * 1024
+
+// MaxOutputSizeLimit is the largest supported maximum output size. It keeps a response carrying both
+// stdout and stderr below gRPC's default maximum message size of 4 MiB, leaving room for the remaining fields.
+const MaxOutputSizeLimit = 2*1024*1024 - 64*1024
+
+// DefaultProcessOutputBufferSize is the default number of bytes of the combined stdout and stderr
+// buffered for each process started by StartProcess.
+const DefaultProcessOutputBufferSize = 1024 * 1024
+
+// Option configures the agent server.
+type Option func(*server)
+
+// WithMaxOutputSize sets the maximum number of bytes of stdout and stderr each, which are
+// returned by ExecuteCommand. Output exceeding it is truncated. The size must be positive and
+// at most MaxOutputSizeLimit, otherwise creating the server fails.
+func WithMaxOutputSize(size int) Option {
+	return func(s *server) {
+		s.maxOutputSize = size
+	}
+}
+
+// WithProcessOutputBufferSize sets the number of bytes of the combined stdout and stderr buffered for
+// each process started by StartProcess, which can be replayed when attaching. Older output is dropped.
+func WithProcessOutputBufferSize(size int) Option {
+	return func(s *server) {
+		s.processBufferSize = size
+	}
+}
+
+// WithTLSConfig makes the agent serve over TLS using the given configuration.
+// It should require and verify client certificates, as anyone connected may execute arbitrary commands.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithAuthentication requires calls to carry a bearer token accepted by the authenticator.
+// If policy is not nil, the identity the token belongs to must be allowed the call by it.
+func WithAuthentication(authenticator auth.Authenticator, policy *Policy) Option {
+	return func(s *server) {
+		s.authorizer = &authorizer{authenticator: authenticator, policy: policy}
+	}
+}
+
+// WithReflection enables the gRPC server reflection service, e.g. for debugging with grpcurl.
+func WithReflection() Option {
+	return func(s *server) {
+		s.reflection = true
+	}
+}
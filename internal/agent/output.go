@@ -0,0 +1,57 @@
+package agent
+
+import (
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+)
+
+// limitedBuffer is a writer retaining at most limit bytes of everything written to it.
+// Depending on the retention, either the beginning or the end of the output is retained.
+// Writes never fail, so that the command is not affected by its output being truncated.
+type limitedBuffer struct {
+	limit int
+	tail  bool
+	buf   []byte
+	total uint64
+}
+
+func newLimitedBuffer(limit int, retention api.OutputRetention) *limitedBuffer {
+	return &limitedBuffer{limit: limit, tail: retention == api.OutputRetention_OUTPUT_RETENTION_TAIL}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.total += uint64(len(p))
+	if !b.tail {
+		if remaining := b.limit - len(b.buf); remaining > 0 {
+			if len(p) > remaining {
+				b.buf = append(b.buf, p[:remaining]...)
+			} else {
+				b.buf = append(b.buf, p...)
+			}
+		}
+		return len(p), nil
+	}
+	if len(p) >= b.limit {
+		b.buf = append(b.buf[:0], p[len(p)-b.limit:]...)
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	// Discarding lazily keeps the amortized cost of writes low, while bounding memory to twice the limit.
+	if len(b.buf) > 2*b.limit {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+// executeIO returns the retained output.
+func (b *limitedBuffer) executeIO() *api.ExecuteIO {
+	data := b.buf
+	if len(data) > b.limit {
+		data = data[len(data)-b.limit:]
+	}
+	return &api.ExecuteIO{
+		Close:      true,
+		Data:       data,
+		Truncated:  b.total > uint64(len(data)),
+		TotalBytes: b.total,
+	}
+}
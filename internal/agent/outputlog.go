@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"io"
+	"sync"
+)
+
+// outputChunk is a piece of output written at once to either stdout or stderr.
+type outputChunk struct {
+	// offset is the position of the chunk's first byte in the combined output.
+	offset uint64
+	stderr bool
+	data   []byte
+}
+
+// outputLog is a bounded ring buffer of the combined stdout and stderr of a process, which
+// readers may replay from an offset and follow until the process closed its output.
+// Once the buffered output exceeds the limit, the oldest output is dropped.
+type outputLog struct {
+	mu     sync.Mutex
+	limit  int
+	chunks []outputChunk
+	size   int
+	// end is the offset following the last byte written.
+	end    uint64
+	closed bool
+	// changed is closed and replaced whenever output is written or the log is closed.
+	changed chan struct{}
+}
+
+func newOutputLog(limit int) *outputLog {
+	return &outputLog{limit: limit, changed: make(chan struct{})}
+}
+
+// write appends a copy of p to the log.
+func (l *outputLog) write(stderr bool, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	data := make([]byte, len(p))
+	copy(data, p)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.chunks = append(l.chunks, outputChunk{offset: l.end, stderr: stderr, data: data})
+	l.size += len(data)
+	l.end += uint64(len(data))
+	for l.size > l.limit {
+		// Chunks are never modified, so readers may still hold the dropped ones.
+		excess := l.size - l.limit
+		if first := l.chunks[0]; len(first.data) <= excess {
+			l.chunks = l.chunks[1:]
+			l.size -= len(first.data)
+		} else {
+			l.chunks[0] = outputChunk{offset: first.offset + uint64(excess), stderr: first.stderr, data: first.data[excess:]}
+			l.size -= excess
+		}
+	}
+	l.notify()
+}
+
+// close marks the output as complete.
+func (l *outputLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.notify()
+}
+
+func (l *outputLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// offset returns the offset following the last byte written.
+func (l *outputLog) offset() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.end
+}
+
+// start returns the offset reading from the given one starts at, which is the oldest buffered output
+// if the offset is no longer buffered and the end of the output if the offset is beyond it.
+func (l *outputLog) start(offset uint64) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	first := l.end
+	if len(l.chunks) > 0 {
+		first = l.chunks[0].offset
+	}
+	if offset < first {
+		return first
+	} else if offset > l.end {
+		return l.end
+	}
+	return offset
+}
+
+// read returns the buffered output from the offset on, or from the oldest buffered output if the offset
+// is no longer buffered, along with the offset to continue reading from. Offsets beyond the written
+// output are treated as its end. It also reports whether the output is complete and returns a channel
+// closed once there is more to read.
+func (l *outputLog) read(offset uint64) (chunks []outputChunk, next uint64, closed bool, changed <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, chunk := range l.chunks {
+		chunkEnd := chunk.offset + uint64(len(chunk.data))
+		if chunkEnd <= offset {
+			continue
+		}
+		if chunk.offset < offset {
+			chunk.data = chunk.data[offset-chunk.offset:]
+			chunk.offset = offset
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, l.end, l.closed, l.changed
+}
+
+// copyFrom writes everything read from r to the log until EOF or a read error.
+func (l *outputLog) copyFrom(r io.Reader, stderr bool) {
+	buf := make([]byte, streamingOutputBufferSize)
+	for {
+		n, err := r.Read(buf)
+		l.write(stderr, buf[:n])
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOutputLog(t *testing.T) {
+	l := newOutputLog(8)
+	_, _, _, changed := l.read(0)
+	l.write(false, []byte("abcd"))
+	l.write(true, []byte("ef"))
+	select {
+	case <-changed:
+	default:
+		t.Fatal("write did not notify readers")
+	}
+
+	chunks, next, closed, _ := l.read(2)
+	assert.Equal(t, uint64(6), next)
+	assert.False(t, closed)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, outputChunk{offset: 2, data: []byte("cd")}, chunks[0])
+	assert.Equal(t, outputChunk{offset: 4, stderr: true, data: []byte("ef")}, chunks[1])
+
+	// Exceeding the limit drops the oldest output, so reading from the start begins at the oldest buffered byte.
+	l.write(false, []byte("ghij"))
+	chunks, next, _, _ = l.read(0)
+	assert.Equal(t, uint64(10), next)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, outputChunk{offset: 2, data: []byte("cd")}, chunks[0])
+	assert.Equal(t, outputChunk{offset: 6, data: []byte("ghij")}, chunks[2])
+
+	assert.Equal(t, uint64(2), l.start(0))
+	assert.Equal(t, uint64(7), l.start(7))
+	assert.Equal(t, uint64(10), l.start(100))
+
+	l.write(false, []byte("0123456789"))
+	chunks, next, _, _ = l.read(0)
+	assert.Equal(t, uint64(20), next)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, outputChunk{offset: 12, data: []byte("23456789")}, chunks[0])
+
+	l.close()
+	chunks, next, closed, _ = l.read(100)
+	assert.Empty(t, chunks)
+	assert.Equal(t, uint64(20), next)
+	assert.True(t, closed)
+}
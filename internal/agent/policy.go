@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	policyActionAllow = "allow"
+	policyActionDeny  = "deny"
+	policyWildcard    = "*"
+	// policyRemainingArgs matches any remaining arguments of a command.
+	policyRemainingArgs = "**"
+)
+
+// Policy decides which RPCs and commands identities may use.
+// The first rule matching an identity and RPC decides whether the call is allowed.
+// Calls without any matching rule are denied. The policy does not apply to GetInfo, which is allowed to any
+// authenticated identity, as clients use it to find out which features the agent supports.
+// Neither does it apply to the health service, which does not even require authentication.
+type Policy struct {
+	Rules []*PolicyRule `json:"rules"`
+}
+
+// PolicyRule allows or denies identities to call RPCs.
+type PolicyRule struct {
+	// Name identifies the rule in denials.
+	Name string `json:"name"`
+	// Identities the rule applies to, * matches any.
+	Identities []string `json:"identities"`
+	// RPCs the rule applies to by their method name, e.g. ExecuteCommand, * matches any.
+	RPCs []string `json:"rpcs"`
+	// Action is either allow, the default, or deny.
+	Action string `json:"action,omitempty"`
+	// Commands restricts allowed RPCs executing commands to those matching any of the patterns.
+	// Each pattern lists one pattern per argument, the first one matching the executable, in which * matches
+	// any sequence of characters. A final ** matches any remaining arguments, e.g. ["/usr/bin/make", "**"].
+	// If empty, any command is allowed and the following restrictions do not apply.
+	Commands [][]string `json:"commands,omitempty"`
+	// WorkingDirs lists the patterns of the working directories commands may run in, in which * matches
+	// any sequence of characters. Commands may always run in the agent's working directory.
+	WorkingDirs []string `json:"working_dirs,omitempty"`
+	// Users lists the users commands may run as, * matches any. Commands may always run as the agent's user.
+	Users []string `json:"users,omitempty"`
+	// Groups lists the groups and supplementary groups commands may run with, * matches any.
+	// Commands may always run with the user's groups.
+	Groups []string `json:"groups,omitempty"`
+	// Environment lists the patterns of the environment variables' names commands may set, in which
+	// * matches any sequence of characters. Commands may always inherit the agent's environment.
+	Environment []string `json:"environment,omitempty"`
+
+	commands    [][]*regexp.Regexp
+	workingDirs []*regexp.Regexp
+	environment []*regexp.Regexp
+}
+
+// commandRequest is implemented by the requests and prepare messages executing a command.
+type commandRequest interface {
+	GetCommand() []string
+	GetEnvironment() map[string]string
+	GetWorkingDir() string
+	GetUser() string
+	GetGroup() string
+	GetSupplementaryGroups() []string
+}
+
+// LoadPolicy reads a policy from a JSON file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %w", err)
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy file %s: %w", path, err)
+	}
+	if err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// compile validates the rules and compiles their command patterns.
+func (p *Policy) compile() error {
+	names := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if len(rule.Identities) == 0 || len(rule.RPCs) == 0 {
+			return fmt.Errorf("rule %q must specify identities and rpcs", rule.Name)
+		}
+		switch rule.Action {
+		case "", policyActionAllow, policyActionDeny:
+		default:
+			return fmt.Errorf("rule %q has invalid action %q", rule.Name, rule.Action)
+		}
+		if err := rule.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compile validates and compiles the rule's patterns.
+func (r *PolicyRule) compile() error {
+	r.commands = make([][]*regexp.Regexp, len(r.Commands))
+	for i, command := range r.Commands {
+		if len(command) == 0 || command[0] == policyRemainingArgs {
+			return fmt.Errorf("rule %q has a command without executable", r.Name)
+		}
+		for j, arg := range command {
+			if arg == policyRemainingArgs && j == len(command)-1 {
+				break
+			} else if arg == policyRemainingArgs {
+				return fmt.Errorf("rule %q has command %q with ** not being the last argument", r.Name, command)
+			}
+			r.commands[i] = append(r.commands[i], compilePattern(arg))
+		}
+	}
+	r.workingDirs = compilePatterns(r.WorkingDirs)
+	r.environment = compilePatterns(r.Environment)
+	return nil
+}
+
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = compilePattern(pattern)
+	}
+	return compiled
+}
+
+// compilePattern converts a pattern, in which * matches any sequence of characters, into a regexp.
+func compilePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, policyWildcard)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// authorizeRPC returns the rule deciding whether the identity may call the RPC.
+// It returns an error if there is no such rule or the rule denies the call.
+func (p *Policy) authorizeRPC(identity, rpc string) (*PolicyRule, error) {
+	for _, rule := range p.Rules {
+		if matchesAny(rule.Identities, identity) && matchesAny(rule.RPCs, rpc) {
+			if rule.Action == policyActionDeny {
+				return nil, fmt.Errorf("identity %q is denied %s by rule %q", identity, rpc, rule.Name)
+			}
+			return rule, nil
+		}
+	}
+	return nil, fmt.Errorf("no rule allows identity %q to call %s", identity, rpc)
+}
+
+// authorizeCommand returns an error if the rule does not allow executing the command as requested.
+func (r *PolicyRule) authorizeCommand(req commandRequest) error {
+	if len(r.Commands) == 0 {
+		return nil
+	}
+	command := req.GetCommand()
+	if !r.matchesCommand(command) {
+		return fmt.Errorf("command %q is not allowed by rule %q", command, r.Name)
+	}
+	if dir := req.GetWorkingDir(); dir != "" && !matchesAnyPattern(r.workingDirs, dir) {
+		return fmt.Errorf("working directory %q is not allowed by rule %q", dir, r.Name)
+	}
+	if user := req.GetUser(); user != "" && !matchesAny(r.Users, user) {
+		return fmt.Errorf("user %q is not allowed by rule %q", user, r.Name)
+	}
+	groups := req.GetSupplementaryGroups()
+	if group := req.GetGroup(); group != "" {
+		groups = append([]string{group}, groups...)
+	}
+	for _, group := range groups {
+		if !matchesAny(r.Groups, group) {
+			return fmt.Errorf("group %q is not allowed by rule %q", group, r.Name)
+		}
+	}
+	for name := range req.GetEnvironment() {
+		if !matchesAnyPattern(r.environment, name) {
+			return fmt.Errorf("environment variable %q is not allowed by rule %q", name, r.Name)
+		}
+	}
+	return nil
+}
+
+// matchesCommand returns whether any of the rule's commands matches the command argument by argument.
+func (r *PolicyRule) matchesCommand(command []string) bool {
+	for i, patterns := range r.commands {
+		remaining := r.Commands[i][len(r.Commands[i])-1] == policyRemainingArgs
+		if len(command) < len(patterns) || (!remaining && len(command) > len(patterns)) {
+			continue
+		}
+		matches := true
+		for j, pattern := range patterns {
+			if !pattern.MatchString(command[j]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyPattern(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(values []string, value string) bool {
+	for _, v := range values {
+		if v == policyWildcard || v == value {
+			return true
+		}
+	}
+	return false
+}
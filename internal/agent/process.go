@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"github.com/creack/pty"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// endOfTransmission is written to a pseudo-terminal to signal the end of input.
+const endOfTransmission = 0x04
+
+// process is a started command together with the streams connected to it.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	// stderr is nil if it is merged into stdout or the process is attached to a pseudo-terminal.
+	stderr io.Reader
+	tty    *os.File
+}
+
+// startProcess starts the command either attached to pipes or, if terminal is set, to a pseudo-terminal.
+// If the spec merges the output, stdout and stderr share a single pipe.
+func startProcess(cmd *exec.Cmd, spec *commandSpec, terminal *api.Terminal) (*process, error) {
+	if terminal != nil {
+		return startTerminalProcess(cmd, spec, terminal)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error creating stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error creating stdout pipe: %v", err)
+	}
+	var stderr io.Reader
+	if spec.mergeOutput {
+		// The command shares a single pipe for both, if stdout and stderr are the same file.
+		cmd.Stderr = cmd.Stdout
+	} else if stderr, err = cmd.StderrPipe(); err != nil {
+		return nil, status.Errorf(codes.Internal, "error creating stderr pipe: %v", err)
+	}
+	if err := withUmask(cmd, spec.umask, cmd.Start); err != nil {
+		return nil, startError(err)
+	}
+	return &process{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr}, nil
+}
+
+func startTerminalProcess(cmd *exec.Cmd, spec *commandSpec, terminal *api.Terminal) (*process, error) {
+	if terminal.Term != "" {
+		cmd.Env = append(cmd.Env, "TERM="+terminal.Term)
+	}
+	// The pseudo-terminal makes the process a session leader, which is also the leader of a new process group.
+	if cmd.SysProcAttr != nil {
+		cmd.SysProcAttr.Setpgid = false
+	}
+	var tty *os.File
+	err := withUmask(cmd, spec.umask, func() (err error) {
+		tty, err = pty.StartWithSize(cmd, winsize(terminal.Size))
+		return err
+	})
+	if err != nil {
+		if tty != nil {
+			_ = tty.Close()
+		}
+		return nil, startError(err)
+	}
+	return &process{cmd: cmd, tty: tty, stdin: &ttyWriter{tty}, stdout: &ttyReader{tty}}, nil
+}
+
+// resize changes the window size of the process' pseudo-terminal.
+func (p *process) resize(size *api.WindowSize) error {
+	if p.tty == nil {
+		return status.Error(codes.FailedPrecondition, "process is not attached to a terminal")
+	}
+	if err := pty.Setsize(p.tty, winsize(size)); err != nil {
+		return status.Errorf(codes.Internal, "error resizing terminal: %v", err)
+	}
+	return nil
+}
+
+// signal sends the signal to the process' group.
+func (p *process) signal(sig api.Signal) error {
+	s, err := toSyscallSignal(sig)
+	if err != nil {
+		return err
+	}
+	if err := signalGroup(p.cmd, s); err != nil {
+		return status.Errorf(codes.Internal, "error sending signal: %v", err)
+	}
+	return nil
+}
+
+// wait waits for the process to exit and releases its pseudo-terminal.
+func (p *process) wait() error {
+	err := p.cmd.Wait()
+	if p.tty != nil {
+		_ = p.tty.Close()
+	}
+	return err
+}
+
+func winsize(size *api.WindowSize) *pty.Winsize {
+	if size == nil {
+		return nil
+	}
+	return &pty.Winsize{Rows: uint16(size.Rows), Cols: uint16(size.Cols)}
+}
+
+// ttyReader reads from a pseudo-terminal, reporting EOF once the terminal is hung up.
+// On Linux, reading from the terminal fails with EIO once all processes closed it.
+type ttyReader struct {
+	tty *os.File
+}
+
+func (r *ttyReader) Read(b []byte) (int, error) {
+	n, err := r.tty.Read(b)
+	if err != nil && n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// ttyWriter writes to a pseudo-terminal. Closing it sends an end of transmission
+// instead of closing the terminal, which would hang up the process.
+type ttyWriter struct {
+	tty *os.File
+}
+
+func (w *ttyWriter) Write(b []byte) (int, error) {
+	return w.tty.Write(b)
+}
+
+func (w *ttyWriter) Close() error {
+	_, err := w.tty.Write([]byte{endOfTransmission})
+	return err
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxExitedProcesses is the number of exited processes kept in the registry, so that they can still be
+// waited for and listed. Once exceeded, the process that exited first is dropped.
+const maxExitedProcesses = 100
+
+// processIDLength is the number of random bytes of a process ID.
+const processIDLength = 6
+
+// managedProcess is a process started detached from any call.
+type managedProcess struct {
+	id        string
+	name      string
+	command   []string
+	proc      *process
+	output    *outputLog
+	startedAt time.Time
+	// owner is the identity that started the process, which alone may access it.
+	owner string
+	// stdin reports whether the process' stdin is kept open for attaching.
+	stdin bool
+	// stdinMu serializes the input of concurrent attachers.
+	stdinMu sync.Mutex
+	// done is closed once the process exited and result is set.
+	done   chan struct{}
+	result *api.ExecuteResult
+}
+
+func (p *managedProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *managedProcess) info() *api.ProcessInfo {
+	info := &api.ProcessInfo{
+		Id:        p.id,
+		Name:      p.name,
+		Command:   p.command,
+		State:     api.ProcessState_PROCESS_STATE_RUNNING,
+		Pid:       int32(p.proc.cmd.Process.Pid),
+		StartedAt: timestamppb.New(p.startedAt),
+		Stdin:     p.stdin,
+	}
+	if p.exited() {
+		info.State = api.ProcessState_PROCESS_STATE_EXITED
+		info.Result = p.result
+	}
+	return info
+}
+
+// processRegistry tracks the processes started detached from any call.
+type processRegistry struct {
+	mu        sync.Mutex
+	processes map[string]*managedProcess
+	// exited lists the IDs of the exited processes in the order they exited.
+	exited []string
+}
+
+func newProcessRegistry() *processRegistry {
+	return &processRegistry{processes: make(map[string]*managedProcess)}
+}
+
+// reserve checks that the name is not taken and returns a new process ID.
+func (r *processRegistry) reserve(name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name != "" && r.lookupLocked(name) != nil {
+		return "", status.Errorf(codes.AlreadyExists, "process named %q already exists", name)
+	}
+	for {
+		b := make([]byte, processIDLength)
+		if _, err := rand.Read(b); err != nil {
+			return "", status.Errorf(codes.Internal, "error generating process id: %v", err)
+		}
+		if id := hex.EncodeToString(b); r.processes[id] == nil {
+			return id, nil
+		}
+	}
+}
+
+// add registers the started process. It fails if another process with the same name was added meanwhile.
+func (r *processRegistry) add(p *managedProcess) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.name != "" && r.lookupLocked(p.name) != nil {
+		return status.Errorf(codes.AlreadyExists, "process named %q already exists", p.name)
+	}
+	r.processes[p.id] = p
+	return nil
+}
+
+// finish records that the process exited and drops the oldest exited processes beyond the limit.
+func (r *processRegistry) finish(p *managedProcess, result *api.ExecuteResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.result = result
+	close(p.done)
+	r.exited = append(r.exited, p.id)
+	for len(r.exited) > maxExitedProcesses {
+		delete(r.processes, r.exited[0])
+		r.exited = r.exited[1:]
+	}
+}
+
+// lookup returns the process with the ID or name started by the owner.
+// Processes of other owners are reported as not found, so that their existence is not disclosed.
+func (r *processRegistry) lookup(idOrName, owner string) (*managedProcess, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p := r.lookupLocked(idOrName); p != nil && p.owner == owner {
+		return p, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "process %q not found", idOrName)
+}
+
+func (r *processRegistry) lookupLocked(idOrName string) *managedProcess {
+	if p, ok := r.processes[idOrName]; ok {
+		return p
+	}
+	for _, p := range r.processes {
+		if p.name == idOrName {
+			return p
+		}
+	}
+	return nil
+}
+
+// list returns the processes of the owner in the state, or all if unspecified, ordered by their start time.
+func (r *processRegistry) list(state api.ProcessState, owner string) []*api.ProcessInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]*api.ProcessInfo, 0, len(r.processes))
+	for _, p := range r.processes {
+		if p.owner != owner {
+			continue
+		}
+		info := p.info()
+		if state == api.ProcessState_PROCESS_STATE_UNSPECIFIED || info.State == state {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.AsTime().Before(infos[j].StartedAt.AsTime())
+	})
+	return infos
+}
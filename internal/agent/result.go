@@ -0,0 +1,30 @@
+package agent
+
+import (
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"os"
+	"syscall"
+	"time"
+)
+
+// newExecuteResult describes how the command with the given state terminated.
+func newExecuteResult(state *os.ProcessState, startedAt, finishedAt time.Time) *api.ExecuteResult {
+	result := &api.ExecuteResult{
+		Exited:     true,
+		ExitCode:   int32(state.ExitCode()),
+		StartedAt:  timestamppb.New(startedAt),
+		FinishedAt: timestamppb.New(finishedAt),
+		UserTime:   durationpb.New(state.UserTime()),
+		SystemTime: durationpb.New(state.SystemTime()),
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		result.Signal = toAPISignal(ws.Signal())
+		result.CoreDumped = ws.CoreDump()
+	}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		result.MaxRssBytes = maxRSSBytes(rusage)
+	}
+	return result
+}
@@ -0,0 +1,8 @@
+package agent
+
+import "syscall"
+
+// maxRSSBytes returns the maximum resident set size, which Linux reports in kilobytes.
+func maxRSSBytes(rusage *syscall.Rusage) int64 {
+	return rusage.Maxrss * 1024
+}
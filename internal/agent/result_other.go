@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import "syscall"
+
+// maxRSSBytes returns the maximum resident set size, which BSD derived systems report in bytes.
+func maxRSSBytes(rusage *syscall.Rusage) int64 {
+	return int64(rusage.Maxrss)
+}
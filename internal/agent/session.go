@@ -0,0 +1,390 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultSessionWindow is the initial window of a session's output, unless given by the client,
+// and of its stdin.
+const defaultSessionWindow = 256 * 1024
+
+func (s *server) ExecuteSessions(stream api.AgentService_ExecuteSessionsServer) error {
+	s.logger.Debug("Got execute sessions request")
+	ctx, cancel := context.WithCancel(stream.Context())
+	m := &sessionMux{server: s, ctx: ctx, stream: stream, sessions: make(map[uint32]*session)}
+	err := m.receive()
+	// Ending the stream kills the commands still running, which ends their sessions.
+	cancel()
+	m.stop()
+	m.wg.Wait()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// sessionMux runs the sessions of a stream.
+type sessionMux struct {
+	*server
+	ctx    context.Context
+	stream api.AgentService_ExecuteSessionsServer
+	sendMu sync.Mutex
+	// wg tracks the goroutines sending on the stream, which must finish before the call returns.
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	sessions map[uint32]*session
+}
+
+// session is a command executed within a stream.
+type session struct {
+	id     uint32
+	proc   *process
+	output *window
+	input  *sessionInput
+}
+
+func (m *sessionMux) send(resp *api.SessionResponse) error {
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+	return m.stream.Send(resp)
+}
+
+// receive handles the received frames until the stream ends or fails.
+func (m *sessionMux) receive() error {
+	for {
+		req, err := m.stream.Recv()
+		if err != nil {
+			return err
+		}
+		if req.Prepare != nil {
+			if err := m.start(req); err != nil {
+				return err
+			}
+			continue
+		}
+		m.mu.Lock()
+		sess := m.sessions[req.SessionId]
+		m.mu.Unlock()
+		if sess == nil {
+			// Frames may race with the end of their session.
+			continue
+		}
+		if err := m.apply(sess, req); err != nil {
+			return err
+		}
+	}
+}
+
+// start starts the command of a new session. Only failing to communicate fails the stream.
+func (m *sessionMux) start(req *api.SessionRequest) error {
+	m.mu.Lock()
+	_, exists := m.sessions[req.SessionId]
+	m.mu.Unlock()
+	if exists {
+		return status.Errorf(codes.InvalidArgument, "session %d already exists", req.SessionId)
+	}
+	m.logger.WithField("sessionId", req.SessionId).WithField("prepare", req.Prepare).Debug("Starting session")
+	spec := specFromPrepare(req.Prepare)
+	cmd, err := newCommand(spec)
+	if err != nil {
+		return m.sendError(req.SessionId, err)
+	}
+	startedAt := time.Now()
+	proc, err := startProcess(cmd, spec, req.Prepare.Terminal)
+	if err != nil {
+		return m.sendError(req.SessionId, err)
+	}
+	outputWindow := int64(req.WindowUpdate)
+	if outputWindow == 0 {
+		outputWindow = defaultSessionWindow
+	}
+	sess := &session{
+		id:     req.SessionId,
+		proc:   proc,
+		output: newWindow(outputWindow),
+		input:  newSessionInput(defaultSessionWindow),
+	}
+	m.mu.Lock()
+	m.sessions[sess.id] = sess
+	m.mu.Unlock()
+	stop := supervise(m.ctx, cmd, spec.timeout, spec.gracePeriod)
+	// The session's frames must not precede the started one.
+	err = m.send(&api.SessionResponse{
+		SessionId:    sess.id,
+		Started:      &api.SessionStarted{Pid: int32(cmd.Process.Pid)},
+		WindowUpdate: defaultSessionWindow,
+	})
+	m.wg.Add(2)
+	go m.run(sess, startedAt, stop)
+	go m.forwardInput(sess)
+	return err
+}
+
+func (m *sessionMux) sendError(id uint32, err error) error {
+	st := status.Convert(err)
+	return m.send(&api.SessionResponse{
+		SessionId: id,
+		Error:     &api.SessionError{Code: int32(st.Code()), Message: st.Message()},
+	})
+}
+
+// apply applies a frame to its running session.
+func (m *sessionMux) apply(sess *session, req *api.SessionRequest) error {
+	logger := m.logger.WithField("sessionId", sess.id)
+	if req.WindowUpdate != 0 {
+		sess.output.grant(int64(req.WindowUpdate))
+	}
+	if req.Signal != api.Signal_SIGNAL_UNSPECIFIED {
+		if err := sess.proc.signal(req.Signal); err != nil {
+			logger.WithError(err).WithField("signal", req.Signal).Debug("Error signalling command")
+		}
+	}
+	if req.Resize != nil {
+		if err := sess.proc.resize(req.Resize); err != nil {
+			logger.WithError(err).Debug("Error resizing terminal")
+		}
+	}
+	if req.Stdin != nil {
+		if !sess.input.push(req.Stdin.Data, req.Stdin.Close) {
+			return status.Errorf(codes.ResourceExhausted, "stdin of session %d exceeds its window", sess.id)
+		}
+	}
+	return nil
+}
+
+// run forwards the output of the session's command until it exited and sends its result.
+func (m *sessionMux) run(sess *session, startedAt time.Time, stop func() bool) {
+	defer m.wg.Done()
+	logger := m.logger.WithField("sessionId", sess.id)
+	outputErr := m.forwardOutputs(sess)
+	err := waitError(sess.proc.wait())
+	timedOut := stop()
+	sess.input.stop()
+	m.mu.Lock()
+	delete(m.sessions, sess.id)
+	m.mu.Unlock()
+	if outputErr != nil {
+		logger.WithError(outputErr).Debug("Error forwarding output")
+		return
+	}
+	if err != nil {
+		if err := m.sendError(sess.id, err); err != nil {
+			logger.WithError(err).Debug("Error sending session error")
+		}
+		return
+	}
+	result := newExecuteResult(sess.proc.cmd.ProcessState, startedAt, time.Now())
+	result.TimedOut = timedOut
+	logger.WithField("result", result).Debug("Session command exited")
+	if err := m.send(&api.SessionResponse{SessionId: sess.id, Result: result}); err != nil {
+		logger.WithError(err).Debug("Error sending session result")
+	}
+}
+
+// forwardOutputs forwards the stdout and stderr of the session's command until both are exhausted.
+func (m *sessionMux) forwardOutputs(sess *session) error {
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- m.forwardOutput(sess, sess.proc.stdout, func(output *api.ExecuteIO) *api.SessionResponse {
+			return &api.SessionResponse{SessionId: sess.id, Stdout: output}
+		})
+	}()
+	if sess.proc.stderr != nil {
+		go func() {
+			errCh <- m.forwardOutput(sess, sess.proc.stderr, func(output *api.ExecuteIO) *api.SessionResponse {
+				return &api.SessionResponse{SessionId: sess.id, Stderr: output}
+			})
+		}()
+	} else {
+		errCh <- nil
+	}
+	var outputErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil && outputErr == nil {
+			outputErr = err
+		}
+	}
+	return outputErr
+}
+
+// forwardOutput reads from r until EOF and sends the output as far as the session's window allows.
+// Once r is exhausted, a final frame with Close set is sent.
+func (m *sessionMux) forwardOutput(sess *session, r io.Reader, wrap func(*api.ExecuteIO) *api.SessionResponse) error {
+	buf := make([]byte, streamingOutputBufferSize)
+	for {
+		n, err := r.Read(buf)
+		for data := buf[:n]; len(data) > 0; {
+			granted := sess.output.acquire(len(data))
+			if granted == 0 {
+				return errors.New("stream ended")
+			}
+			chunk := make([]byte, granted)
+			copy(chunk, data)
+			if err := m.send(wrap(&api.ExecuteIO{Data: chunk})); err != nil {
+				return fmt.Errorf("error sending output: %w", err)
+			}
+			data = data[granted:]
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return fmt.Errorf("error reading output: %w", err)
+			}
+			if err := m.send(wrap(&api.ExecuteIO{Close: true})); err != nil {
+				return fmt.Errorf("error sending output close: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// forwardInput writes the input queued for the session to its command's stdin and grants the client
+// a window update for every written chunk.
+func (m *sessionMux) forwardInput(sess *session) {
+	defer m.wg.Done()
+	logger := m.logger.WithField("sessionId", sess.id)
+	for {
+		data, eof, ok := sess.input.next()
+		if !ok {
+			return
+		}
+		if len(data) != 0 {
+			if _, err := sess.proc.stdin.Write(data); err != nil {
+				logger.WithError(err).Debug("Error writing input to command")
+			}
+			resp := &api.SessionResponse{SessionId: sess.id, WindowUpdate: uint32(len(data))}
+			if err := m.send(resp); err != nil {
+				logger.WithError(err).Debug("Error sending window update")
+				return
+			}
+		}
+		if eof {
+			_ = sess.proc.stdin.Close()
+			return
+		}
+	}
+}
+
+// stop ends all sessions' flow control, so that their goroutines finish once the commands were killed.
+func (m *sessionMux) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sess := range m.sessions {
+		sess.output.close()
+		sess.input.stop()
+	}
+}
+
+// window tracks the number of bytes that may still be sent, which the receiver grants using window updates.
+type window struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	size   int64
+	closed bool
+}
+
+func newWindow(size int64) *window {
+	w := &window{size: size}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+func (w *window) grant(n int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.size += n
+	w.cond.Broadcast()
+}
+
+// acquire blocks until the window is open and takes up to max bytes from it.
+// It returns zero once the window was closed.
+func (w *window) acquire(max int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.size <= 0 && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return 0
+	}
+	n := int64(max)
+	if n > w.size {
+		n = w.size
+	}
+	w.size -= n
+	return int(n)
+}
+
+func (w *window) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.cond.Broadcast()
+}
+
+// sessionInput queues the stdin received for a session, so that a command not reading its stdin
+// does not block receiving frames of other sessions.
+type sessionInput struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	chunks [][]byte
+	// window is the number of bytes the client may still send.
+	window  int64
+	eof     bool
+	stopped bool
+}
+
+func newSessionInput(window int64) *sessionInput {
+	in := &sessionInput{window: window}
+	in.cond = sync.NewCond(&in.mu)
+	return in
+}
+
+// push queues the data and reports whether it fit into the window.
+func (in *sessionInput) push(data []byte, eof bool) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if int64(len(data)) > in.window {
+		return false
+	}
+	in.window -= int64(len(data))
+	if len(data) != 0 {
+		in.chunks = append(in.chunks, data)
+	}
+	in.eof = in.eof || eof
+	in.cond.Signal()
+	return true
+}
+
+// next blocks until data is queued or the input ended. It reports whether the input is exhausted once
+// the returned data is written, and returns false once stopped.
+func (in *sessionInput) next() (data []byte, eof bool, ok bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for len(in.chunks) == 0 && !in.eof && !in.stopped {
+		in.cond.Wait()
+	}
+	if in.stopped {
+		return nil, false, false
+	}
+	if len(in.chunks) != 0 {
+		data, in.chunks = in.chunks[0], in.chunks[1:]
+		// The window is granted again once the data was written.
+		in.window += int64(len(data))
+	}
+	return data, in.eof && len(in.chunks) == 0, true
+}
+
+func (in *sessionInput) stop() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.stopped = true
+	in.cond.Broadcast()
+}
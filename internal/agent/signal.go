@@ -0,0 +1,49 @@
+package agent
+
+import (
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"syscall"
+)
+
+var signals = map[api.Signal]syscall.Signal{
+	api.Signal_SIGNAL_HUP:  syscall.SIGHUP,
+	api.Signal_SIGNAL_INT:  syscall.SIGINT,
+	api.Signal_SIGNAL_QUIT: syscall.SIGQUIT,
+	api.Signal_SIGNAL_ILL:  syscall.SIGILL,
+	api.Signal_SIGNAL_TRAP: syscall.SIGTRAP,
+	api.Signal_SIGNAL_ABRT: syscall.SIGABRT,
+	api.Signal_SIGNAL_BUS:  syscall.SIGBUS,
+	api.Signal_SIGNAL_FPE:  syscall.SIGFPE,
+	api.Signal_SIGNAL_KILL: syscall.SIGKILL,
+	api.Signal_SIGNAL_USR1: syscall.SIGUSR1,
+	api.Signal_SIGNAL_SEGV: syscall.SIGSEGV,
+	api.Signal_SIGNAL_USR2: syscall.SIGUSR2,
+	api.Signal_SIGNAL_PIPE: syscall.SIGPIPE,
+	api.Signal_SIGNAL_ALRM: syscall.SIGALRM,
+	api.Signal_SIGNAL_TERM: syscall.SIGTERM,
+	api.Signal_SIGNAL_CONT: syscall.SIGCONT,
+	api.Signal_SIGNAL_STOP: syscall.SIGSTOP,
+	api.Signal_SIGNAL_TSTP: syscall.SIGTSTP,
+}
+
+// toSyscallSignal converts the api signal into the signal of the agent's platform.
+func toSyscallSignal(sig api.Signal) (syscall.Signal, error) {
+	s, ok := signals[sig]
+	if !ok {
+		return 0, status.Errorf(codes.InvalidArgument, "unsupported signal %v", sig)
+	}
+	return s, nil
+}
+
+// toAPISignal converts the signal of the agent's platform into the api signal.
+// Signals without an api equivalent are passed on as their raw number.
+func toAPISignal(sig syscall.Signal) api.Signal {
+	for s, syscallSig := range signals {
+		if syscallSig == sig {
+			return s
+		}
+	}
+	return api.Signal(sig)
+}
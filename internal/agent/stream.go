@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"sync"
+	"time"
+)
+
+const streamingOutputBufferSize = 32 * 1024
+
+// streamSender serializes sends on a command stream, as gRPC streams must not be
+// sent to from multiple goroutines at the same time.
+type streamSender struct {
+	mu     sync.Mutex
+	stream api.AgentService_ExecuteCommandStreamServer
+	// timestamps tags every output frame with the next sequence number and the time it was read.
+	timestamps bool
+	sequence   uint64
+}
+
+func (s *streamSender) Send(resp *api.ExecuteCommandStreamResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream.Send(resp)
+}
+
+// sendOutput sends the output read at the given time using the wrap function. The sequence number is
+// assigned while sending, so that frames are sent in the order of their sequence numbers.
+func (s *streamSender) sendOutput(
+	output *api.ExecuteIO, readAt time.Time, wrap func(*api.ExecuteIO) *api.ExecuteCommandStreamResponse,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timestamps {
+		s.sequence++
+		output.Sequence = s.sequence
+		output.Timestamp = timestamppb.New(readAt)
+	}
+	return s.stream.Send(wrap(output))
+}
+
+// forwardOutputs forwards the process' stdout and stderr until both are exhausted.
+// The first error encountered is returned.
+func forwardOutputs(proc *process, sender *streamSender) error {
+	errCh := make(chan error, 2)
+	go func() { errCh <- forwardOutput(proc.stdout, sender, wrapStdout) }()
+	if proc.stderr != nil {
+		go func() { errCh <- forwardOutput(proc.stderr, sender, wrapStderr) }()
+	} else {
+		errCh <- nil
+	}
+	var outputErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil && outputErr == nil {
+			outputErr = err
+		}
+	}
+	return outputErr
+}
+
+// forwardOutput reads from r until EOF and sends every chunk using the given wrap function.
+// Once r is exhausted, a final frame with Close set is sent.
+func forwardOutput(
+	r io.Reader, sender *streamSender, wrap func(*api.ExecuteIO) *api.ExecuteCommandStreamResponse,
+) error {
+	buf := make([]byte, streamingOutputBufferSize)
+	for {
+		n, err := r.Read(buf)
+		readAt := time.Now()
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			if err := sender.sendOutput(&api.ExecuteIO{Data: data}, readAt, wrap); err != nil {
+				return fmt.Errorf("error sending output: %w", err)
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return fmt.Errorf("error reading output: %w", err)
+			}
+			if err := sender.sendOutput(&api.ExecuteIO{Close: true}, readAt, wrap); err != nil {
+				return fmt.Errorf("error sending output close: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+func wrapStdout(output *api.ExecuteIO) *api.ExecuteCommandStreamResponse {
+	return &api.ExecuteCommandStreamResponse{Stdout: output}
+}
+
+func wrapStderr(output *api.ExecuteIO) *api.ExecuteCommandStreamResponse {
+	return &api.ExecuteCommandStreamResponse{Stderr: output}
+}
+
+// forwardInput receives stdin, signal and resize frames from the stream and applies them to the process.
+// The process' stdin is closed once a frame with Close set is received or the stream ends.
+func (s *server) forwardInput(stream api.AgentService_ExecuteCommandStreamServer, proc *process) {
+	defer proc.stdin.Close()
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger.WithError(err).Debug("Stopped receiving input")
+			}
+			return
+		}
+		if req.Signal != api.Signal_SIGNAL_UNSPECIFIED {
+			if err := proc.signal(req.Signal); err != nil {
+				s.logger.WithError(err).WithField("signal", req.Signal).Debug("Error signalling command")
+			}
+		}
+		if req.Resize != nil {
+			if err := proc.resize(req.Resize); err != nil {
+				s.logger.WithError(err).Debug("Error resizing terminal")
+			}
+		}
+		if req.Stdin == nil {
+			continue
+		}
+		if len(req.Stdin.Data) != 0 {
+			if _, err := proc.stdin.Write(req.Stdin.Data); err != nil {
+				s.logger.WithError(err).Debug("Error writing input to command")
+			}
+		}
+		if req.Stdin.Close {
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// umaskShimName is the argv[0] the agent executes itself with to apply a umask to a command.
+// The umask is shared by all goroutines of the agent, so it must only be changed in the child.
+const umaskShimName = "pyro-agent-umask-shim"
+
+// umaskShimErrorFd is the file descriptor the shim reports a failure to execute the command on.
+const umaskShimErrorFd = 3
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == umaskShimName {
+		runUmaskShim(os.Args[1:])
+	}
+}
+
+// runUmaskShim sets the umask given as first argument and executes the path given as second one with
+// the remaining arguments as argv. If executing fails, the errno is written to umaskShimErrorFd, which
+// is closed once the command was executed successfully.
+func runUmaskShim(args []string) {
+	errno := syscall.EINVAL
+	if len(args) >= 3 {
+		if umask, err := strconv.ParseUint(args[0], 8, 32); err == nil {
+			syscall.CloseOnExec(umaskShimErrorFd)
+			syscall.Umask(int(umask))
+			err = syscall.Exec(args[1], args[2:], os.Environ())
+			if e, ok := err.(syscall.Errno); ok {
+				errno = e
+			}
+		}
+	}
+	_, _ = fmt.Fprint(os.NewFile(umaskShimErrorFd, "error"), int(errno))
+	os.Exit(127)
+}
+
+// withUmask runs start, which starts cmd, so that the command gets the given umask. As changing the umask
+// of the agent would affect files created concurrently, the agent executes itself as shim, which applies
+// the umask before executing the command. Errors executing the command are returned like by cmd.Start.
+// If umask is nil, start is run as is.
+func withUmask(cmd *exec.Cmd, umask *uint32, start func() error) error {
+	if umask == nil {
+		return start()
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error locating the agent's executable: %w", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	path := cmd.Path
+	cmd.Args = append([]string{umaskShimName, strconv.FormatUint(uint64(*umask), 8), path}, cmd.Args...)
+	cmd.Path = self
+	cmd.ExtraFiles = []*os.File{w}
+	err = start()
+	_ = w.Close()
+	if err != nil {
+		return err
+	}
+	// Nothing is read once the command was executed, as the shim's end of the pipe is closed on exec.
+	report, err := io.ReadAll(r)
+	if err != nil || len(report) == 0 {
+		return err
+	}
+	_ = cmd.Wait()
+	errno, err := strconv.Atoi(string(report))
+	if err != nil {
+		return fmt.Errorf("invalid report of the umask shim %q", report)
+	}
+	return &os.PathError{Op: "fork/exec", Path: path, Err: syscall.Errno(errno)}
+}
@@ -0,0 +1,10 @@
+// Package version provides the version of the pyro build, which is set when linking, e.g. using
+// -ldflags "-X github.com/sirkrypt0/pyro/internal/version.Version=v0.1.0".
+package version
+
+var (
+	// Version is the version of the build.
+	Version = "dev"
+	// Commit is the git commit the build is based on.
+	Commit = "unknown"
+)
@@ -0,0 +1,445 @@
+// Package archive creates and safely extracts the tar archives used to transfer directories
+// between the pyro cli and the pyro agent.
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Compression is the compression applied to an archive.
+type Compression int
+
+const (
+	// None leaves the archive uncompressed.
+	None Compression = iota
+	// Gzip compresses the archive using gzip.
+	Gzip
+)
+
+// ParseCompression returns the compression with the name, i.e. none or gzip.
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "none":
+		return None, nil
+	case "gzip":
+		return Gzip, nil
+	default:
+		return None, fmt.Errorf("unknown compression %q", name)
+	}
+}
+
+func (c Compression) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Gzip:
+		return "gzip"
+	default:
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+}
+
+var (
+	// ErrUnsafePath is returned if an entry would be extracted outside of the destination.
+	ErrUnsafePath = errors.New("unsafe path")
+	// ErrDeviceNotAllowed is returned if an entry is a device node, but extracting them is not allowed.
+	ErrDeviceNotAllowed = errors.New("device nodes are not allowed")
+)
+
+// compress wraps w to compress everything written to it.
+func compress(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case None:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %v", c)
+	}
+}
+
+// decompress wraps r to decompress everything read from it.
+func decompress(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported compression %v", c)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Create writes a tar archive of the directory to w. Entries are named relative to the directory.
+// Sockets are skipped, as they cannot be archived.
+func Create(w io.Writer, dir string, c Compression) error {
+	return create(w, dir, c, func(add func(rel string) error) error {
+		return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			return add(rel)
+		})
+	})
+}
+
+// CreateEntries writes a tar archive of the entries of the directory to w. Entries are given
+// relative to the directory and are not descended into, so parents must precede their children.
+// Sockets are skipped, as they cannot be archived.
+func CreateEntries(w io.Writer, dir string, entries []string, c Compression) error {
+	return create(w, dir, c, func(add func(rel string) error) error {
+		for _, rel := range entries {
+			if err := add(filepath.FromSlash(rel)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// create writes a tar archive to w containing the entries passed to add by walk.
+func create(w io.Writer, dir string, c Compression, walk func(add func(rel string) error) error) error {
+	cw, err := compress(w, c)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	if err := walk(func(rel string) error { return addEntry(tw, dir, rel) }); err != nil {
+		return fmt.Errorf("error archiving %s: %w", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error archiving %s: %w", dir, err)
+	}
+	return cw.Close()
+}
+
+// addEntry writes the entry of the directory at the relative path to the archive.
+func addEntry(tw *tar.Writer, dir, rel string) error {
+	path := filepath.Join(dir, rel)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket != 0 {
+		return nil
+	}
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return copyFile(tw, path)
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ExtractOptions configures how an archive is extracted.
+type ExtractOptions struct {
+	Compression Compression
+	// AllowDevices allows extracting character and block devices.
+	AllowDevices bool
+	// PreserveOwner applies the owner of the entries, which usually requires root privileges.
+	PreserveOwner bool
+}
+
+// Stats describe an extracted archive.
+type Stats struct {
+	// Entries is the number of extracted entries.
+	Entries int64
+	// Bytes is the size of the content of the extracted regular files.
+	Bytes int64
+}
+
+// Extract extracts the tar archive read from r into the directory, which is created if missing.
+// Entries that would end up outside of the directory, either by their name or by following
+// symlinks, are rejected with ErrUnsafePath. Modes, modification times, symlinks and, if
+// requested, owners are preserved.
+func Extract(r io.Reader, dir string, opts ExtractOptions) (Stats, error) {
+	var stats Stats
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return stats, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return stats, err
+	}
+	dr, err := decompress(r, opts.Compression)
+	if err != nil {
+		return stats, err
+	}
+	defer dr.Close()
+	x := &extractor{dir: dir, opts: opts}
+	tr := tar.NewReader(dr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("error reading archive: %w", err)
+		}
+		n, err := x.extract(header, tr)
+		if err != nil {
+			return stats, fmt.Errorf("error extracting %s: %w", header.Name, err)
+		}
+		stats.Entries++
+		stats.Bytes += n
+	}
+	// Directories are modified while extracting their entries, so set their times last.
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(x.dirs[i].path, x.dirs[i].mtime, x.dirs[i].mtime); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+type extractedDir struct {
+	path  string
+	mtime time.Time
+}
+
+type extractor struct {
+	dir  string
+	opts ExtractOptions
+	dirs []extractedDir
+}
+
+// extract extracts a single entry and returns the number of content bytes written.
+func (x *extractor) extract(header *tar.Header, r io.Reader) (int64, error) {
+	path, err := x.resolve(header.Name)
+	if err != nil {
+		return 0, err
+	}
+	if path == x.dir {
+		// The archive's root describes the destination itself, which already exists.
+		return 0, nil
+	}
+	if header.Typeflag != tar.TypeDir {
+		// Never write through an existing entry, which may be a symlink pointing elsewhere.
+		if err := removeNonDir(path); err != nil {
+			return 0, err
+		}
+	}
+
+	var written int64
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(path, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return 0, err
+		}
+		if info, err := os.Lstat(path); err != nil {
+			return 0, err
+		} else if !info.IsDir() {
+			return 0, fmt.Errorf("%w: %s exists and is no directory", ErrUnsafePath, header.Name)
+		}
+		x.dirs = append(x.dirs, extractedDir{path: path, mtime: header.ModTime})
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return 0, err
+		}
+		written, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return written, err
+		}
+	case tar.TypeSymlink:
+		if err := x.checkSymlink(path, header.Linkname); err != nil {
+			return 0, err
+		}
+		if err := os.Symlink(header.Linkname, path); err != nil {
+			return 0, err
+		}
+		if x.opts.PreserveOwner {
+			return 0, os.Lchown(path, header.Uid, header.Gid)
+		}
+		return 0, nil
+	case tar.TypeLink:
+		target, err := x.resolve(header.Linkname)
+		if err != nil {
+			return 0, err
+		}
+		// Linking a symlink links the symlink itself, whose target is then resolved relative to the new path.
+		if info, err := os.Lstat(target); err != nil {
+			return 0, err
+		} else if info.Mode()&fs.ModeSymlink != 0 {
+			linkname, err := os.Readlink(target)
+			if err != nil {
+				return 0, err
+			}
+			if err := x.checkSymlink(path, linkname); err != nil {
+				return 0, err
+			}
+		}
+		// Links share the metadata of their target, so there is nothing left to apply.
+		return 0, os.Link(target, path)
+	case tar.TypeChar, tar.TypeBlock:
+		if !x.opts.AllowDevices {
+			return 0, ErrDeviceNotAllowed
+		}
+		if err := mknod(path, header); err != nil {
+			return 0, err
+		}
+	case tar.TypeFifo:
+		if err := mknod(path, header); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unsupported entry type %q", header.Typeflag)
+	}
+
+	if x.opts.PreserveOwner {
+		if err := os.Lchown(path, header.Uid, header.Gid); err != nil {
+			return written, err
+		}
+	}
+	// Chmod is not affected by the umask and must follow chown, which clears the setuid and setgid bits.
+	if err := os.Chmod(path, tarMode(header.Mode)); err != nil {
+		return written, err
+	}
+	if header.Typeflag != tar.TypeDir {
+		if err := os.Chtimes(path, header.ModTime, header.ModTime); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// resolve returns the path the entry name refers to within the destination.
+// It fails if the name leaves the destination or any of its parents is a symlink.
+func (x *extractor) resolve(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	path := filepath.Join(x.dir, clean)
+	// Previously extracted symlinks must not redirect later entries.
+	for parent := filepath.Dir(path); parent != x.dir && strings.HasPrefix(parent, x.dir); parent = filepath.Dir(parent) {
+		info, err := os.Lstat(parent)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: %s is below symlink %s", ErrUnsafePath, name, parent)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// checkSymlink fails if the symlink at path could point outside of the destination.
+// Checking the target's text is not enough, as it may pass through previously extracted symlinks and
+// later entries may replace those. So the target may only ascend by .. while all of its components so far
+// are existing directories, which cannot be replaced. Once it passes through a symlink, a file or a missing
+// entry, it may only descend, which keeps it within the destination as all symlinks are checked alike.
+func (x *extractor) checkSymlink(path, target string) error {
+	escapes := fmt.Errorf("%w: symlink to %s escapes the destination", ErrUnsafePath, target)
+	var current string
+	if filepath.IsAbs(target) {
+		if target != x.dir && !strings.HasPrefix(target, x.dir+string(filepath.Separator)) {
+			return escapes
+		}
+		current, target = x.dir, strings.TrimPrefix(target, x.dir)
+	} else {
+		current = filepath.Dir(path)
+	}
+	descending := false
+	for _, name := range strings.Split(target, string(filepath.Separator)) {
+		switch {
+		case name == "" || name == ".":
+		case name == ".." && (descending || current == x.dir):
+			return escapes
+		case name == "..":
+			current = filepath.Dir(current)
+		case descending:
+			current = filepath.Join(current, name)
+		default:
+			current = filepath.Join(current, name)
+			info, err := os.Lstat(current)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			descending = err != nil || !info.IsDir()
+		}
+	}
+	return nil
+}
+
+// removeNonDir removes the entry at path, if it exists and is no directory.
+func removeNonDir(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s exists and is a directory", path)
+	}
+	return os.Remove(path)
+}
+
+// tarMode converts the mode of a tar header into a file mode including the special bits.
+func tarMode(mode int64) fs.FileMode {
+	m := fs.FileMode(mode).Perm()
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
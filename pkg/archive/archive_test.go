@@ -0,0 +1,211 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateAndExtract(t *testing.T) {
+	src := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub", "empty"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "script"), []byte("#!/bin/sh\n"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("content"), 0o600))
+	require.NoError(t, os.Symlink("sub/script", filepath.Join(src, "link")))
+	require.NoError(t, os.Chtimes(filepath.Join(src, "file"), mtime, mtime))
+	require.NoError(t, os.Chmod(filepath.Join(src, "sub"), 0o711))
+
+	for _, compression := range []Compression{None, Gzip} {
+		t.Run(compression.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Create(&buf, src, compression))
+			dst := filepath.Join(t.TempDir(), "dst")
+			stats, err := Extract(&buf, dst, ExtractOptions{Compression: compression})
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), stats.Entries)
+			assert.Equal(t, int64(len("#!/bin/sh\n")+len("content")), stats.Bytes)
+
+			content, err := os.ReadFile(filepath.Join(dst, "link"))
+			require.NoError(t, err)
+			assert.Equal(t, "#!/bin/sh\n", string(content))
+			target, err := os.Readlink(filepath.Join(dst, "link"))
+			require.NoError(t, err)
+			assert.Equal(t, "sub/script", target)
+
+			info, err := os.Stat(filepath.Join(dst, "file"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+			assert.True(t, mtime.Equal(info.ModTime()))
+			info, err = os.Stat(filepath.Join(dst, "sub", "script"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+			info, err = os.Stat(filepath.Join(dst, "sub"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o711), info.Mode().Perm())
+			assert.DirExists(t, filepath.Join(dst, "sub", "empty"))
+		})
+	}
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		err     error
+	}{
+		{
+			name:    "parent",
+			headers: []*tar.Header{{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0o644}},
+			err:     ErrUnsafePath,
+		},
+		{
+			name:    "nested parent",
+			headers: []*tar.Header{{Name: "sub/../../escaped", Typeflag: tar.TypeReg, Mode: 0o644}},
+			err:     ErrUnsafePath,
+		},
+		{
+			name:    "absolute",
+			headers: []*tar.Header{{Name: "/etc/escaped", Typeflag: tar.TypeReg, Mode: 0o644}},
+			err:     ErrUnsafePath,
+		},
+		{
+			name:    "absolute symlink",
+			headers: []*tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+			err:     ErrUnsafePath,
+		},
+		{
+			name:    "relative symlink",
+			headers: []*tar.Header{{Name: "sub/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}},
+			err:     ErrUnsafePath,
+		},
+		{
+			name: "through symlink",
+			headers: []*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+				{Name: "link/escaped", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+			err: ErrUnsafePath,
+		},
+		{
+			name: "chained symlinks",
+			headers: []*tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir, Mode: 0o755},
+				{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0o755},
+				{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "a/b/l/../../.."},
+			},
+			err: ErrUnsafePath,
+		},
+		{
+			name: "symlink replaced later",
+			headers: []*tar.Header{
+				{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0o755},
+				{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "a/b"},
+				{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+				{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "."},
+			},
+			err: ErrUnsafePath,
+		},
+		{
+			name: "symlink created later",
+			headers: []*tar.Header{
+				{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "l/.."},
+				{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "."},
+			},
+			err: ErrUnsafePath,
+		},
+		{
+			name:    "hard link",
+			headers: []*tar.Header{{Name: "link", Typeflag: tar.TypeLink, Linkname: "../outside"}},
+			err:     ErrUnsafePath,
+		},
+		{
+			name: "hard link to symlink",
+			headers: []*tar.Header{
+				{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0o755},
+				{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: "../../x"},
+				{Name: "l2", Typeflag: tar.TypeLink, Linkname: "a/b/l"},
+			},
+			err: ErrUnsafePath,
+		},
+		{
+			name:    "device",
+			headers: []*tar.Header{{Name: "null", Typeflag: tar.TypeChar, Mode: 0o666, Devmajor: 1, Devminor: 3}},
+			err:     ErrDeviceNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "dst")
+			require.NoError(t, os.WriteFile(filepath.Join(parent, "outside"), nil, 0o644))
+
+			_, err := Extract(newArchive(t, tt.headers), dst, ExtractOptions{})
+			assert.ErrorIs(t, err, tt.err)
+			assert.NoFileExists(t, filepath.Join(parent, "escaped"))
+		})
+	}
+}
+
+func TestExtractSymlinksWithinDestination(t *testing.T) {
+	dst := t.TempDir()
+	entries := []*tar.Header{
+		{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "a/b/file", Typeflag: tar.TypeReg, Mode: 0o644},
+		{Name: "a/b/up", Typeflag: tar.TypeSymlink, Linkname: "../../a"},
+		{Name: "a/b/self", Typeflag: tar.TypeSymlink, Linkname: "up/b/file"},
+		{Name: "absolute", Typeflag: tar.TypeSymlink, Linkname: filepath.Join(dst, "a/b/../b/file")},
+		{Name: "a/b/linked", Typeflag: tar.TypeLink, Linkname: "a/b/self"},
+	}
+	_, err := Extract(newArchive(t, entries), dst, ExtractOptions{})
+	require.NoError(t, err)
+	for _, link := range []string{"a/b/self", "a/b/linked", "absolute"} {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(dst, link))
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dst, "a/b/file"), resolved)
+	}
+}
+
+func TestExtractReplacesSymlinks(t *testing.T) {
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "dst")
+	require.NoError(t, os.MkdirAll(dst, 0o755))
+	outside := filepath.Join(parent, "outside")
+	require.NoError(t, os.WriteFile(outside, []byte("original"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dst, "file")))
+
+	entries := []*tar.Header{{Name: "file", Typeflag: tar.TypeReg, Mode: 0o644}}
+	_, err := Extract(newArchive(t, entries), dst, ExtractOptions{})
+	require.NoError(t, err)
+	content, err := os.ReadFile(outside)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+	info, err := os.Lstat(filepath.Join(dst, "file"))
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+}
+
+func TestParseCompression(t *testing.T) {
+	c, err := ParseCompression("gzip")
+	require.NoError(t, err)
+	assert.Equal(t, Gzip, c)
+	_, err = ParseCompression("lz4")
+	assert.Error(t, err)
+}
+
+// newArchive returns an uncompressed archive of the entries, which have no content.
+func newArchive(t *testing.T, headers []*tar.Header) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range headers {
+		require.NoError(t, tw.WriteHeader(header))
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
@@ -0,0 +1,20 @@
+package archive
+
+import (
+	"archive/tar"
+	"golang.org/x/sys/unix"
+)
+
+// mknod creates the device node or fifo described by the header.
+func mknod(path string, header *tar.Header) error {
+	mode := uint32(header.Mode & 0o7777)
+	switch header.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+	return unix.Mknod(path, mode, int(unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))))
+}
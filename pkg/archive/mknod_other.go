@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"runtime"
+)
+
+// mknod is only supported on linux.
+func mknod(_ string, header *tar.Header) error {
+	return fmt.Errorf("extracting entries of type %q is not supported on %s", header.Typeflag, runtime.GOOS)
+}
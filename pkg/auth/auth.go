@@ -0,0 +1,154 @@
+// Package auth provides the bearer tokens authenticating clients of the pyro agent.
+// Tokens are either static ones listed in a file or short-lived ones signed with a shared HMAC secret.
+package auth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned if a token is unknown, malformed or its signature does not match.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned if a signed token is expired.
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Authenticator returns the identity a token belongs to.
+type Authenticator interface {
+	Authenticate(token string) (identity string, err error)
+}
+
+// Authenticators tries each of its authenticators in order and returns the first identity found.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(token string) (identity string, err error) {
+	err = ErrInvalidToken
+	for _, authenticator := range a {
+		identity, authErr := authenticator.Authenticate(token)
+		if authErr == nil {
+			return identity, nil
+		}
+		if !errors.Is(authErr, ErrInvalidToken) {
+			err = authErr
+		}
+	}
+	return "", err
+}
+
+// StaticTokens maps static tokens to the identities they belong to.
+type StaticTokens map[string]string
+
+// LoadStaticTokens reads a file containing lines of the form "IDENTITY TOKEN".
+// Empty lines and lines starting with # are ignored.
+func LoadStaticTokens(path string) (StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening token file: %w", err)
+	}
+	defer f.Close()
+	tokens := make(StaticTokens)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected IDENTITY TOKEN", path, line)
+		}
+		if _, ok := tokens[fields[1]]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate token", path, line)
+		}
+		tokens[fields[1]] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+	return tokens, nil
+}
+
+func (t StaticTokens) Authenticate(token string) (identity string, err error) {
+	// Compare all tokens in constant time to not leak which prefix matched.
+	for known, id := range t {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			identity = id
+		}
+	}
+	if identity == "" {
+		return "", ErrInvalidToken
+	}
+	return identity, nil
+}
+
+// HMACTokens authenticates short-lived tokens signed with a shared secret.
+// A token has the form IDENTITY.EXPIRY.SIGNATURE, where the identity is base64 encoded, the expiry is
+// a unix timestamp and the signature is the base64 encoded HMAC-SHA256 of the first two parts.
+type HMACTokens struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewHMACTokens creates an authenticator for tokens signed with the given secret.
+func NewHMACTokens(secret []byte) *HMACTokens {
+	return &HMACTokens{secret: secret, now: time.Now}
+}
+
+// LoadHMACSecret reads a secret from a file, ignoring surrounding whitespace.
+func LoadHMACSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading secret file: %w", err)
+	}
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("secret in %s must be at least 32 bytes long", path)
+	}
+	return secret, nil
+}
+
+// Issue creates a token for the identity, which is valid for the given duration.
+func (h *HMACTokens) Issue(identity string, validity time.Duration) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(identity)) + "." +
+		strconv.FormatInt(h.now().Add(validity).Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(h.sign(payload))
+}
+
+func (h *HMACTokens) Authenticate(token string) (identity string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, h.sign(parts[0]+"."+parts[1])) {
+		return "", ErrInvalidToken
+	}
+	id, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(id) == 0 {
+		return "", ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if !h.now().Before(time.Unix(expiry, 0)) {
+		return "", ErrExpiredToken
+	}
+	return string(id), nil
+}
+
+func (h *HMACTokens) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("# ci runners\nci s3cret\n\nadmin  t0p-s3cret\n"), 0o600))
+	tokens, err := LoadStaticTokens(path)
+	require.NoError(t, err)
+
+	identity, err := tokens.Authenticate("s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "ci", identity)
+	identity, err = tokens.Authenticate("t0p-s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", identity)
+	_, err = tokens.Authenticate("s3cre")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLoadStaticTokensErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing token":   "ci\n",
+		"duplicate token": "ci token\nadmin token\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			_, err := LoadStaticTokens(path)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestHMACTokens(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	tokens := NewHMACTokens(secret)
+	token := tokens.Issue("ci.runner", time.Minute)
+
+	identity, err := tokens.Authenticate(token)
+	require.NoError(t, err)
+	assert.Equal(t, "ci.runner", identity)
+
+	_, err = NewHMACTokens([]byte(strings.Repeat("x", 32))).Authenticate(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	parts := strings.Split(token, ".")
+	parts[1] = "99999999999"
+	_, err = tokens.Authenticate(strings.Join(parts, "."))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = tokens.Authenticate("garbage")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	tokens.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = tokens.Authenticate(token)
+	assert.ErrorIs(t, err, ErrExpiredToken)
+}
+
+func TestLoadHMACSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("too short\n"), 0o600))
+	_, err := LoadHMACSecret(path)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("s", 32)+"\n"), 0o600))
+	secret, err := LoadHMACSecret(path)
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+}
+
+func TestAuthenticators(t *testing.T) {
+	hmacTokens := NewHMACTokens([]byte(strings.Repeat("s", 32)))
+	authenticators := Authenticators{StaticTokens{"static": "admin"}, hmacTokens}
+
+	identity, err := authenticators.Authenticate("static")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", identity)
+	identity, err = authenticators.Authenticate(hmacTokens.Issue("ci", time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "ci", identity)
+
+	_, err = authenticators.Authenticate(hmacTokens.Issue("ci", -time.Minute))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	_, err = authenticators.Authenticate("unknown")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
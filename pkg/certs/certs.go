@@ -0,0 +1,78 @@
+// Package certs provides the TLS configurations for mutual TLS between the pyro cli and the pyro agent
+// and generates throwaway certificates for development setups.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrIncompleteFiles is returned if only some of the certificate, key and CA files are given.
+var ErrIncompleteFiles = errors.New("either all or none of the certificate, key and CA files must be given")
+
+// Files are the paths to the PEM encoded files required for mutual TLS.
+type Files struct {
+	// Cert is the certificate presented to the peer.
+	Cert string
+	// Key is the private key of Cert.
+	Key string
+	// CA is the certificate of the authority the peer's certificate must be signed by.
+	CA string
+}
+
+// Enabled returns whether any of the files is set, i.e. whether TLS should be used.
+func (f Files) Enabled() bool {
+	return f.Cert != "" || f.Key != "" || f.CA != ""
+}
+
+// ServerConfig loads the files and returns a configuration for the agent,
+// which requires clients to present a certificate signed by the CA.
+func ServerConfig(files Files) (*tls.Config, error) {
+	cert, pool, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// ClientConfig loads the files and returns a configuration for connecting to the agent,
+// whose certificate must be signed by the CA and valid for serverName.
+func ClientConfig(files Files, serverName string) (*tls.Config, error) {
+	cert, pool, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+func load(files Files) (tls.Certificate, *x509.CertPool, error) {
+	if files.Cert == "" || files.Key == "" || files.CA == "" {
+		return tls.Certificate{}, nil, ErrIncompleteFiles
+	}
+	cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("error loading certificate: %w", err)
+	}
+	ca, err := os.ReadFile(files.CA)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("error reading CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return tls.Certificate{}, nil, fmt.Errorf("no certificates found in CA file %s", files.CA)
+	}
+	return cert, pool, nil
+}
@@ -0,0 +1,124 @@
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	server, client, err := Generate(dir, GenerateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, CACertFile), server.CA)
+	assert.Equal(t, server.CA, client.CA)
+
+	info, err := os.Stat(filepath.Join(dir, CAKeyFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Existing files are only replaced if requested.
+	_, _, err = Generate(dir, GenerateOptions{})
+	assert.ErrorIs(t, err, os.ErrExist)
+	_, _, err = Generate(dir, GenerateOptions{Overwrite: true})
+	assert.NoError(t, err)
+}
+
+func TestMutualTLS(t *testing.T) {
+	server, client, err := Generate(t.TempDir(), GenerateOptions{})
+	require.NoError(t, err)
+	serverConfig, err := ServerConfig(server)
+	require.NoError(t, err)
+	clientConfig, err := ClientConfig(client, "localhost")
+	require.NoError(t, err)
+
+	state, err := handshake(t, serverConfig, clientConfig)
+	require.NoError(t, err)
+	require.Len(t, state.PeerCertificates, 1)
+	assert.Equal(t, DefaultClientName, state.PeerCertificates[0].Subject.CommonName)
+}
+
+func TestMutualTLSRejectsUntrustedPeers(t *testing.T) {
+	server, client, err := Generate(t.TempDir(), GenerateOptions{})
+	require.NoError(t, err)
+	_, other, err := Generate(t.TempDir(), GenerateOptions{})
+	require.NoError(t, err)
+	serverConfig, err := ServerConfig(server)
+	require.NoError(t, err)
+
+	t.Run("client without certificate", func(t *testing.T) {
+		clientConfig, err := ClientConfig(client, "localhost")
+		require.NoError(t, err)
+		clientConfig.Certificates = nil
+		_, err = handshake(t, serverConfig, clientConfig)
+		assert.Error(t, err)
+	})
+	t.Run("client signed by other CA", func(t *testing.T) {
+		clientConfig, err := ClientConfig(Files{Cert: other.Cert, Key: other.Key, CA: client.CA}, "localhost")
+		require.NoError(t, err)
+		_, err = handshake(t, serverConfig, clientConfig)
+		assert.Error(t, err)
+	})
+	t.Run("server with wrong name", func(t *testing.T) {
+		clientConfig, err := ClientConfig(client, "example.com")
+		require.NoError(t, err)
+		_, err = handshake(t, serverConfig, clientConfig)
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigRequiresAllFiles(t *testing.T) {
+	_, err := ServerConfig(Files{Cert: "server.crt", Key: "server.key"})
+	assert.ErrorIs(t, err, ErrIncompleteFiles)
+	_, err = ClientConfig(Files{CA: "ca.crt"}, "localhost")
+	assert.ErrorIs(t, err, ErrIncompleteFiles)
+	assert.False(t, Files{}.Enabled())
+	assert.True(t, Files{CA: "ca.crt"}.Enabled())
+}
+
+// handshake performs a TLS handshake between the configurations and returns the connection state
+// seen by the server. It fails if either side fails the handshake.
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer l.Close()
+
+	type result struct {
+		state tls.ConnectionState
+		err   error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		srv := conn.(*tls.Conn)
+		err = srv.Handshake()
+		// Closing lets the client know about the outcome.
+		_ = srv.Close()
+		resultCh <- result{state: srv.ConnectionState(), err: err}
+	}()
+
+	cli, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err == nil {
+		// With TLS 1.3, the client only learns about a rejected certificate when reading.
+		_, err = cli.Read(make([]byte, 1))
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		_ = cli.Close()
+	}
+	res := <-resultCh
+	if res.err != nil {
+		return tls.ConnectionState{}, res.err
+	}
+	return res.state, err
+}
@@ -0,0 +1,174 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Names of the files written by Generate.
+const (
+	CACertFile     = "ca.crt"
+	CAKeyFile      = "ca.key"
+	ServerCertFile = "server.crt"
+	ServerKeyFile  = "server.key"
+	ClientCertFile = "client.crt"
+	ClientKeyFile  = "client.key"
+)
+
+const (
+	// DefaultValidity is the default duration the generated certificates are valid for.
+	DefaultValidity = 365 * 24 * time.Hour
+	// DefaultClientName is the default common name of the generated client certificate.
+	DefaultClientName = "pyro"
+)
+
+// DefaultHosts are the default names the generated server certificate is valid for.
+var DefaultHosts = []string{"localhost", "127.0.0.1"}
+
+// GenerateOptions configures the certificates created by Generate.
+type GenerateOptions struct {
+	// Hosts are the DNS names and IP addresses the server certificate is valid for.
+	Hosts []string
+	// ClientName is the common name of the client certificate.
+	ClientName string
+	// Validity is the duration the certificates are valid for.
+	Validity time.Duration
+	// Overwrite allows replacing existing files.
+	Overwrite bool
+}
+
+// Generate creates a throwaway CA and a server and client certificate signed by it in dir.
+// It is meant for development setups only. It returns the files to be used by the agent and the cli.
+func Generate(dir string, opts GenerateOptions) (server, client Files, err error) {
+	if len(opts.Hosts) == 0 {
+		opts.Hosts = DefaultHosts
+	}
+	if opts.ClientName == "" {
+		opts.ClientName = DefaultClientName
+	}
+	if opts.Validity <= 0 {
+		opts.Validity = DefaultValidity
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Files{}, Files{}, fmt.Errorf("error creating directory: %w", err)
+	}
+	g := &generator{dir: dir, opts: opts, notBefore: time.Now().Add(-time.Minute)}
+
+	caTemplate := g.template(pkix.Name{CommonName: "pyro development CA"})
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caCert, caKey, err := g.issue(caTemplate, nil, nil, CACertFile, CAKeyFile)
+	if err != nil {
+		return Files{}, Files{}, err
+	}
+
+	serverTemplate := g.template(pkix.Name{CommonName: opts.Hosts[0]})
+	serverTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			serverTemplate.IPAddresses = append(serverTemplate.IPAddresses, ip)
+		} else {
+			serverTemplate.DNSNames = append(serverTemplate.DNSNames, host)
+		}
+	}
+	if _, _, err := g.issue(serverTemplate, caCert, caKey, ServerCertFile, ServerKeyFile); err != nil {
+		return Files{}, Files{}, err
+	}
+
+	clientTemplate := g.template(pkix.Name{CommonName: opts.ClientName})
+	clientTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if _, _, err := g.issue(clientTemplate, caCert, caKey, ClientCertFile, ClientKeyFile); err != nil {
+		return Files{}, Files{}, err
+	}
+
+	server = Files{Cert: g.path(ServerCertFile), Key: g.path(ServerKeyFile), CA: g.path(CACertFile)}
+	client = Files{Cert: g.path(ClientCertFile), Key: g.path(ClientKeyFile), CA: g.path(CACertFile)}
+	return server, client, nil
+}
+
+type generator struct {
+	dir       string
+	opts      GenerateOptions
+	notBefore time.Time
+}
+
+func (g *generator) path(name string) string {
+	return filepath.Join(g.dir, name)
+}
+
+func (g *generator) template(subject pkix.Name) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:   subject,
+		NotBefore: g.notBefore,
+		NotAfter:  g.notBefore.Add(g.opts.Validity),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+}
+
+// issue creates a key and a certificate for it from the template and writes both.
+// The certificate is signed by the parent, or self-signed if parent is nil.
+func (g *generator) issue(
+	template, parent *x509.Certificate, parentKey crypto.Signer, certFile, keyFile string,
+) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key: %w", err)
+	}
+	template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating certificate %s: %w", certFile, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing certificate %s: %w", certFile, err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding key %s: %w", keyFile, err)
+	}
+	if err := g.writePEM(certFile, "CERTIFICATE", der, 0o644); err != nil {
+		return nil, nil, err
+	}
+	if err := g.writePEM(keyFile, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func (g *generator) writePEM(name, blockType string, der []byte, perm os.FileMode) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if g.opts.Overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(g.path(name), flags, perm)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", name, err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"io"
+	"time"
+)
+
+const (
+	// DefaultReattachAttempts is the default number of consecutive attempts to reattach to a process
+	// after the connection to the agent was lost.
+	DefaultReattachAttempts = 10
+	reattachBackoff         = 100 * time.Millisecond
+	maxReattachBackoff      = 5 * time.Second
+)
+
+// AttachOption configures attaching to a process.
+type AttachOption func(*attachOptions)
+
+type attachOptions struct {
+	offset   *uint64
+	attempts int
+}
+
+func newAttachOptions(opts []AttachOption) *attachOptions {
+	o := &attachOptions{attempts: DefaultReattachAttempts}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithOffset replays the output of the process from the offset, which counts the bytes of stdout and
+// stderr combined. If the output at the offset is no longer buffered, the replay starts at the oldest
+// buffered output.
+func WithOffset(offset uint64) AttachOption {
+	return func(o *attachOptions) {
+		o.offset = &offset
+	}
+}
+
+// WithFromStart replays the output of the process from the oldest buffered output.
+func WithFromStart() AttachOption {
+	return WithOffset(0)
+}
+
+// WithReattachAttempts sets the number of consecutive attempts to reattach to the process after the
+// connection to the agent was lost. Zero disables reattaching.
+func WithReattachAttempts(attempts int) AttachOption {
+	return func(o *attachOptions) {
+		o.attempts = attempts
+	}
+}
+
+// AttachProcess writes the output of the process with the ID or name to stdout and stderr until the
+// process exited and returns it. By default, only output written after attaching is written, see
+// WithOffset and WithFromStart. If stdin is not nil and the process was started using WithOpenStdin,
+// everything read from stdin is forwarded to the process, whose stdin is closed once stdin is exhausted.
+// If the connection to the agent is lost, AttachProcess transparently reattaches and continues from
+// the last received output, see WithReattachAttempts. Input read meanwhile is sent once reattached.
+func (c *Client) AttachProcess(
+	ctx context.Context, id string, stdin io.Reader, stdout, stderr io.Writer, opts ...AttachOption,
+) (*Process, error) {
+	return c.attachProcess(ctx, id, stdin, stdout, stderr, true, newAttachOptions(opts))
+}
+
+// ProcessOutput writes the buffered output of the process with the ID or name to stdout and stderr
+// and returns the process, which may still be running. By default, the output is written from the
+// oldest buffered output on, see WithOffset.
+func (c *Client) ProcessOutput(
+	ctx context.Context, id string, stdout, stderr io.Writer, opts ...AttachOption,
+) (*Process, error) {
+	options := newAttachOptions(append([]AttachOption{WithFromStart()}, opts...))
+	return c.attachProcess(ctx, id, nil, stdout, stderr, false, options)
+}
+
+func (c *Client) attachProcess(
+	ctx context.Context, id string, stdin io.Reader, stdout, stderr io.Writer, follow bool, o *attachOptions,
+) (*Process, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_ATTACH); err != nil {
+		return nil, err
+	}
+	// Stops reading stdin once attaching ended.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a := &attachment{id: id, follow: follow, offset: o.offset, stdout: stdout, stderr: stderr}
+	if stdin != nil {
+		a.input = newAttachInput(ctx, stdin)
+	}
+	backoff, failures := reattachBackoff, 0
+	for {
+		p, err := a.attach(ctx, c)
+		if err == nil {
+			return p, nil
+		}
+		if a.attached {
+			// Only consecutive failures to reach the agent count.
+			backoff, failures = reattachBackoff, 0
+		}
+		if statusCode(err) != codes.Unavailable || failures >= o.attempts {
+			return nil, fmt.Errorf("error attaching to process: %w", err)
+		}
+		failures++
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error attaching to process: %w", ctx.Err())
+		}
+		if backoff *= 2; backoff > maxReattachBackoff {
+			backoff = maxReattachBackoff
+		}
+	}
+}
+
+// attachment is the state of attaching to a process, which is kept when reattaching.
+type attachment struct {
+	id     string
+	follow bool
+	// offset is the offset to continue the output from, nil for the end of the buffered output.
+	offset *uint64
+	stdout io.Writer
+	stderr io.Writer
+	input  *attachInput
+	// attached reports whether the last attempt reached the process.
+	attached bool
+}
+
+// attach attaches to the process once and forwards output and input until the stream ends.
+func (a *attachment) attach(ctx context.Context, c *Client) (*Process, error) {
+	a.attached = false
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.agent.AttachProcess(ctx, c.callOpts...)
+	if err != nil {
+		return nil, err
+	}
+	opts := &agentv1.AttachProcessRequest_Options{Id: a.id, Offset: a.offset, Follow: a.follow}
+	if err := stream.Send(&agentv1.AttachProcessRequest{Options: opts}); err != nil {
+		return nil, closeAndRecvError(func() error { _, err := stream.Recv(); return err }, err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Process == nil {
+		return nil, errors.New("first response contains no process")
+	}
+	a.attached = true
+	p := newProcess(resp.Process)
+	offset := resp.Offset
+	a.offset = &offset
+	if a.input != nil && p.Stdin {
+		forwarded := make(chan struct{})
+		go func() {
+			a.input.forward(ctx, stream)
+			close(forwarded)
+		}()
+		defer func() {
+			cancel()
+			<-forwarded
+		}()
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return p, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if resp.Process != nil {
+			p = newProcess(resp.Process)
+		}
+		if err := writeAttachOutput(resp.Stdout, a.stdout, resp.Offset, a.offset); err != nil {
+			return nil, fmt.Errorf("error writing to stdout: %w", err)
+		}
+		if err := writeAttachOutput(resp.Stderr, a.stderr, resp.Offset, a.offset); err != nil {
+			return nil, fmt.Errorf("error writing to stderr: %w", err)
+		}
+	}
+}
+
+// writeAttachOutput writes the output starting at the offset to w and advances next past it.
+func writeAttachOutput(output *agentv1.ExecuteIO, w io.Writer, offset uint64, next *uint64) error {
+	if output == nil || len(output.Data) == 0 {
+		return nil
+	}
+	*next = offset + uint64(len(output.Data))
+	_, err := w.Write(output.Data)
+	return err
+}
+
+// attachInput reads the input forwarded to a process, which is kept across reattaching.
+type attachInput struct {
+	frames chan *agentv1.ExecuteIO
+	// pending is the frame that could not be sent before the connection was lost.
+	pending *agentv1.ExecuteIO
+	// done is closed once reading stopped.
+	done chan struct{}
+}
+
+// newAttachInput reads r until it is exhausted or ctx is done. A read in progress when ctx is done
+// cannot be interrupted, but its input is dropped and r is not read any further.
+func newAttachInput(ctx context.Context, r io.Reader) *attachInput {
+	in := &attachInput{frames: make(chan *agentv1.ExecuteIO), done: make(chan struct{})}
+	go func() {
+		defer close(in.done)
+		for ctx.Err() == nil {
+			buf := make([]byte, streamingInputBufferSize)
+			n, err := r.Read(buf)
+			if n > 0 && !in.send(ctx, &agentv1.ExecuteIO{Data: buf[:n]}) {
+				return
+			}
+			if err != nil {
+				in.send(ctx, &agentv1.ExecuteIO{Close: true})
+				return
+			}
+		}
+	}()
+	return in
+}
+
+// send hands the frame to forward and reports whether it was taken before ctx was done.
+func (in *attachInput) send(ctx context.Context, frame *agentv1.ExecuteIO) bool {
+	select {
+	case in.frames <- frame:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// forward sends the input on the stream until ctx is done or sending fails.
+func (in *attachInput) forward(ctx context.Context, stream agentv1.AgentService_AttachProcessClient) {
+	for {
+		if in.pending == nil {
+			select {
+			case in.pending = <-in.frames:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := stream.Send(&agentv1.AttachProcessRequest{Stdin: in.pending}); err != nil {
+			return
+		}
+		in.pending = nil
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeAttachAgent answers each AttachProcess call with the next scripted stream.
+type fakeAttachAgent struct {
+	fakeAgent
+	streams []*fakeAttachStream
+	options []*agentv1.AttachProcessRequest_Options
+}
+
+func (f *fakeAttachAgent) AttachProcess(
+	_ context.Context, _ ...grpc.CallOption,
+) (agentv1.AgentService_AttachProcessClient, error) {
+	if len(f.streams) == 0 {
+		return nil, status.Error(codes.Unavailable, "no more streams")
+	}
+	stream := f.streams[0]
+	f.streams = f.streams[1:]
+	stream.agent = f
+	return stream, nil
+}
+
+// fakeAttachStream returns the responses followed by err.
+type fakeAttachStream struct {
+	agentv1.AgentService_AttachProcessClient
+	agent     *fakeAttachAgent
+	responses []*agentv1.AttachProcessResponse
+	err       error
+}
+
+func (s *fakeAttachStream) Send(req *agentv1.AttachProcessRequest) error {
+	if req.Options != nil {
+		s.agent.options = append(s.agent.options, req.Options)
+	}
+	return nil
+}
+
+func (s *fakeAttachStream) Recv() (*agentv1.AttachProcessResponse, error) {
+	if len(s.responses) == 0 {
+		return nil, s.err
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+func TestAttachProcessReattaches(t *testing.T) {
+	running := &agentv1.ProcessInfo{Id: "p", State: agentv1.ProcessState_PROCESS_STATE_RUNNING}
+	exited := &agentv1.ProcessInfo{
+		Id: "p", State: agentv1.ProcessState_PROCESS_STATE_EXITED, Result: &agentv1.ExecuteResult{ExitCode: 3},
+	}
+	agent := &fakeAttachAgent{
+		fakeAgent: fakeAgent{infoErr: status.Error(codes.Unimplemented, "legacy")},
+		streams: []*fakeAttachStream{
+			{responses: []*agentv1.AttachProcessResponse{
+				{Process: running, Offset: 5},
+				{Stdout: &agentv1.ExecuteIO{Data: []byte("abc")}, Offset: 5},
+				{Stderr: &agentv1.ExecuteIO{Data: []byte("de")}, Offset: 8},
+			}, err: status.Error(codes.Unavailable, "connection lost")},
+			{responses: []*agentv1.AttachProcessResponse{
+				{Process: running, Offset: 10},
+				{Stdout: &agentv1.ExecuteIO{Data: []byte("f")}, Offset: 10},
+				{Process: exited},
+			}, err: io.EOF},
+		},
+	}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+	var stdout, stderr bytes.Buffer
+	p, err := c.AttachProcess(context.Background(), "p", nil, &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "abcf", stdout.String())
+	assert.Equal(t, "de", stderr.String())
+	require.NotNil(t, p.Result)
+	assert.Equal(t, 3, p.Result.ExitCode)
+
+	require.Len(t, agent.options, 2)
+	assert.Nil(t, agent.options[0].Offset)
+	require.NotNil(t, agent.options[1].Offset)
+	assert.Equal(t, uint64(10), *agent.options[1].Offset)
+	assert.True(t, agent.options[1].Follow)
+}
+
+func TestAttachProcessGivesUpReattaching(t *testing.T) {
+	agent := &fakeAttachAgent{fakeAgent: fakeAgent{infoErr: status.Error(codes.Unimplemented, "legacy")}}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+	_, err = c.AttachProcess(context.Background(), "p", nil, io.Discard, io.Discard, WithReattachAttempts(2))
+	assert.Equal(t, codes.Unavailable, statusCode(err))
+
+	agent.streams = []*fakeAttachStream{{err: status.Error(codes.NotFound, "not found")}}
+	_, err = c.ProcessOutput(context.Background(), "p", io.Discard, io.Discard)
+	assert.Equal(t, codes.NotFound, statusCode(err))
+	assert.Empty(t, agent.streams)
+}
+
+// endlessReader returns input on every read, like a terminal the user keeps typing into.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	return copy(p, "x"), nil
+}
+
+func TestAttachInputStopsReading(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in := newAttachInput(ctx, endlessReader{})
+	assert.Equal(t, []byte("x"), (<-in.frames).Data)
+
+	cancel()
+	select {
+	case <-in.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("input is still read after ctx is done")
+	}
+}
@@ -2,12 +2,33 @@ package client
 
 import (
 	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"sync"
 )
 
 type Client struct {
-	agent agentv1.AgentServiceClient
+	agent    agentv1.AgentServiceClient
+	callOpts []grpc.CallOption
+
+	capsMu sync.Mutex
+	caps   *capabilities
+}
+
+// Option configures the client.
+type Option func(*Client)
+
+// WithPerRPCCredentials attaches the credentials to every call made by the client.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) Option {
+	return func(c *Client) {
+		c.callOpts = append(c.callOpts, grpc.PerRPCCredentials(creds))
+	}
 }
 
-func NewClient(agent agentv1.AgentServiceClient) (*Client, error) {
-	return &Client{agent: agent}, nil
+func NewClient(agent agentv1.AgentServiceClient, opts ...Option) (*Client, error) {
+	c := &Client{agent: agent}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
@@ -0,0 +1,328 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrAlreadyStarted is returned when starting a RemoteCmd or creating its pipes after it was started.
+	ErrAlreadyStarted = errors.New("command already started")
+	// ErrNotStarted is returned when waiting for a RemoteCmd that was not started.
+	ErrNotStarted = errors.New("command not started")
+	// ErrAlreadyWaited is returned when waiting for a RemoteCmd more than once.
+	ErrAlreadyWaited = errors.New("command was already waited for")
+)
+
+// RemoteCmd is a command executed on the agent, which is used like exec.Cmd.
+// A RemoteCmd cannot be reused after calling its Run, Output or CombinedOutput methods.
+type RemoteCmd struct {
+	// Path is the command executed on the agent, which resolves it using its PATH if it contains no slash.
+	Path string
+	// Args holds the command line arguments including the command as Args[0].
+	Args []string
+	// Env holds the environment of the command as key=value pairs, which replaces the agent's environment.
+	// If Env is nil, the command inherits the agent's environment. Start fails for entries of another form.
+	Env []string
+	// Dir is the working directory of the command on the agent. If empty, the agent's one is used.
+	Dir string
+	// Stdin is forwarded to the command's stdin. If nil, the command reads from an empty input.
+	Stdin io.Reader
+	// Stdout and Stderr receive the command's output. If nil, the output is discarded.
+	// If both are the same writer, at most one goroutine at a time writes to it.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Options configure the execution beyond the fields, e.g. the user or a timeout.
+	Options []ExecOption
+	// Result describes how the command terminated, available after a call to Wait or Run.
+	Result *Result
+
+	client      *Client
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan error
+	waited      bool
+	closeOnExit []*io.PipeWriter
+	closeOnWait []io.Closer
+}
+
+// Command returns the RemoteCmd to execute the named command with the given arguments on the agent.
+// The command is killed once ctx is done before it exits on its own.
+func (c *Client) Command(ctx context.Context, name string, args ...string) *RemoteCmd {
+	return &RemoteCmd{
+		Path:   name,
+		Args:   append([]string{name}, args...),
+		client: c,
+		ctx:    ctx,
+	}
+}
+
+// String returns a human readable description of the command.
+func (c *RemoteCmd) String() string {
+	return strings.Join(append([]string{c.Path}, c.args()...), " ")
+}
+
+func (c *RemoteCmd) args() []string {
+	if len(c.Args) == 0 {
+		return nil
+	}
+	return c.Args[1:]
+}
+
+// Run starts the command and waits for it to complete.
+// The error is a *RemoteExitError if the command ran, but did not exit successfully.
+func (c *RemoteCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Start starts the command, but does not wait for it to complete. Errors starting the process on the agent,
+// e.g. because the executable does not exist, are returned by Start if the agent confirms the start of
+// commands. Otherwise, as for agents predating the confirmation, they are returned by Wait.
+func (c *RemoteCmd) Start() error {
+	if c.client == nil || c.ctx == nil {
+		return errors.New("command must be created by Client.Command")
+	}
+	if c.done != nil {
+		return ErrAlreadyStarted
+	}
+	opts := append([]ExecOption{}, c.Options...)
+	if c.Env != nil {
+		env, err := parseEnv(c.Env)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithEnvironment(env), WithEnvironmentMode(agentv1.EnvironmentMode_ENVIRONMENT_MODE_CLEAN))
+	}
+	if c.Dir != "" {
+		opts = append(opts, WithWorkingDir(c.Dir))
+	}
+	confirmed, err := c.client.supportsFeature(c.ctx, agentv1.Feature_FEATURE_START_CONFIRMATION)
+	if err != nil {
+		return err
+	}
+	started := make(chan struct{})
+	if confirmed {
+		var once sync.Once
+		opts = append(opts, withStarted(func() { once.Do(func() { close(started) }) }))
+	}
+	result := &Result{}
+	opts = append(opts, WithResult(result))
+	stdin := c.Stdin
+	if stdin == nil {
+		stdin = bytes.NewReader(nil)
+	}
+	command := append([]string{c.Path}, c.args()...)
+	parent := c.ctx
+	c.ctx, c.cancel = context.WithCancel(parent)
+	c.done = make(chan error, 1)
+	go func() {
+		exitCode, err := c.client.ExecuteInteractively(
+			command, c.ctx, stdin, commandWriter(c.Stdout), commandWriter(c.Stderr), opts...,
+		)
+		// Unblock readers of the pipes if the output was not closed, since the execution failed.
+		for _, w := range c.closeOnExit {
+			if err != nil {
+				_ = w.CloseWithError(err)
+			} else {
+				_ = w.Close()
+			}
+		}
+		if err == nil {
+			c.Result = result
+			if exitCode != 0 {
+				err = &RemoteExitError{Result: result}
+			}
+		}
+		c.done <- err
+	}()
+	if !confirmed {
+		return nil
+	}
+	select {
+	case <-started:
+		return nil
+	case err := <-c.done:
+		select {
+		case <-started:
+			// The command already exited, which Wait reports.
+			c.done <- err
+			return nil
+		default:
+		}
+		c.cancel()
+		for _, closer := range c.closeOnWait {
+			_ = closer.Close()
+		}
+		c.ctx, c.done = parent, nil
+		return err
+	}
+}
+
+// Wait waits for the command to exit and closes the pipes created by StdinPipe, StdoutPipe and StderrPipe.
+// The error is a *RemoteExitError if the command ran, but did not exit successfully.
+func (c *RemoteCmd) Wait() error {
+	if c.done == nil {
+		return ErrNotStarted
+	}
+	if c.waited {
+		return ErrAlreadyWaited
+	}
+	c.waited = true
+	err := <-c.done
+	c.cancel()
+	for _, closer := range c.closeOnWait {
+		_ = closer.Close()
+	}
+	return err
+}
+
+// Output runs the command and returns its stdout. If Stderr is nil, the stderr of a command
+// that did not exit successfully is stored in the returned *RemoteExitError.
+func (c *RemoteCmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	captureErr := c.Stderr == nil
+	if captureErr {
+		c.Stderr = &stderr
+	}
+	err := c.Run()
+	var exitErr *RemoteExitError
+	if captureErr && errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its stdout and stderr combined.
+func (c *RemoteCmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("stderr already set")
+	}
+	var output bytes.Buffer
+	c.Stdout = &output
+	c.Stderr = &output
+	err := c.Run()
+	return output.Bytes(), err
+}
+
+// StdinPipe returns a pipe connected to the command's stdin once it started.
+// Closing the pipe closes the command's stdin, otherwise Wait closes it.
+func (c *RemoteCmd) StdinPipe() (io.WriteCloser, error) {
+	if c.Stdin != nil {
+		return nil, errors.New("stdin already set")
+	}
+	if c.done != nil {
+		return nil, ErrAlreadyStarted
+	}
+	pr, pw := io.Pipe()
+	c.Stdin = pr
+	c.closeOnWait = append(c.closeOnWait, pr)
+	return pw, nil
+}
+
+// StdoutPipe returns a pipe connected to the command's stdout once it started.
+// As Wait closes the pipe, all reads must have completed before calling Wait.
+func (c *RemoteCmd) StdoutPipe() (io.ReadCloser, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("stdout already set")
+	}
+	pr, err := c.outputPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Stdout = c.closeOnExit[len(c.closeOnExit)-1]
+	return pr, nil
+}
+
+// StderrPipe returns a pipe connected to the command's stderr once it started, see StdoutPipe.
+func (c *RemoteCmd) StderrPipe() (io.ReadCloser, error) {
+	if c.Stderr != nil {
+		return nil, errors.New("stderr already set")
+	}
+	pr, err := c.outputPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Stderr = c.closeOnExit[len(c.closeOnExit)-1]
+	return pr, nil
+}
+
+func (c *RemoteCmd) outputPipe() (*io.PipeReader, error) {
+	if c.done != nil {
+		return nil, ErrAlreadyStarted
+	}
+	pr, pw := io.Pipe()
+	c.closeOnExit = append(c.closeOnExit, pw)
+	c.closeOnWait = append(c.closeOnWait, pr)
+	return pr, nil
+}
+
+// commandWriter adapts the output writer of a RemoteCmd to ExecuteInteractively, which closes it
+// once the output ended. Only the pipes are closed, as they belong to the RemoteCmd.
+func commandWriter(w io.Writer) io.WriteCloser {
+	switch w := w.(type) {
+	case nil:
+		return nopWriteCloser{io.Discard}
+	case *io.PipeWriter:
+		return w
+	default:
+		return nopWriteCloser{w}
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// parseEnv converts key=value pairs into a map, in which later values take precedence.
+// Unlike the environment of a local process, the map cannot hold entries without key or value.
+func parseEnv(env []string) (map[string]string, error) {
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid environment variable %q, expected key=value", kv)
+		}
+		vars[kv[:i]] = kv[i+1:]
+	}
+	return vars, nil
+}
+
+// RemoteExitError is returned by a RemoteCmd that did not exit successfully, like exec.ExitError.
+type RemoteExitError struct {
+	// Result describes how the command terminated.
+	Result *Result
+	// Stderr holds the command's stderr, if it was collected by Output.
+	Stderr []byte
+}
+
+// ExitCode returns the exit code of the command, or 128+N if it was killed by signal N.
+func (e *RemoteExitError) ExitCode() int {
+	return e.Result.ExitCode
+}
+
+func (e *RemoteExitError) Error() string {
+	if e.Result.Signaled() {
+		return "signal: " + signalName(e.Result.Signal)
+	}
+	return fmt.Sprintf("exit status %d", e.Result.ExitCode)
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"errors"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCatAgent executes every command like cat, which additionally writes "err" to stderr and exits
+// with exitCode once stdin is closed. If requested, the output is tagged with sequence numbers.
+// Commands named missing fail to start.
+type fakeCatAgent struct {
+	fakeAgent
+	exitCode int32
+	prepare  chan *agentv1.ExecuteCommandStreamRequest_Prepare
+}
+
+// errFakeMissing is returned by the fakeCatAgent for commands named missing.
+var errFakeMissing = errors.New("executable file not found")
+
+func (f *fakeCatAgent) ExecuteCommandStream(
+	_ context.Context, _ ...grpc.CallOption,
+) (agentv1.AgentService_ExecuteCommandStreamClient, error) {
+	return &fakeCatStream{agent: f, responses: make(chan *agentv1.ExecuteCommandStreamResponse, 16)}, nil
+}
+
+type fakeCatStream struct {
+	agentv1.AgentService_ExecuteCommandStreamClient
+	agent      *fakeCatAgent
+	responses  chan *agentv1.ExecuteCommandStreamResponse
+	timestamps bool
+	sequence   uint64
+}
+
+func (s *fakeCatStream) Send(req *agentv1.ExecuteCommandStreamRequest) error {
+	if req.Prepare != nil {
+		s.agent.prepare <- req.Prepare
+		s.timestamps = req.Prepare.Timestamps
+		if req.Prepare.Command[0] == "missing" {
+			s.responses <- nil
+			return nil
+		}
+		s.responses <- &agentv1.ExecuteCommandStreamResponse{Started: true}
+	}
+	if req.Stdin == nil {
+		return nil
+	}
+	if len(req.Stdin.Data) != 0 {
+		data := append([]byte(nil), req.Stdin.Data...)
+		s.responses <- &agentv1.ExecuteCommandStreamResponse{Stdout: s.tag(&agentv1.ExecuteIO{Data: data})}
+	}
+	if req.Stdin.Close {
+		s.responses <- &agentv1.ExecuteCommandStreamResponse{Stdout: s.tag(&agentv1.ExecuteIO{Close: true})}
+		stderr := &agentv1.ExecuteIO{Data: []byte("err"), Close: true}
+		s.responses <- &agentv1.ExecuteCommandStreamResponse{Stderr: s.tag(stderr)}
+		s.responses <- &agentv1.ExecuteCommandStreamResponse{
+			Result: &agentv1.ExecuteResult{Exited: true, ExitCode: s.agent.exitCode},
+		}
+	}
+	return nil
+}
+
+func (s *fakeCatStream) tag(output *agentv1.ExecuteIO) *agentv1.ExecuteIO {
+	if s.timestamps {
+		s.sequence++
+		output.Sequence = s.sequence
+		output.Timestamp = timestamppb.New(time.Unix(int64(s.sequence), 0))
+	}
+	return output
+}
+
+func (s *fakeCatStream) Recv() (*agentv1.ExecuteCommandStreamResponse, error) {
+	resp := <-s.responses
+	if resp == nil {
+		return nil, errFakeMissing
+	}
+	return resp, nil
+}
+
+func newFakeCatClient(t *testing.T, exitCode int32) (*Client, *fakeCatAgent) {
+	agent := &fakeCatAgent{
+		fakeAgent: fakeAgent{info: &agentv1.GetInfoResponse{Features: []agentv1.Feature{
+			agentv1.Feature_FEATURE_STREAMING, agentv1.Feature_FEATURE_ENVIRONMENT_MODES,
+			agentv1.Feature_FEATURE_PROCESS_ATTRIBUTES, agentv1.Feature_FEATURE_OUTPUT_ORDERING,
+			agentv1.Feature_FEATURE_START_CONFIRMATION,
+		}}},
+		exitCode: exitCode,
+		prepare:  make(chan *agentv1.ExecuteCommandStreamRequest_Prepare, 4),
+	}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+	return c, agent
+}
+
+func TestRemoteCmdOutput(t *testing.T) {
+	c, agent := newFakeCatClient(t, 0)
+	cmd := c.Command(context.Background(), "cat", "-u")
+	cmd.Env = []string{"A=1", "B=x=y", "A=2"}
+	cmd.Dir = "/tmp"
+	cmd.Stdin = strings.NewReader("hello")
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(output))
+	assert.Equal(t, 0, cmd.Result.ExitCode)
+
+	prepare := <-agent.prepare
+	assert.Equal(t, []string{"cat", "-u"}, prepare.Command)
+	assert.Equal(t, map[string]string{"A": "2", "B": "x=y"}, prepare.Environment)
+	assert.Equal(t, agentv1.EnvironmentMode_ENVIRONMENT_MODE_CLEAN, prepare.EnvironmentMode)
+	assert.Equal(t, "/tmp", prepare.WorkingDir)
+
+	assert.ErrorIs(t, cmd.Start(), ErrAlreadyStarted)
+	assert.ErrorIs(t, cmd.Wait(), ErrAlreadyWaited)
+}
+
+func TestRemoteCmdExitError(t *testing.T) {
+	c, _ := newFakeCatClient(t, 3)
+	cmd := c.Command(context.Background(), "false")
+	_, err := cmd.Output()
+	var exitErr *RemoteExitError
+	require.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, 3, exitErr.ExitCode())
+	assert.Equal(t, "err", string(exitErr.Stderr))
+	assert.EqualError(t, err, "exit status 3")
+
+	output, err := c.Command(context.Background(), "false").CombinedOutput()
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, "err", string(output))
+}
+
+func TestRemoteCmdPipes(t *testing.T) {
+	c, _ := newFakeCatClient(t, 0)
+	cmd := c.Command(context.Background(), "cat")
+	assert.ErrorIs(t, cmd.Wait(), ErrNotStarted)
+	stdin, err := cmd.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	_, err = cmd.StderrPipe()
+	assert.ErrorIs(t, err, ErrAlreadyStarted)
+
+	_, err = io.WriteString(stdin, "ping")
+	require.NoError(t, err)
+	require.NoError(t, stdin.Close())
+	output, err := io.ReadAll(stdout)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(output))
+	require.NoError(t, cmd.Wait())
+}
+
+func TestRemoteCmdOrdersOutput(t *testing.T) {
+	c, agent := newFakeCatClient(t, 0)
+	var chunks []OutputChunk
+	cmd := c.Command(context.Background(), "cat")
+	cmd.Stdin = strings.NewReader("in")
+	cmd.Options = []ExecOption{WithMergedOutput(), WithTimestamps(func(chunk OutputChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})}
+	require.NoError(t, cmd.Run())
+	prepare := <-agent.prepare
+	assert.True(t, prepare.MergeOutput)
+	assert.True(t, prepare.Timestamps)
+	assert.Equal(t, []OutputChunk{
+		{Sequence: 1, Time: time.Unix(1, 0).UTC(), Data: []byte("in")},
+		{Sequence: 3, Time: time.Unix(3, 0).UTC(), Stderr: true, Data: []byte("err")},
+	}, chunks)
+}
+
+func TestRemoteCmdStartErrors(t *testing.T) {
+	c, agent := newFakeCatClient(t, 0)
+	cmd := c.Command(context.Background(), "missing")
+	pipe, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	assert.ErrorIs(t, cmd.Start(), errFakeMissing)
+	<-agent.prepare
+	assert.ErrorIs(t, cmd.Wait(), ErrNotStarted)
+	_, err = pipe.Read(make([]byte, 1))
+	assert.Error(t, err)
+
+	cmd = c.Command(context.Background(), "env")
+	cmd.Env = []string{"A=1", "invalid"}
+	assert.EqualError(t, cmd.Start(), `invalid environment variable "invalid", expected key=value`)
+	assert.Empty(t, agent.prepare)
+
+	assert.Error(t, (&RemoteCmd{Path: "true"}).Start())
+}
+
+func TestRemoteCmdStartWithoutConfirmation(t *testing.T) {
+	c, agent := newFakeCatClient(t, 0)
+	agent.info.Features = agent.info.Features[:len(agent.info.Features)-1]
+	cmd := c.Command(context.Background(), "missing")
+	require.NoError(t, cmd.Start())
+	assert.ErrorIs(t, cmd.Wait(), errFakeMissing)
+}
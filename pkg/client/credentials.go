@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"github.com/sirkrypt0/pyro/pkg/transport"
+	"google.golang.org/grpc/credentials"
+)
+
+// TokenCredentials sends a bearer token along with each call.
+type TokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+var _ credentials.PerRPCCredentials = (*TokenCredentials)(nil)
+
+// NewTokenCredentials returns credentials sending the token to the agent at the given address.
+func NewTokenCredentials(address, token string) *TokenCredentials {
+	return &TokenCredentials{token: token, requireTLS: transport.IsTCP(address)}
+}
+
+func (t *TokenCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity requires TLS for TCP addresses, which may be exposed to the network.
+// Without TLS, the token is only sent through vsock or unix sockets, which are not.
+func (t *TokenCredentials) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
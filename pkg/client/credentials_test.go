@@ -0,0 +1,23 @@
+package client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTokenCredentialsRequireTransportSecurity(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected bool
+	}{
+		{address: "127.0.0.1:3000", expected: true},
+		{address: "vsock://3:3000", expected: false},
+		{address: "unix:///run/pyro.sock", expected: false},
+		{address: "fc-vsock:///run/firecracker.vsock:3000", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewTokenCredentials(tt.address, "secret").RequireTransportSecurity())
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package client
+
+import (
+	"context"
+	"github.com/sirkrypt0/pyro/pkg/transport"
+	"google.golang.org/grpc"
+)
+
+// Dial creates a gRPC connection to the agent at the given address, which may be any address
+// supported by transport.Dial, e.g. host:port, vsock://CID:PORT, unix:///path or fc-vsock:///path:PORT.
+func Dial(ctx context.Context, address string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialOpts := []grpc.DialOption{grpc.WithContextDialer(transport.Dial)}
+	if !transport.IsTCP(address) {
+		// The address is no valid authority, so use the one gRPC uses for unix sockets.
+		dialOpts = append(dialOpts, grpc.WithAuthority("localhost"))
+	}
+	// The passthrough scheme hands the address to the dialer as is, instead of gRPC resolving it itself.
+	return grpc.DialContext(ctx, "passthrough:///"+address, append(dialOpts, opts...)...)
+}
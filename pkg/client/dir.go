@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/archive"
+	"io"
+)
+
+type dirOptions struct {
+	compression   archive.Compression
+	allowDevices  bool
+	preserveOwner bool
+}
+
+// DirOption configures a directory transfer.
+type DirOption func(*dirOptions)
+
+// WithCompression sets the compression of the archive. Defaults to none.
+func WithCompression(c archive.Compression) DirOption {
+	return func(o *dirOptions) {
+		o.compression = c
+	}
+}
+
+// WithAllowDevices allows the agent to extract character and block devices pushed by PushDir.
+func WithAllowDevices() DirOption {
+	return func(o *dirOptions) {
+		o.allowDevices = true
+	}
+}
+
+// WithPreserveOwner makes the agent apply the owners stored in the archive pushed by PushDir.
+// Defaults to the user of the agent.
+func WithPreserveOwner() DirOption {
+	return func(o *dirOptions) {
+		o.preserveOwner = true
+	}
+}
+
+func newDirOptions(opts []DirOption) *dirOptions {
+	o := &dirOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// apiCompression converts the compression into its API representation.
+func apiCompression(c archive.Compression) (agentv1.Compression, error) {
+	switch c {
+	case archive.None:
+		return agentv1.Compression_COMPRESSION_NONE, nil
+	case archive.Gzip:
+		return agentv1.Compression_COMPRESSION_GZIP, nil
+	default:
+		return 0, fmt.Errorf("unsupported compression %v", c)
+	}
+}
+
+// PushDir sends the tar archive read from r to the agent, which extracts it into the directory
+// at the absolute path. The archive must be compressed as set by WithCompression.
+// The agent rejects archives containing entries that would end up outside the directory.
+func (c *Client) PushDir(ctx context.Context, path string, r io.Reader, opts ...DirOption) (archive.Stats, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_DIR_TRANSFER); err != nil {
+		return archive.Stats{}, err
+	}
+	o := newDirOptions(opts)
+	compression, err := apiCompression(o.compression)
+	if err != nil {
+		return archive.Stats{}, err
+	}
+	stream, err := c.agent.PushDir(ctx, c.callOpts...)
+	if err != nil {
+		return archive.Stats{}, fmt.Errorf("error pushing directory: %w", err)
+	}
+	closeAndRecv := func() error {
+		_, err := stream.CloseAndRecv()
+		return err
+	}
+	err = stream.Send(&agentv1.PushDirRequest{Options: &agentv1.PushDirOptions{
+		Path:          path,
+		Compression:   compression,
+		AllowDevices:  o.allowDevices,
+		PreserveOwner: o.preserveOwner,
+	}})
+	if err != nil {
+		return archive.Stats{}, fmt.Errorf("error sending directory options: %w", closeAndRecvError(closeAndRecv, err))
+	}
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&agentv1.PushDirRequest{Data: buf[:n]}); err != nil {
+				return archive.Stats{}, fmt.Errorf("error sending archive: %w", closeAndRecvError(closeAndRecv, err))
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		} else if readErr != nil {
+			return archive.Stats{}, fmt.Errorf("error reading archive: %w", readErr)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return archive.Stats{}, fmt.Errorf("error pushing directory: %w", err)
+	}
+	return archive.Stats{Entries: resp.Entries, Bytes: resp.Bytes}, nil
+}
+
+// PullDir writes a tar archive of the directory at the absolute path on the agent to w.
+// The archive is compressed as set by WithCompression.
+func (c *Client) PullDir(ctx context.Context, path string, w io.Writer, opts ...DirOption) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_DIR_TRANSFER); err != nil {
+		return err
+	}
+	compression, err := apiCompression(newDirOptions(opts).compression)
+	if err != nil {
+		return err
+	}
+	stream, err := c.agent.PullDir(ctx, &agentv1.PullDirRequest{Path: path, Compression: compression}, c.callOpts...)
+	if err != nil {
+		return fmt.Errorf("error pulling directory: %w", err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error pulling directory: %w", err)
+		}
+		if _, err := w.Write(resp.Data); err != nil {
+			return fmt.Errorf("error writing archive: %w", err)
+		}
+	}
+}
@@ -6,19 +6,55 @@ import (
 	"fmt"
 	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
 	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
 )
 
 const (
 	streamingInputBufferSize = 2048
 	exitCodeError            = -2
+	// DefaultMaxStdinSize is the default maximum size of the input sent along with a command by Execute.
+	DefaultMaxStdinSize = 1024 * 1024
 )
 
-func (c *Client) Execute(command []string, ctx context.Context, outw, errw io.WriteCloser) (exitCode int, err error) {
-	req := &agentv1.ExecuteCommandRequest{
-		Command:     command,
-		Environment: nil,
+// ErrStdinTooLarge is returned by Execute if the input exceeds the maximum size.
+var ErrStdinTooLarge = errors.New("stdin exceeds maximum size")
+
+// OutputChunk is a piece of output of a command, which the agent tagged as requested by WithTimestamps.
+type OutputChunk struct {
+	// Sequence orders the chunks of stdout and stderr of a command.
+	Sequence uint64
+	// Time is when the agent read the chunk from the command.
+	Time time.Time
+	// Stderr reports whether the command wrote the chunk to stderr rather than stdout.
+	Stderr bool
+	Data   []byte
+}
+
+func newOutputChunk(output *agentv1.ExecuteIO, stderr bool) OutputChunk {
+	chunk := OutputChunk{Sequence: output.Sequence, Stderr: stderr, Data: output.Data}
+	if output.Timestamp != nil {
+		chunk.Time = output.Timestamp.AsTime()
+	}
+	return chunk
+}
+
+func (c *Client) Execute(
+	command []string, ctx context.Context, outw, errw io.WriteCloser, opts ...ExecOption,
+) (exitCode int, err error) {
+	options := newExecOptions(opts)
+	if err := c.requireFeatures(ctx, options.requiredFeatures(false)...); err != nil {
+		return exitCodeError, err
+	}
+	req := options.newRequest(command)
+	if options.stdin != nil {
+		if req.Stdin, err = readStdin(options.stdin, options.maxStdin); err != nil {
+			return exitCodeError, err
+		}
 	}
-	resp, err := c.agent.ExecuteCommand(ctx, req)
+	resp, err := c.agent.ExecuteCommand(ctx, req, c.callOpts...)
 	if err != nil {
 		return exitCodeError, fmt.Errorf("error executing command: %w", err)
 	}
@@ -39,43 +75,108 @@ func (c *Client) Execute(command []string, ctx context.Context, outw, errw io.Wr
 	if err := errw.Close(); err != nil {
 		return exitCodeError, fmt.Errorf("error closing err writer: %w", err)
 	}
-	return int(resp.ExitCode), nil
+	result := resp.Result
+	if result == nil {
+		result = &agentv1.ExecuteResult{Exited: true, ExitCode: resp.ExitCode}
+	}
+	exitCode = options.setResult(result)
+	if options.result != nil {
+		options.result.Stdout = newOutputInfo(resp.Stdout)
+		options.result.Stderr = newOutputInfo(resp.Stderr)
+	}
+	return exitCode, nil
+}
+
+// readStdin reads all of r, failing if it exceeds maxSize bytes.
+func readStdin(r io.Reader, maxSize int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading stdin: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes, consider executing the command interactively", ErrStdinTooLarge, maxSize)
+	}
+	return data, nil
 }
 
 func (c *Client) ExecuteInteractively(
-	command []string, ctx context.Context, inr io.Reader, outw, errw io.WriteCloser,
+	command []string, ctx context.Context, inr io.Reader, outw, errw io.WriteCloser, opts ...ExecOption,
 ) (exitCode int, err error) {
-	prep := &agentv1.ExecuteCommandStreamRequest{
-		Prepare: &agentv1.ExecuteCommandStreamRequest_Prepare{
-			Command:     command,
-			Environment: nil,
-		},
+	options := newExecOptions(opts)
+	if err := c.requireFeatures(ctx, options.requiredFeatures(true)...); err != nil {
+		return exitCodeError, err
 	}
-	stream, err := c.agent.ExecuteCommandStream(ctx)
+	prep := &agentv1.ExecuteCommandStreamRequest{Prepare: options.newPrepare(command)}
+	agentStream, err := c.agent.ExecuteCommandStream(ctx, c.callOpts...)
 	if err != nil {
 		return exitCodeError, fmt.Errorf("error executing command stream: %w", err)
 	}
+	stream := &syncStream{AgentService_ExecuteCommandStreamClient: agentStream}
 
 	errCh := make(chan error, 1)
-	exitCh := make(chan int)
+	exitCh := make(chan *agentv1.ExecuteResult)
 
-	// start listeners first
-	go streamInput(ctx, inr, errCh, stream)
-	go streamOutput(ctx, outw, errw, errCh, exitCh, stream)
-
-	// kick off execution next
+	// kick off execution first, as the prepare request must be the first one sent
 	if err := stream.Send(prep); err != nil {
 		return exitCodeError, fmt.Errorf("error sending command: %w", err)
 	}
 
+	// start forwarding next
+	go streamInput(ctx, inr, errCh, stream)
+	go streamOutput(ctx, outw, errw, options.chunks, options.started, errCh, exitCh, stream)
+	if options.resize != nil {
+		go streamResize(ctx, options.resize, errCh, stream)
+	}
+	if len(options.signals) != 0 {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, options.signals...)
+		defer signal.Stop(sigs)
+		go streamSignals(ctx, sigs, errCh, stream)
+	}
+
 	// finally wait for exit or any failure
 	select {
 	case err := <-errCh:
 		return exitCodeError, err
 	case <-ctx.Done():
 		return exitCodeError, fmt.Errorf("context is done: %w", ctx.Err())
-	case exit := <-exitCh:
-		return exit, nil
+	case result := <-exitCh:
+		return options.setResult(result), nil
+	}
+}
+
+// syncStream allows sending on a command stream from multiple goroutines.
+type syncStream struct {
+	agentv1.AgentService_ExecuteCommandStreamClient
+	mu sync.Mutex
+}
+
+func (s *syncStream) Send(req *agentv1.ExecuteCommandStreamRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.AgentService_ExecuteCommandStreamClient.Send(req)
+}
+
+func streamResize(
+	ctx context.Context, sizes <-chan WindowSize, errCh chan error,
+	stream agentv1.AgentService_ExecuteCommandStreamClient,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case size, ok := <-sizes:
+			if !ok {
+				return
+			}
+			req := &agentv1.ExecuteCommandStreamRequest{
+				Resize: &agentv1.WindowSize{Rows: size.Rows, Cols: size.Cols},
+			}
+			if err := stream.Send(req); err != nil {
+				errCh <- err
+				return
+			}
+		}
 	}
 }
 
@@ -102,12 +203,12 @@ func streamInput(
 		}
 
 		if err != nil {
-			if errors.Is(err, io.EOF) && n == 0 {
+			if errors.Is(err, io.EOF) {
 				input.Stdin.Close = true
 				if err := stream.Send(&input); err != nil {
 					errCh <- err
-					return
 				}
+				return
 			} else {
 				errCh <- err
 				return
@@ -117,8 +218,8 @@ func streamInput(
 }
 
 func streamOutput(
-	ctx context.Context, outw, errw io.WriteCloser, errCh chan error, exitCh chan int,
-	stream agentv1.AgentService_ExecuteCommandStreamClient,
+	ctx context.Context, outw, errw io.WriteCloser, handleChunk func(OutputChunk) error, started func(),
+	errCh chan error, exitCh chan *agentv1.ExecuteResult, stream agentv1.AgentService_ExecuteCommandStreamClient,
 ) {
 	for {
 		if ctx.Err() != nil {
@@ -129,6 +230,13 @@ func streamOutput(
 			errCh <- err
 			return
 		}
+		if recv.Started && started != nil {
+			started()
+		}
+		if err := handleReceivedChunks(recv, handleChunk); err != nil {
+			errCh <- err
+			return
+		}
 		if err := writeReceivedData(recv.Stdout, outw); err != nil {
 			errCh <- err
 			return
@@ -138,12 +246,30 @@ func streamOutput(
 			return
 		}
 		if recv.Result != nil && recv.Result.Exited {
-			exitCh <- int(recv.Result.ExitCode)
+			exitCh <- recv.Result
 			return
 		}
 	}
 }
 
+// handleReceivedChunks passes the received stdout and stderr to handle, if set.
+func handleReceivedChunks(recv *agentv1.ExecuteCommandStreamResponse, handle func(OutputChunk) error) error {
+	if handle == nil {
+		return nil
+	}
+	if recv.Stdout != nil && len(recv.Stdout.Data) != 0 {
+		if err := handle(newOutputChunk(recv.Stdout, false)); err != nil {
+			return fmt.Errorf("error handling output: %w", err)
+		}
+	}
+	if recv.Stderr != nil && len(recv.Stderr.Data) != 0 {
+		if err := handle(newOutputChunk(recv.Stderr, true)); err != nil {
+			return fmt.Errorf("error handling output: %w", err)
+		}
+	}
+	return nil
+}
+
 func writeReceivedData(recv *agentv1.ExecuteIO, out io.WriteCloser) error {
 	if recv != nil {
 		if len(recv.Data) != 0 {
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"os"
+	"time"
+)
+
+// fileChunkSize is the maximum size of the content sent in a single WriteFile request.
+const fileChunkSize = 64 * 1024
+
+// ErrChecksumMismatch is returned by ReadFile if the received content does not match the agent's checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// FileInfo describes a file on the agent.
+type FileInfo struct {
+	Path string
+	// Mode contains the file type bits only if returned by Stat, Lstat or ReadDir.
+	Mode    os.FileMode
+	UID     *uint32
+	GID     *uint32
+	ModTime time.Time
+	Size    int64
+	// SymlinkTarget is the target of a symlink returned by Lstat or ReadDir.
+	SymlinkTarget string
+}
+
+// IsDir reports whether the file is a directory.
+func (i *FileInfo) IsDir() bool {
+	return i.Mode.IsDir()
+}
+
+func newFileInfo(meta *agentv1.FileMetadata) *FileInfo {
+	info := &FileInfo{Path: meta.Path, UID: meta.Uid, GID: meta.Gid, Size: meta.Size}
+	if meta.Mode != nil {
+		info.Mode = os.FileMode(*meta.Mode)
+	}
+	if meta.Mtime != nil {
+		info.ModTime = meta.Mtime.AsTime()
+	}
+	return info
+}
+
+// FileOption configures a file written by WriteFile.
+type FileOption func(*agentv1.FileMetadata)
+
+// WithFileMode sets the permission bits of the file.
+// Defaults to the ones of the replaced file or 0644.
+func WithFileMode(mode os.FileMode) FileOption {
+	return func(m *agentv1.FileMetadata) {
+		perm := uint32(mode.Perm())
+		m.Mode = &perm
+	}
+}
+
+// WithOwner sets the owner of the file. Defaults to the user of the agent.
+func WithOwner(uid, gid uint32) FileOption {
+	return func(m *agentv1.FileMetadata) {
+		m.Uid, m.Gid = &uid, &gid
+	}
+}
+
+// WithModTime sets the modification time of the file. Defaults to the time it is written.
+func WithModTime(mtime time.Time) FileOption {
+	return func(m *agentv1.FileMetadata) {
+		m.Mtime = timestamppb.New(mtime)
+	}
+}
+
+// WriteFile writes everything read from r to the file at the absolute path on the agent.
+// The file is replaced atomically once all content has been received and its checksum verified.
+// It returns the number of bytes written.
+func (c *Client) WriteFile(ctx context.Context, path string, r io.Reader, opts ...FileOption) (int64, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILE_TRANSFER); err != nil {
+		return 0, err
+	}
+	meta := &agentv1.FileMetadata{Path: path}
+	for _, opt := range opts {
+		opt(meta)
+	}
+	stream, err := c.agent.WriteFile(ctx, c.callOpts...)
+	if err != nil {
+		return 0, fmt.Errorf("error writing file: %w", err)
+	}
+	closeAndRecv := func() error {
+		_, err := stream.CloseAndRecv()
+		return err
+	}
+	if err := stream.Send(&agentv1.WriteFileRequest{Metadata: meta}); err != nil {
+		return 0, fmt.Errorf("error sending file metadata: %w", closeAndRecvError(closeAndRecv, err))
+	}
+	h := sha256.New()
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if err := stream.Send(&agentv1.WriteFileRequest{Data: buf[:n]}); err != nil {
+				return 0, fmt.Errorf("error sending file content: %w", closeAndRecvError(closeAndRecv, err))
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		} else if readErr != nil {
+			return 0, fmt.Errorf("error reading file content: %w", readErr)
+		}
+	}
+	sum := h.Sum(nil)
+	if err := stream.Send(&agentv1.WriteFileRequest{Sha256: sum}); err != nil {
+		return 0, fmt.Errorf("error sending file checksum: %w", closeAndRecvError(closeAndRecv, err))
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, fmt.Errorf("error writing file: %w", err)
+	}
+	return resp.Size, nil
+}
+
+// closeAndRecvError returns the actual error of the call, if sending failed because the agent aborted it.
+func closeAndRecvError(closeAndRecv func() error, sendErr error) error {
+	if !errors.Is(sendErr, io.EOF) {
+		return sendErr
+	}
+	if err := closeAndRecv(); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// ReadFile reads the file at the absolute path on the agent and writes its content to w.
+// It fails with ErrChecksumMismatch if the content does not match the checksum sent by the agent.
+func (c *Client) ReadFile(ctx context.Context, path string, w io.Writer) (*FileInfo, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILE_TRANSFER); err != nil {
+		return nil, err
+	}
+	stream, err := c.agent.ReadFile(ctx, &agentv1.ReadFileRequest{Path: path}, c.callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	if resp.Metadata == nil {
+		return nil, errors.New("error reading file: first response contains no metadata")
+	}
+	info := newFileInfo(resp.Metadata)
+	h := sha256.New()
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("error reading file: stream ended without checksum")
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading file: %w", err)
+		}
+		if len(resp.Data) != 0 {
+			h.Write(resp.Data)
+			if _, err := w.Write(resp.Data); err != nil {
+				return nil, fmt.Errorf("error writing file content: %w", err)
+			}
+		}
+		if resp.Sha256 != nil {
+			if sum := h.Sum(nil); !bytes.Equal(resp.Sha256, sum) {
+				return nil, fmt.Errorf("%w: expected %x, got %x", ErrChecksumMismatch, resp.Sha256, sum)
+			}
+			return info, nil
+		}
+	}
+}
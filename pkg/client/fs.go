@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"os"
+	"path"
+	"syscall"
+)
+
+// fileTypes maps the file types of the agent to the type bits of a file mode.
+var fileTypes = map[agentv1.FileType]os.FileMode{
+	agentv1.FileType_FILE_TYPE_DIRECTORY:    os.ModeDir,
+	agentv1.FileType_FILE_TYPE_SYMLINK:      os.ModeSymlink,
+	agentv1.FileType_FILE_TYPE_NAMED_PIPE:   os.ModeNamedPipe,
+	agentv1.FileType_FILE_TYPE_SOCKET:       os.ModeSocket,
+	agentv1.FileType_FILE_TYPE_BLOCK_DEVICE: os.ModeDevice,
+	agentv1.FileType_FILE_TYPE_CHAR_DEVICE:  os.ModeDevice | os.ModeCharDevice,
+}
+
+func newStatFileInfo(filePath string, stat *agentv1.FileStat) *FileInfo {
+	uid, gid := stat.Uid, stat.Gid
+	info := &FileInfo{
+		Path:          filePath,
+		Mode:          fileMode(stat.Mode) | fileTypes[stat.Type],
+		UID:           &uid,
+		GID:           &gid,
+		Size:          stat.Size,
+		SymlinkTarget: stat.SymlinkTarget,
+	}
+	if stat.Mtime != nil {
+		info.ModTime = stat.Mtime.AsTime()
+	}
+	return info
+}
+
+// fileMode converts permission and special bits as in chmod(2) into a file mode.
+func fileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode).Perm()
+	if mode&syscall.S_ISUID != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&syscall.S_ISGID != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&syscall.S_ISVTX != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// unixMode returns the permission and special bits of the mode as in chmod(2).
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return m
+}
+
+// Stat describes the file at the absolute path on the agent, following symlinks.
+func (c *Client) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	return c.stat(ctx, path, true)
+}
+
+// Lstat describes the file at the absolute path on the agent without following symlinks.
+func (c *Client) Lstat(ctx context.Context, path string) (*FileInfo, error) {
+	return c.stat(ctx, path, false)
+}
+
+func (c *Client) stat(ctx context.Context, path string, follow bool) (*FileInfo, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return nil, err
+	}
+	resp, err := c.agent.Stat(ctx, &agentv1.StatRequest{Path: path, FollowSymlinks: follow}, c.callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file info: %w", err)
+	}
+	return newStatFileInfo(path, resp.Stat), nil
+}
+
+// ReadDirPage lists up to pageSize entries of the directory at the absolute path on the agent, ordered by name.
+// The page size defaults to the agent's one if zero. To continue listing, call it again with the returned
+// page token, which is empty once all entries were listed.
+func (c *Client) ReadDirPage(ctx context.Context, dir, pageToken string, pageSize int) ([]*FileInfo, string, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return nil, "", err
+	}
+	req := &agentv1.ReadDirRequest{Path: dir, PageToken: pageToken, PageSize: int32(pageSize)}
+	resp, err := c.agent.ReadDir(ctx, req, c.callOpts...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading directory: %w", err)
+	}
+	entries := make([]*FileInfo, len(resp.Entries))
+	for i, entry := range resp.Entries {
+		entries[i] = newStatFileInfo(path.Join(dir, entry.Name), entry)
+	}
+	return entries, resp.NextPageToken, nil
+}
+
+// ReadDir lists all entries of the directory at the absolute path on the agent, ordered by name.
+func (c *Client) ReadDir(ctx context.Context, dir string) ([]*FileInfo, error) {
+	var all []*FileInfo
+	var token string
+	for {
+		entries, next, err := c.ReadDirPage(ctx, dir, token, 0)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+		if next == "" {
+			return all, nil
+		}
+		token = next
+	}
+}
+
+// Mkdir creates the directory at the absolute path on the agent.
+// The mode is subject to the agent's umask.
+func (c *Client) Mkdir(ctx context.Context, path string, mode os.FileMode) error {
+	return c.mkdir(ctx, path, mode, false)
+}
+
+// MkdirAll creates the directory at the absolute path on the agent including its parents.
+// It does nothing if the directory already exists.
+func (c *Client) MkdirAll(ctx context.Context, path string, mode os.FileMode) error {
+	return c.mkdir(ctx, path, mode, true)
+}
+
+func (c *Client) mkdir(ctx context.Context, path string, mode os.FileMode, parents bool) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return err
+	}
+	m := unixMode(mode)
+	req := &agentv1.MkdirRequest{Path: path, Mode: &m, Parents: parents}
+	if _, err := c.agent.Mkdir(ctx, req, c.callOpts...); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+	return nil
+}
+
+// Remove removes the file or empty directory at the absolute path on the agent.
+func (c *Client) Remove(ctx context.Context, path string) error {
+	return c.remove(ctx, path, false)
+}
+
+// RemoveAll removes the file or directory including its contents at the absolute path on the agent.
+// Unlike os.RemoveAll, it fails if the path does not exist.
+func (c *Client) RemoveAll(ctx context.Context, path string) error {
+	return c.remove(ctx, path, true)
+}
+
+func (c *Client) remove(ctx context.Context, path string, recursive bool) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return err
+	}
+	if _, err := c.agent.Remove(ctx, &agentv1.RemoveRequest{Path: path, Recursive: recursive}, c.callOpts...); err != nil {
+		return fmt.Errorf("error removing file: %w", err)
+	}
+	return nil
+}
+
+// Rename renames the file at the absolute path on the agent, replacing the destination if it exists.
+func (c *Client) Rename(ctx context.Context, oldPath, newPath string) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return err
+	}
+	req := &agentv1.RenameRequest{OldPath: oldPath, NewPath: newPath}
+	if _, err := c.agent.Rename(ctx, req, c.callOpts...); err != nil {
+		return fmt.Errorf("error renaming file: %w", err)
+	}
+	return nil
+}
+
+// Chmod changes the permission bits of the file at the absolute path on the agent.
+func (c *Client) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return err
+	}
+	if _, err := c.agent.Chmod(ctx, &agentv1.ChmodRequest{Path: path, Mode: unixMode(mode)}, c.callOpts...); err != nil {
+		return fmt.Errorf("error changing mode: %w", err)
+	}
+	return nil
+}
+
+// Chown changes the owner of the file at the absolute path on the agent, following symlinks.
+// A negative uid or gid is left unchanged, as with os.Chown.
+func (c *Client) Chown(ctx context.Context, path string, uid, gid int) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_FILESYSTEM); err != nil {
+		return err
+	}
+	req := &agentv1.ChownRequest{Path: path}
+	if uid >= 0 {
+		u := uint32(uid)
+		req.Uid = &u
+	}
+	if gid >= 0 {
+		g := uint32(gid)
+		req.Gid = &g
+	}
+	if _, err := c.agent.Chown(ctx, req, c.callOpts...); err != nil {
+		return fmt.Errorf("error changing owner: %w", err)
+	}
+	return nil
+}
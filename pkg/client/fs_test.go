@@ -0,0 +1,26 @@
+package client
+
+import (
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestNewStatFileInfo(t *testing.T) {
+	info := newStatFileInfo("/dir/tmp", &agentv1.FileStat{
+		Name: "tmp",
+		Type: agentv1.FileType_FILE_TYPE_DIRECTORY,
+		Mode: 0o1777,
+		Uid:  0,
+		Gid:  100,
+	})
+	assert.True(t, info.IsDir())
+	assert.Equal(t, os.ModeDir|os.ModeSticky|0o777, info.Mode)
+	assert.Equal(t, uint32(100), *info.GID)
+	assert.Equal(t, uint32(0o1777), unixMode(info.Mode))
+
+	info = newStatFileInfo("/dir/bin", &agentv1.FileStat{Type: agentv1.FileType_FILE_TYPE_REGULAR, Mode: 0o4755})
+	assert.True(t, info.Mode.IsRegular())
+	assert.Equal(t, os.ModeSetuid|0o755, info.Mode)
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the file in the root of a directory synced by Sync listing patterns of paths to exclude.
+const IgnoreFile = ".pyroignore"
+
+// excludes decide which paths are excluded from syncing using a subset of the .gitignore syntax.
+// Blank lines and lines starting with # are skipped. Patterns match as in path.Match.
+// Patterns containing a slash other than a trailing one match the path relative to the synced directory,
+// others the name of a file at any depth. A trailing slash only matches directories and a leading !
+// includes paths excluded by a previous pattern again. The last matching pattern decides.
+// As with git, paths below an excluded directory cannot be included again.
+type excludes []excludePattern
+
+type excludePattern struct {
+	pattern  string
+	anchored bool
+	dirOnly  bool
+	negated  bool
+}
+
+func parseExcludes(lines []string) (excludes, error) {
+	var e excludes
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := excludePattern{}
+		if strings.HasPrefix(line, "!") {
+			p.negated = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		p.anchored = strings.Contains(line, "/")
+		p.pattern = strings.TrimPrefix(line, "/")
+		if _, err := path.Match(p.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", line, err)
+		}
+		e = append(e, p)
+	}
+	return e, nil
+}
+
+// readIgnoreFile returns the lines of the ignore file in the directory, if it exists.
+func readIgnoreFile(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// excluded reports whether the path relative to the synced directory or any of its parents is excluded.
+func (e excludes) excluded(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if e.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return e.match(rel, isDir)
+}
+
+// match reports whether the path itself is excluded.
+func (e excludes) match(rel string, isDir bool) bool {
+	excluded := false
+	for _, p := range e {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if !p.anchored {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(p.pattern, name); ok {
+			excluded = !p.negated
+		}
+	}
+	return excluded
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// ErrUnsupportedFeature is returned if a call requires a feature the agent does not support.
+var ErrUnsupportedFeature = errors.New("unsupported feature")
+
+// capabilities are the cached information about the agent.
+type capabilities struct {
+	info *agentv1.GetInfoResponse
+	// legacy is set if the agent predates GetInfo, so its features are unknown.
+	legacy   bool
+	features map[agentv1.Feature]bool
+}
+
+// Info returns information about the agent. It is requested once and cached afterwards.
+func (c *Client) Info(ctx context.Context) (*agentv1.GetInfoResponse, error) {
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caps.legacy {
+		return nil, fmt.Errorf("error getting agent info: %w", status.Error(codes.Unimplemented, "agent predates GetInfo"))
+	}
+	return caps.info, nil
+}
+
+func (c *Client) capabilities(ctx context.Context) (*capabilities, error) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps != nil {
+		return c.caps, nil
+	}
+	info, err := c.agent.GetInfo(ctx, &agentv1.GetInfoRequest{}, c.callOpts...)
+	if status.Code(err) == codes.Unimplemented {
+		c.caps = &capabilities{legacy: true}
+		return c.caps, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting agent info: %w", err)
+	}
+	caps := &capabilities{info: info, features: make(map[agentv1.Feature]bool, len(info.Features))}
+	for _, feature := range info.Features {
+		caps.features[feature] = true
+	}
+	c.caps = caps
+	return caps, nil
+}
+
+// requireFeatures fails with ErrUnsupportedFeature if the agent does not support any of the features.
+// Agents predating GetInfo are assumed to support them, as their features are unknown.
+func (c *Client) requireFeatures(ctx context.Context, features ...agentv1.Feature) error {
+	if len(features) == 0 {
+		return nil
+	}
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if caps.legacy {
+		return nil
+	}
+	for _, feature := range features {
+		if !caps.features[feature] {
+			return fmt.Errorf("agent %s does not support %s: %w", caps.info.Version, FeatureName(feature), ErrUnsupportedFeature)
+		}
+	}
+	return nil
+}
+
+// supportsFeature returns whether the agent supports the feature.
+// Unlike requireFeatures, agents predating GetInfo are assumed not to support it.
+func (c *Client) supportsFeature(ctx context.Context, feature agentv1.Feature) (bool, error) {
+	caps, err := c.capabilities(ctx)
+	if err != nil {
+		return false, err
+	}
+	return caps.features[feature], nil
+}
+
+// FeatureName returns the human readable name of the feature, e.g. environment-modes.
+func FeatureName(feature agentv1.Feature) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(feature.String(), "FEATURE_")), "_", "-")
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+// fakeAgent answers GetInfo and ExecuteCommand and counts the calls.
+type fakeAgent struct {
+	agentv1.AgentServiceClient
+	info         *agentv1.GetInfoResponse
+	infoErr      error
+	infoCalls    int
+	executeCalls int
+}
+
+func (f *fakeAgent) GetInfo(
+	_ context.Context, _ *agentv1.GetInfoRequest, _ ...grpc.CallOption,
+) (*agentv1.GetInfoResponse, error) {
+	f.infoCalls++
+	return f.info, f.infoErr
+}
+
+func (f *fakeAgent) ExecuteCommand(
+	_ context.Context, _ *agentv1.ExecuteCommandRequest, _ ...grpc.CallOption,
+) (*agentv1.ExecuteCommandResponse, error) {
+	f.executeCalls++
+	return &agentv1.ExecuteCommandResponse{}, nil
+}
+
+func (f *fakeAgent) ExecuteCommandStream(
+	_ context.Context, _ ...grpc.CallOption,
+) (agentv1.AgentService_ExecuteCommandStreamClient, error) {
+	return nil, status.Error(codes.Unavailable, "not implemented by fake")
+}
+
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (*nopCloser) Close() error {
+	return nil
+}
+
+func TestRequiredFeaturesFailFast(t *testing.T) {
+	agent := &fakeAgent{info: &agentv1.GetInfoResponse{
+		Version:  "v0.1.0",
+		Features: []agentv1.Feature{agentv1.Feature_FEATURE_STREAMING, agentv1.Feature_FEATURE_STDIN},
+	}}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = c.Execute([]string{"true"}, ctx, &nopCloser{}, &nopCloser{}, WithStdin(&bytes.Buffer{}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, agent.executeCalls)
+
+	_, err = c.Execute([]string{"true"}, ctx, &nopCloser{}, &nopCloser{}, WithTimeout(time.Second))
+	assert.ErrorIs(t, err, ErrUnsupportedFeature)
+	assert.EqualError(t, err, "agent v0.1.0 does not support timeouts: unsupported feature")
+	assert.Equal(t, 1, agent.executeCalls)
+
+	_, err = c.ExecuteInteractively(
+		[]string{"sh"}, ctx, &bytes.Buffer{}, &nopCloser{}, &nopCloser{}, WithTerminal("xterm", WindowSize{}),
+	)
+	assert.ErrorIs(t, err, ErrUnsupportedFeature)
+	assert.Contains(t, err.Error(), "pty")
+
+	// The capabilities are requested only once.
+	assert.Equal(t, 1, agent.infoCalls)
+	info, err := c.Info(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.1.0", info.Version)
+	assert.Equal(t, 1, agent.infoCalls)
+}
+
+func TestRequiredFeaturesLegacyAgent(t *testing.T) {
+	agent := &fakeAgent{infoErr: status.Error(codes.Unimplemented, "unknown method GetInfo")}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+
+	_, err = c.Execute([]string{"true"}, context.Background(), &nopCloser{}, &nopCloser{}, WithTimeout(time.Second))
+	require.NoError(t, err)
+	_, err = c.Info(context.Background())
+	assert.Equal(t, codes.Unimplemented, grpcCode(err))
+	assert.Equal(t, 1, agent.infoCalls)
+}
+
+func TestRequiredFeaturesInfoError(t *testing.T) {
+	agent := &fakeAgent{infoErr: status.Error(codes.Unavailable, "connection refused")}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+
+	_, err = c.Execute([]string{"true"}, context.Background(), &nopCloser{}, &nopCloser{}, WithTimeout(time.Second))
+	assert.Equal(t, codes.Unavailable, grpcCode(err))
+	// Errors are not cached.
+	_, err = c.Info(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 2, agent.infoCalls)
+}
+
+// grpcCode returns the code of the gRPC status wrapped by err.
+func grpcCode(err error) codes.Code {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return grpcErr.GRPCStatus().Code()
+	}
+	return status.Code(err)
+}
+
+func TestFeatureName(t *testing.T) {
+	assert.Equal(t, "pty", FeatureName(agentv1.Feature_FEATURE_PTY))
+	assert.Equal(t, "environment-modes", FeatureName(agentv1.Feature_FEATURE_ENVIRONMENT_MODES))
+}
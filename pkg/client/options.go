@@ -0,0 +1,265 @@
+package client
+
+import (
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"io"
+	"os"
+	"time"
+)
+
+// ExecOption configures how a command is executed on the agent.
+type ExecOption func(*execOptions)
+
+type execOptions struct {
+	stdin      io.Reader
+	maxStdin   int64
+	retention  agentv1.OutputRetention
+	env        map[string]string
+	envMode    agentv1.EnvironmentMode
+	workingDir string
+	user       string
+	group      string
+	groups     []string
+	umask      *uint32
+	timeout    *durationpb.Duration
+	grace      *durationpb.Duration
+	terminal   *agentv1.Terminal
+	resize     <-chan WindowSize
+	signals    []os.Signal
+	result     *Result
+	name       string
+	openStdin  bool
+	merge      bool
+	chunks     func(OutputChunk) error
+	started    func()
+}
+
+// WindowSize is the size of a terminal in characters.
+type WindowSize struct {
+	Rows uint32
+	Cols uint32
+}
+
+func newExecOptions(opts []ExecOption) *execOptions {
+	o := &execOptions{maxStdin: DefaultMaxStdinSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithStdin feeds everything read from r to the command's stdin when using Execute.
+// As the input is sent along with the command, it is limited in size, see WithMaxStdinSize.
+func WithStdin(r io.Reader) ExecOption {
+	return func(o *execOptions) {
+		o.stdin = r
+	}
+}
+
+// WithMaxStdinSize sets the maximum number of bytes read from the reader given by WithStdin.
+func WithMaxStdinSize(size int64) ExecOption {
+	return func(o *execOptions) {
+		o.maxStdin = size
+	}
+}
+
+// WithOutputRetention defines whether the beginning or the end of stdout and stderr is
+// retained, once they exceed the agent's maximum output size when using Execute.
+func WithOutputRetention(retention agentv1.OutputRetention) ExecOption {
+	return func(o *execOptions) {
+		o.retention = retention
+	}
+}
+
+// WithEnvironment adds the variables to the environment of the command.
+// How they are combined with the agent's environment is defined by WithEnvironmentMode.
+func WithEnvironment(env map[string]string) ExecOption {
+	return func(o *execOptions) {
+		if o.env == nil {
+			o.env = make(map[string]string, len(env))
+		}
+		for k, v := range env {
+			o.env[k] = v
+		}
+	}
+}
+
+// WithEnvironmentMode defines how the environment of the command is combined with the agent's one.
+// By default, the agent's environment is merged with the given one.
+func WithEnvironmentMode(mode agentv1.EnvironmentMode) ExecOption {
+	return func(o *execOptions) {
+		o.envMode = mode
+	}
+}
+
+// WithWorkingDir runs the command in the given directory on the agent.
+func WithWorkingDir(dir string) ExecOption {
+	return func(o *execOptions) {
+		o.workingDir = dir
+	}
+}
+
+// WithUser runs the command as the given user, either a name or a numeric uid.
+// Unless overridden, the command runs with the primary and supplementary groups of the user.
+func WithUser(user string) ExecOption {
+	return func(o *execOptions) {
+		o.user = user
+	}
+}
+
+// WithGroup runs the command with the given primary group, either a name or a numeric gid.
+// It requires a user to be set as well.
+func WithGroup(group string) ExecOption {
+	return func(o *execOptions) {
+		o.group = group
+	}
+}
+
+// WithSupplementaryGroups runs the command with the given supplementary groups, either names
+// or numeric gids. It requires a user to be set as well.
+func WithSupplementaryGroups(groups ...string) ExecOption {
+	return func(o *execOptions) {
+		o.groups = groups
+	}
+}
+
+// WithUmask runs the command with the given file mode creation mask.
+func WithUmask(umask os.FileMode) ExecOption {
+	return func(o *execOptions) {
+		mask := uint32(umask.Perm())
+		o.umask = &mask
+	}
+}
+
+// WithTimeout limits the time the command may run. The agent enforces the timeout by sending
+// SIGTERM to the command's process group and, if it is still running after a grace period, SIGKILL.
+// Independently, the agent kills the command once the deadline of ctx is exceeded.
+func WithTimeout(timeout time.Duration) ExecOption {
+	return func(o *execOptions) {
+		o.timeout = durationpb.New(timeout)
+	}
+}
+
+// WithTimeoutGracePeriod sets the time between SIGTERM and SIGKILL once the timeout expired.
+func WithTimeoutGracePeriod(gracePeriod time.Duration) ExecOption {
+	return func(o *execOptions) {
+		o.grace = durationpb.New(gracePeriod)
+	}
+}
+
+// WithTerminal attaches the command to a pseudo-terminal of the given type and initial size.
+// Stdout and stderr of the command are then both written to the out writer.
+func WithTerminal(term string, size WindowSize) ExecOption {
+	return func(o *execOptions) {
+		o.terminal = &agentv1.Terminal{
+			Term: term,
+			Size: &agentv1.WindowSize{Rows: size.Rows, Cols: size.Cols},
+		}
+	}
+}
+
+// WithResize forwards every window size received on sizes to the command's pseudo-terminal.
+func WithResize(sizes <-chan WindowSize) ExecOption {
+	return func(o *execOptions) {
+		o.resize = sizes
+	}
+}
+
+// WithMergedOutput redirects the command's stderr into its stdout at the agent, so that both
+// are written to the out writer in the exact order the command wrote them.
+func WithMergedOutput() ExecOption {
+	return func(o *execOptions) {
+		o.merge = true
+	}
+}
+
+// WithTimestamps requests the agent to tag the output of a command executed using ExecuteInteractively
+// with sequence numbers and timestamps. Every chunk of output is passed to handle in the order of the
+// sequence numbers, which preserves the interleaving of stdout and stderr, before it is written to the
+// out or err writer. If handle fails, the execution is aborted with its error.
+func WithTimestamps(handle func(OutputChunk) error) ExecOption {
+	return func(o *execOptions) {
+		o.chunks = handle
+	}
+}
+
+// withStarted calls started once the agent confirmed that a command executed using ExecuteInteractively
+// started. The agent must support FEATURE_START_CONFIRMATION, otherwise started is never called.
+func withStarted(started func()) ExecOption {
+	return func(o *execOptions) {
+		o.started = started
+	}
+}
+
+func (o *execOptions) newRequest(command []string) *agentv1.ExecuteCommandRequest {
+	return &agentv1.ExecuteCommandRequest{
+		Command:             command,
+		Environment:         o.env,
+		EnvironmentMode:     o.envMode,
+		WorkingDir:          o.workingDir,
+		User:                o.user,
+		Group:               o.group,
+		SupplementaryGroups: o.groups,
+		Umask:               o.umask,
+		Timeout:             o.timeout,
+		TimeoutGracePeriod:  o.grace,
+		OutputRetention:     o.retention,
+		MergeOutput:         o.merge,
+	}
+}
+
+func (o *execOptions) newPrepare(command []string) *agentv1.ExecuteCommandStreamRequest_Prepare {
+	return &agentv1.ExecuteCommandStreamRequest_Prepare{
+		Command:             command,
+		Environment:         o.env,
+		EnvironmentMode:     o.envMode,
+		Terminal:            o.terminal,
+		WorkingDir:          o.workingDir,
+		User:                o.user,
+		Group:               o.group,
+		SupplementaryGroups: o.groups,
+		Umask:               o.umask,
+		Timeout:             o.timeout,
+		TimeoutGracePeriod:  o.grace,
+		MergeOutput:         o.merge,
+		Timestamps:          o.chunks != nil,
+	}
+}
+
+// requiredFeatures returns the features the agent must support to honor the options.
+func (o *execOptions) requiredFeatures(streaming bool) []agentv1.Feature {
+	var features []agentv1.Feature
+	if streaming {
+		features = append(features, agentv1.Feature_FEATURE_STREAMING)
+		if o.terminal != nil {
+			features = append(features, agentv1.Feature_FEATURE_PTY)
+		}
+		if o.resize != nil || len(o.signals) != 0 {
+			features = append(features, agentv1.Feature_FEATURE_SIGNALS)
+		}
+		if o.chunks != nil {
+			features = append(features, agentv1.Feature_FEATURE_OUTPUT_ORDERING)
+		}
+	} else {
+		if o.stdin != nil {
+			features = append(features, agentv1.Feature_FEATURE_STDIN)
+		}
+		if o.retention != agentv1.OutputRetention_OUTPUT_RETENTION_UNSPECIFIED {
+			features = append(features, agentv1.Feature_FEATURE_OUTPUT_LIMITS)
+		}
+	}
+	if o.merge {
+		features = append(features, agentv1.Feature_FEATURE_OUTPUT_ORDERING)
+	}
+	if o.timeout != nil || o.grace != nil {
+		features = append(features, agentv1.Feature_FEATURE_TIMEOUTS)
+	}
+	if o.envMode != agentv1.EnvironmentMode_ENVIRONMENT_MODE_UNSPECIFIED {
+		features = append(features, agentv1.Feature_FEATURE_ENVIRONMENT_MODES)
+	}
+	if o.workingDir != "" || o.user != "" || o.group != "" || len(o.groups) != 0 || o.umask != nil {
+		features = append(features, agentv1.Feature_FEATURE_PROCESS_ATTRIBUTES)
+	}
+	return features
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"time"
+)
+
+// Process describes a process started on the agent by StartProcess.
+type Process struct {
+	ID string
+	// Name is the optional unique name given by WithName, which may be used instead of the ID.
+	Name      string
+	Command   []string
+	PID       int
+	Running   bool
+	StartedAt time.Time
+	// Stdin reports whether the process' stdin was kept open using WithOpenStdin.
+	Stdin bool
+	// Result describes how the process terminated, nil while it is running.
+	Result *Result
+}
+
+func newProcess(info *agentv1.ProcessInfo) *Process {
+	p := &Process{
+		ID:      info.Id,
+		Name:    info.Name,
+		Command: info.Command,
+		PID:     int(info.Pid),
+		Running: info.State == agentv1.ProcessState_PROCESS_STATE_RUNNING,
+		Stdin:   info.Stdin,
+	}
+	if info.StartedAt != nil {
+		p.StartedAt = info.StartedAt.AsTime()
+	}
+	if info.Result != nil {
+		p.Result = newResult(info.Result)
+	}
+	return p
+}
+
+// WithName names the process started by StartProcess. Names are unique among the agent's processes.
+func WithName(name string) ExecOption {
+	return func(o *execOptions) {
+		o.name = name
+	}
+}
+
+// WithOpenStdin keeps the stdin of the process started by StartProcess open, so that input can be
+// forwarded to it by AttachProcess. Otherwise, its stdin is closed right away.
+func WithOpenStdin() ExecOption {
+	return func(o *execOptions) {
+		o.openStdin = true
+	}
+}
+
+// StartProcess starts the command on the agent detached from the call, so that it keeps running
+// independently of the client. Its output is buffered by the agent, see AttachProcess.
+// The returned process is identified by its ID or, if given by WithName, its name.
+func (c *Client) StartProcess(ctx context.Context, command []string, opts ...ExecOption) (*Process, error) {
+	options := newExecOptions(opts)
+	features := append(options.requiredFeatures(true), agentv1.Feature_FEATURE_PROCESSES)
+	if options.openStdin {
+		features = append(features, agentv1.Feature_FEATURE_ATTACH)
+	}
+	if err := c.requireFeatures(ctx, features...); err != nil {
+		return nil, err
+	}
+	req := &agentv1.StartProcessRequest{
+		Prepare: options.newPrepare(command),
+		Name:    options.name,
+		Stdin:   options.openStdin,
+	}
+	resp, err := c.agent.StartProcess(ctx, req, c.callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error starting process: %w", err)
+	}
+	return newProcess(resp.Process), nil
+}
+
+// ListProcesses lists the processes in the state, or all if unspecified, ordered by their start time.
+// Exited processes are only kept for a while.
+func (c *Client) ListProcesses(ctx context.Context, state agentv1.ProcessState) ([]*Process, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_PROCESSES); err != nil {
+		return nil, err
+	}
+	resp, err := c.agent.ListProcesses(ctx, &agentv1.ListProcessesRequest{State: state}, c.callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing processes: %w", err)
+	}
+	processes := make([]*Process, len(resp.Processes))
+	for i, info := range resp.Processes {
+		processes[i] = newProcess(info)
+	}
+	return processes, nil
+}
+
+// WaitProcess waits for the process with the ID or name to exit and returns it.
+func (c *Client) WaitProcess(ctx context.Context, id string) (*Process, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_PROCESSES); err != nil {
+		return nil, err
+	}
+	resp, err := c.agent.WaitProcess(ctx, &agentv1.WaitProcessRequest{Id: id}, c.callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error waiting for process: %w", err)
+	}
+	return newProcess(resp.Process), nil
+}
+
+// KillProcess sends the signal, SIGTERM if unspecified, to the process group of the process with the ID or name.
+func (c *Client) KillProcess(ctx context.Context, id string, sig agentv1.Signal) error {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_PROCESSES); err != nil {
+		return err
+	}
+	if _, err := c.agent.KillProcess(ctx, &agentv1.KillProcessRequest{Id: id, Signal: sig}, c.callOpts...); err != nil {
+		return fmt.Errorf("error killing process: %w", err)
+	}
+	return nil
+}
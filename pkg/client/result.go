@@ -0,0 +1,129 @@
+package client
+
+import (
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"strings"
+	"time"
+)
+
+// signalExitCodeOffset is added to the signal number to form the exit code of
+// a command killed by a signal, following shell conventions.
+const signalExitCodeOffset = 128
+
+// Result describes how a remote command terminated.
+type Result struct {
+	// ExitCode is the exit code of the command, or 128+N if it was killed by signal N.
+	ExitCode   int
+	Signal     agentv1.Signal
+	CoreDumped bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64
+	// TimedOut reports whether the command was terminated because its timeout expired.
+	TimedOut bool
+	// Stdout and Stderr describe the output of the command, only set when using Execute.
+	Stdout OutputInfo
+	Stderr OutputInfo
+}
+
+// OutputInfo describes the output written by a command to stdout or stderr.
+type OutputInfo struct {
+	// Truncated reports whether the output exceeded the agent's maximum output size,
+	// and thus was only written partially.
+	Truncated bool
+	// TotalBytes is the number of bytes the command wrote.
+	TotalBytes uint64
+}
+
+func newOutputInfo(output *agentv1.ExecuteIO) OutputInfo {
+	if output == nil {
+		return OutputInfo{}
+	}
+	return OutputInfo{Truncated: output.Truncated, TotalBytes: output.TotalBytes}
+}
+
+func newResult(r *agentv1.ExecuteResult) *Result {
+	res := &Result{
+		ExitCode:   int(r.ExitCode),
+		Signal:     r.Signal,
+		CoreDumped: r.CoreDumped,
+		MaxRSS:     r.MaxRssBytes,
+		TimedOut:   r.TimedOut,
+	}
+	if res.Signaled() {
+		res.ExitCode = signalExitCodeOffset + int(r.Signal)
+	}
+	if r.StartedAt != nil {
+		res.StartedAt = r.StartedAt.AsTime()
+	}
+	if r.FinishedAt != nil {
+		res.FinishedAt = r.FinishedAt.AsTime()
+	}
+	if r.UserTime != nil {
+		res.UserTime = r.UserTime.AsDuration()
+	}
+	if r.SystemTime != nil {
+		res.SystemTime = r.SystemTime.AsDuration()
+	}
+	return res
+}
+
+// Signaled reports whether the command was killed by a signal.
+func (r *Result) Signaled() bool {
+	return r.Signal != agentv1.Signal_SIGNAL_UNSPECIFIED
+}
+
+// WallTime returns the time the command was running.
+func (r *Result) WallTime() time.Duration {
+	if r.StartedAt.IsZero() || r.FinishedAt.IsZero() {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// String returns a short human readable summary of the result.
+func (r *Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "exit code %d", r.ExitCode)
+	if r.Signaled() {
+		fmt.Fprintf(&b, " (killed by %s", signalName(r.Signal))
+		if r.CoreDumped {
+			b.WriteString(", core dumped")
+		}
+		b.WriteString(")")
+	}
+	if r.TimedOut {
+		b.WriteString(", timed out")
+	}
+	fmt.Fprintf(&b, ", real %s, user %s, sys %s, max rss %d KiB",
+		r.WallTime().Round(time.Millisecond), r.UserTime.Round(time.Millisecond),
+		r.SystemTime.Round(time.Millisecond), r.MaxRSS/1024)
+	return b.String()
+}
+
+// signalName returns the conventional name of the signal, e.g. SIGKILL.
+func signalName(sig agentv1.Signal) string {
+	if name, ok := agentv1.Signal_name[int32(sig)]; ok {
+		return "SIG" + strings.TrimPrefix(name, "SIGNAL_")
+	}
+	return fmt.Sprintf("signal %d", sig)
+}
+
+// setResult stores the result if requested and returns the exit code of the command.
+func (o *execOptions) setResult(r *agentv1.ExecuteResult) (exitCode int) {
+	result := newResult(r)
+	if o.result != nil {
+		*o.result = *result
+	}
+	return result.ExitCode
+}
+
+// WithResult stores the details of how the command terminated in result.
+func WithResult(result *Result) ExecOption {
+	return func(o *execOptions) {
+		o.result = result
+	}
+}
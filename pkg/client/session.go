@@ -0,0 +1,391 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+)
+
+const (
+	// sessionWindowSize is the number of output bytes the agent may send for a command before they were read.
+	sessionWindowSize = 256 * 1024
+	// sessionWindowThreshold is the number of read output bytes, which are granted to the agent at once.
+	sessionWindowThreshold = sessionWindowSize / 4
+)
+
+// ErrSessionClosed is returned when using a session or its commands after the session was closed.
+var ErrSessionClosed = errors.New("session closed")
+
+// Session executes many commands concurrently over a single stream to the agent. The commands are flow
+// controlled independently, so that a command whose output is not read does not hold up the others.
+type Session struct {
+	client *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	stream agentv1.AgentService_ExecuteSessionsClient
+	sendMu sync.Mutex
+
+	mu     sync.Mutex
+	cmds   map[uint32]*Cmd
+	lastID uint32
+	// err is set once the stream ended.
+	err error
+	// received is closed once the stream ended.
+	received chan struct{}
+}
+
+// NewSession opens a session to execute commands, which must be closed once done.
+// Cancelling ctx closes the session.
+func (c *Client) NewSession(ctx context.Context) (*Session, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_SESSIONS); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.agent.ExecuteSessions(ctx, c.callOpts...)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error opening session: %w", err)
+	}
+	s := &Session{
+		client:   c,
+		ctx:      ctx,
+		cancel:   cancel,
+		stream:   stream,
+		cmds:     make(map[uint32]*Cmd),
+		received: make(chan struct{}),
+	}
+	go s.receive()
+	return s, nil
+}
+
+// Start starts the command within the session. The options are applied like by ExecuteInteractively,
+// except for stdin, resize and signal forwarding options, as the command is controlled using the returned Cmd.
+func (s *Session) Start(command []string, opts ...ExecOption) (*Cmd, error) {
+	options := newExecOptions(opts)
+	if err := s.client.requireFeatures(s.ctx, options.requiredFeatures(true)...); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	s.lastID++
+	cmd := newCmd(s, s.lastID)
+	s.cmds[cmd.id] = cmd
+	s.mu.Unlock()
+	req := &agentv1.SessionRequest{
+		SessionId:    cmd.id,
+		Prepare:      options.newPrepare(command),
+		WindowUpdate: sessionWindowSize,
+	}
+	if err := s.send(req); err != nil {
+		return nil, err
+	}
+	<-cmd.started
+	if cmd.PID == 0 {
+		return nil, cmd.err
+	}
+	return cmd, nil
+}
+
+// Close closes the session. The agent kills the commands still running.
+func (s *Session) Close() error {
+	s.cancel()
+	<-s.received
+	return nil
+}
+
+func (s *Session) send(req *agentv1.SessionRequest) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err := s.stream.Send(req); err != nil {
+		// The cause of the failure is reported by receiving.
+		<-s.received
+		return s.err
+	}
+	return nil
+}
+
+// receive dispatches the received frames to the commands until the stream ended.
+func (s *Session) receive() {
+	defer close(s.received)
+	for {
+		resp, err := s.stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+				err = ErrSessionClosed
+			} else {
+				err = fmt.Errorf("error receiving session frame: %w", err)
+			}
+			s.mu.Lock()
+			s.err = err
+			cmds := s.cmds
+			s.cmds = nil
+			s.mu.Unlock()
+			for _, cmd := range cmds {
+				cmd.finish(nil, err)
+			}
+			return
+		}
+		s.mu.Lock()
+		cmd := s.cmds[resp.SessionId]
+		s.mu.Unlock()
+		if cmd != nil {
+			cmd.handle(resp)
+		}
+	}
+}
+
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cmds, id)
+}
+
+// Cmd is a command started within a session.
+type Cmd struct {
+	session *Session
+	id      uint32
+	// PID is the process ID of the command on the agent.
+	PID    int
+	stdin  *cmdInput
+	stdout *cmdOutput
+	stderr *cmdOutput
+
+	// windowMu guards read, the number of output bytes read, but not yet granted to the agent.
+	windowMu sync.Mutex
+	read     int
+
+	finishOnce sync.Once
+	started    chan struct{}
+	done       chan struct{}
+	result     *Result
+	err        error
+}
+
+func newCmd(s *Session, id uint32) *Cmd {
+	cmd := &Cmd{session: s, id: id, started: make(chan struct{}), done: make(chan struct{})}
+	cmd.stdin = &cmdInput{cmd: cmd, window: newSessionWindow()}
+	cmd.stdout = newCmdOutput(cmd)
+	cmd.stderr = newCmdOutput(cmd)
+	return cmd
+}
+
+// Stdin returns the writer forwarding to the command's stdin. Closing it closes the command's stdin.
+func (c *Cmd) Stdin() io.WriteCloser {
+	return c.stdin
+}
+
+// Stdout returns the reader of the command's stdout. As stdout and stderr share the flow control
+// window of the command, both must be read for the command to make progress once the window is full.
+func (c *Cmd) Stdout() io.Reader {
+	return c.stdout
+}
+
+// Stderr returns the reader of the command's stderr, see Stdout.
+func (c *Cmd) Stderr() io.Reader {
+	return c.stderr
+}
+
+// Signal sends the signal to the command's process group.
+func (c *Cmd) Signal(sig agentv1.Signal) error {
+	return c.session.send(&agentv1.SessionRequest{SessionId: c.id, Signal: sig})
+}
+
+// Resize changes the window size of the command's pseudo-terminal.
+func (c *Cmd) Resize(size WindowSize) error {
+	resize := &agentv1.WindowSize{Rows: size.Rows, Cols: size.Cols}
+	return c.session.send(&agentv1.SessionRequest{SessionId: c.id, Resize: resize})
+}
+
+// Wait waits for the command to exit and returns how it terminated.
+func (c *Cmd) Wait() (*Result, error) {
+	<-c.done
+	return c.result, c.err
+}
+
+func (c *Cmd) handle(resp *agentv1.SessionResponse) {
+	if resp.Started != nil {
+		c.PID = int(resp.Started.Pid)
+		close(c.started)
+	}
+	if resp.WindowUpdate != 0 {
+		c.stdin.window.grant(int(resp.WindowUpdate))
+	}
+	if resp.Stdout != nil {
+		c.stdout.write(resp.Stdout)
+	}
+	if resp.Stderr != nil {
+		c.stderr.write(resp.Stderr)
+	}
+	if resp.Result != nil {
+		c.finish(newResult(resp.Result), nil)
+	} else if resp.Error != nil {
+		c.finish(nil, status.Error(codes.Code(resp.Error.Code), resp.Error.Message))
+	}
+}
+
+// finish ends the command with either its result or the error that ended its session.
+func (c *Cmd) finish(result *Result, err error) {
+	c.finishOnce.Do(func() {
+		c.result, c.err = result, err
+		c.session.remove(c.id)
+		if c.PID == 0 {
+			close(c.started)
+		}
+		outputErr := err
+		if outputErr == nil {
+			outputErr = io.EOF
+		}
+		c.stdout.end(outputErr)
+		c.stderr.end(outputErr)
+		c.stdin.window.close()
+		close(c.done)
+	})
+}
+
+// consumed grants the agent the read output bytes once they exceed the threshold.
+func (c *Cmd) consumed(n int) {
+	c.windowMu.Lock()
+	c.read += n
+	if c.read < sessionWindowThreshold {
+		c.windowMu.Unlock()
+		return
+	}
+	update := uint32(c.read)
+	c.read = 0
+	c.windowMu.Unlock()
+	// Failing to send means the session ended, which is reported when reading.
+	_ = c.session.send(&agentv1.SessionRequest{SessionId: c.id, WindowUpdate: update})
+}
+
+// cmdInput is the stdin of a command, which sends as much input as the agent granted.
+type cmdInput struct {
+	cmd    *Cmd
+	window *sessionWindow
+}
+
+func (in *cmdInput) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := in.window.acquire(len(p) - written)
+		if n == 0 {
+			return written, ErrSessionClosed
+		}
+		data := p[written : written+n]
+		req := &agentv1.SessionRequest{SessionId: in.cmd.id, Stdin: &agentv1.ExecuteIO{Data: data}}
+		if err := in.cmd.session.send(req); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (in *cmdInput) Close() error {
+	return in.cmd.session.send(&agentv1.SessionRequest{SessionId: in.cmd.id, Stdin: &agentv1.ExecuteIO{Close: true}})
+}
+
+// cmdOutput buffers the stdout or stderr received for a command until it is read.
+type cmdOutput struct {
+	cmd  *Cmd
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	// err is returned once the buffer was read, either io.EOF or the error that ended the session.
+	err error
+}
+
+func newCmdOutput(cmd *Cmd) *cmdOutput {
+	o := &cmdOutput{cmd: cmd}
+	o.cond = sync.NewCond(&o.mu)
+	return o
+}
+
+func (o *cmdOutput) write(output *agentv1.ExecuteIO) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, output.Data...)
+	if output.Close && o.err == nil {
+		o.err = io.EOF
+	}
+	o.cond.Broadcast()
+}
+
+func (o *cmdOutput) end(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err == nil {
+		o.err = err
+	}
+	o.cond.Broadcast()
+}
+
+func (o *cmdOutput) Read(p []byte) (int, error) {
+	o.mu.Lock()
+	for len(o.buf) == 0 && o.err == nil {
+		o.cond.Wait()
+	}
+	if len(o.buf) == 0 {
+		err := o.err
+		o.mu.Unlock()
+		return 0, err
+	}
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	o.mu.Unlock()
+	o.cmd.consumed(n)
+	return n, nil
+}
+
+// sessionWindow tracks the number of bytes that may still be sent, which the agent grants.
+type sessionWindow struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	size   int
+	closed bool
+}
+
+func newSessionWindow() *sessionWindow {
+	w := &sessionWindow{}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+func (w *sessionWindow) grant(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.size += n
+	w.cond.Broadcast()
+}
+
+// acquire blocks until the window is open and takes up to max bytes from it.
+// It returns zero once the window was closed.
+func (w *sessionWindow) acquire(max int) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.size == 0 && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return 0
+	}
+	if max > w.size {
+		max = w.size
+	}
+	w.size -= max
+	return max
+}
+
+func (w *sessionWindow) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.cond.Broadcast()
+}
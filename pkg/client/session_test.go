@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"testing"
+)
+
+type fakeSessionAgent struct {
+	fakeAgent
+	stream *fakeSessionStream
+}
+
+func (f *fakeSessionAgent) ExecuteSessions(
+	_ context.Context, _ ...grpc.CallOption,
+) (agentv1.AgentService_ExecuteSessionsClient, error) {
+	return f.stream, nil
+}
+
+// fakeSessionStream passes the requests to and the responses from the test, which acts as the agent.
+// Closing responses ends the stream with io.EOF.
+type fakeSessionStream struct {
+	agentv1.AgentService_ExecuteSessionsClient
+	requests  chan *agentv1.SessionRequest
+	responses chan *agentv1.SessionResponse
+}
+
+func newFakeSessionStream() *fakeSessionStream {
+	return &fakeSessionStream{
+		requests:  make(chan *agentv1.SessionRequest, 16),
+		responses: make(chan *agentv1.SessionResponse, 16),
+	}
+}
+
+func (s *fakeSessionStream) Send(req *agentv1.SessionRequest) error {
+	s.requests <- req
+	return nil
+}
+
+func (s *fakeSessionStream) Recv() (*agentv1.SessionResponse, error) {
+	resp, ok := <-s.responses
+	if !ok {
+		return nil, io.EOF
+	}
+	return resp, nil
+}
+
+func newFakeSession(t *testing.T) (*Session, *fakeSessionStream) {
+	stream := newFakeSessionStream()
+	agent := &fakeSessionAgent{fakeAgent: fakeAgent{infoErr: status.Error(codes.Unimplemented, "legacy")}, stream: stream}
+	c, err := NewClient(agent)
+	require.NoError(t, err)
+	s, err := c.NewSession(context.Background())
+	require.NoError(t, err)
+	return s, stream
+}
+
+func TestSessionMultiplexesCommands(t *testing.T) {
+	s, stream := newFakeSession(t)
+
+	go func() {
+		stream.responses <- &agentv1.SessionResponse{SessionId: 1, Started: &agentv1.SessionStarted{Pid: 10}, WindowUpdate: 2}
+	}()
+	first, err := s.Start([]string{"cat"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, first.PID)
+	req := <-stream.requests
+	assert.Equal(t, uint32(1), req.SessionId)
+	assert.Equal(t, []string{"cat"}, req.Prepare.Command)
+	assert.Equal(t, uint32(sessionWindowSize), req.WindowUpdate)
+
+	go func() {
+		stream.responses <- &agentv1.SessionResponse{
+			SessionId: 2, Error: &agentv1.SessionError{Code: int32(codes.NotFound), Message: "missing"},
+		}
+	}()
+	_, err = s.Start([]string{"missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, uint32(2), (<-stream.requests).SessionId)
+
+	// Stdin is sent only as far as the agent granted.
+	written := make(chan error)
+	go func() {
+		_, err := first.Stdin().Write([]byte("abc"))
+		written <- err
+	}()
+	req = <-stream.requests
+	assert.Equal(t, []byte("ab"), req.Stdin.Data)
+	stream.responses <- &agentv1.SessionResponse{SessionId: 1, WindowUpdate: 1}
+	req = <-stream.requests
+	assert.Equal(t, []byte("c"), req.Stdin.Data)
+	require.NoError(t, <-written)
+
+	output := &agentv1.ExecuteIO{Data: []byte("abc"), Close: true}
+	stream.responses <- &agentv1.SessionResponse{SessionId: 1, Stdout: output}
+	stream.responses <- &agentv1.SessionResponse{SessionId: 1, Stderr: &agentv1.ExecuteIO{Close: true}}
+	stream.responses <- &agentv1.SessionResponse{SessionId: 1, Result: &agentv1.ExecuteResult{ExitCode: 3}}
+	stdout, err := io.ReadAll(first.Stdout())
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(stdout))
+	stderr, err := io.ReadAll(first.Stderr())
+	require.NoError(t, err)
+	assert.Empty(t, stderr)
+	result, err := first.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+
+	close(stream.responses)
+	require.NoError(t, s.Close())
+}
+
+func TestSessionGrantsReadOutput(t *testing.T) {
+	s, stream := newFakeSession(t)
+	go func() {
+		stream.responses <- &agentv1.SessionResponse{SessionId: 1, Started: &agentv1.SessionStarted{Pid: 10}}
+	}()
+	cmd, err := s.Start([]string{"yes"})
+	require.NoError(t, err)
+	<-stream.requests
+
+	chunk := make([]byte, sessionWindowThreshold/2)
+	for i := 0; i < 2; i++ {
+		stream.responses <- &agentv1.SessionResponse{SessionId: 1, Stdout: &agentv1.ExecuteIO{Data: chunk}}
+	}
+	_, err = io.ReadFull(cmd.Stdout(), make([]byte, sessionWindowThreshold-1))
+	require.NoError(t, err)
+	assert.Empty(t, stream.requests)
+	_, err = io.ReadFull(cmd.Stdout(), make([]byte, 1))
+	require.NoError(t, err)
+	req := <-stream.requests
+	assert.Equal(t, uint32(1), req.SessionId)
+	assert.Equal(t, uint32(sessionWindowThreshold), req.WindowUpdate)
+
+	// The commands fail once the session ends.
+	close(stream.responses)
+	_, err = cmd.Wait()
+	assert.ErrorIs(t, err, ErrSessionClosed)
+	_, err = io.ReadAll(cmd.Stdout())
+	assert.ErrorIs(t, err, ErrSessionClosed)
+	_, err = s.Start([]string{"true"})
+	assert.ErrorIs(t, err, ErrSessionClosed)
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"os"
+	"syscall"
+)
+
+var signals = map[os.Signal]agentv1.Signal{
+	syscall.SIGHUP:  agentv1.Signal_SIGNAL_HUP,
+	syscall.SIGINT:  agentv1.Signal_SIGNAL_INT,
+	syscall.SIGQUIT: agentv1.Signal_SIGNAL_QUIT,
+	syscall.SIGKILL: agentv1.Signal_SIGNAL_KILL,
+	syscall.SIGTERM: agentv1.Signal_SIGNAL_TERM,
+}
+
+// DefaultForwardedSignals are the signals usually forwarded to remote commands.
+var DefaultForwardedSignals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM}
+
+// WithSignalForwarding traps the given local signals while the command runs and
+// forwards them to the remote command's process group. Signals without a remote
+// equivalent are ignored.
+func WithSignalForwarding(sigs ...os.Signal) ExecOption {
+	return func(o *execOptions) {
+		for _, sig := range sigs {
+			if _, ok := signals[sig]; ok {
+				o.signals = append(o.signals, sig)
+			}
+		}
+	}
+}
+
+func streamSignals(
+	ctx context.Context, sigs <-chan os.Signal, errCh chan error,
+	stream agentv1.AgentService_ExecuteCommandStreamClient,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			req := &agentv1.ExecuteCommandStreamRequest{Signal: signals[sig]}
+			if err := stream.Send(req); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/sirkrypt0/pyro/pkg/archive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type syncOptions struct {
+	delete      bool
+	checksum    bool
+	dryRun      bool
+	excludes    []string
+	compression archive.Compression
+}
+
+// SyncOption configures Sync.
+type SyncOption func(*syncOptions)
+
+// WithDelete makes Sync delete entries on the agent that do not exist locally, unless they are excluded.
+func WithDelete() SyncOption {
+	return func(o *syncOptions) {
+		o.delete = true
+	}
+}
+
+// WithChecksum makes Sync compare the checksums of regular files having the same size instead of
+// their modification times, which requires reading all of them on both sides.
+func WithChecksum() SyncOption {
+	return func(o *syncOptions) {
+		o.checksum = true
+	}
+}
+
+// WithDryRun makes Sync only report what it would do.
+func WithDryRun() SyncOption {
+	return func(o *syncOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithExcludes adds patterns of paths to exclude in addition to the ones of the directory's IgnoreFile.
+func WithExcludes(patterns ...string) SyncOption {
+	return func(o *syncOptions) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+// WithSyncCompression sets the compression of the changed entries sent to the agent. Defaults to none.
+func WithSyncCompression(c archive.Compression) SyncOption {
+	return func(o *syncOptions) {
+		o.compression = c
+	}
+}
+
+// SyncResult summarizes a sync. Paths are relative to the synced directory and use slashes.
+type SyncResult struct {
+	// Uploaded are the entries sent to the agent as they were missing or changed.
+	Uploaded []string
+	// Deleted are the entries removed from the agent, as they did not exist locally or changed their type.
+	// Entries below deleted directories are not listed.
+	Deleted []string
+	// Unchanged is the number of entries that were up to date.
+	Unchanged int
+	// Bytes is the size of the uploaded regular files.
+	Bytes int64
+}
+
+// Manifest lists all entries below the directory at the absolute path on the agent, parents preceding
+// their children. If requested, the entries of regular files contain their checksums.
+func (c *Client) Manifest(ctx context.Context, dir string, checksums bool) ([]*agentv1.ManifestEntry, error) {
+	if err := c.requireFeatures(ctx, agentv1.Feature_FEATURE_MANIFEST); err != nil {
+		return nil, err
+	}
+	req := &agentv1.GetManifestRequest{Path: dir, Checksums: checksums}
+	stream, err := c.agent.GetManifest(ctx, req, c.callOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting manifest: %w", err)
+	}
+	var entries []*agentv1.ManifestEntry
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error getting manifest: %w", err)
+		}
+		entries = append(entries, resp.Entries...)
+	}
+}
+
+// Sync makes the directory at the absolute path on the agent match the local directory by only sending
+// entries that are missing or differ in type, mode, size, modification time or symlink target.
+// Paths matching the patterns in the local directory's IgnoreFile or given by WithExcludes are skipped.
+// Entries on the agent that exist locally with a different type are replaced. Extraneous ones are only
+// deleted if requested by WithDelete.
+func (c *Client) Sync(ctx context.Context, localDir, remoteDir string, opts ...SyncOption) (*SyncResult, error) {
+	o := &syncOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	required := []agentv1.Feature{
+		agentv1.Feature_FEATURE_MANIFEST, agentv1.Feature_FEATURE_DIR_TRANSFER, agentv1.Feature_FEATURE_FILESYSTEM,
+	}
+	if err := c.requireFeatures(ctx, required...); err != nil {
+		return nil, err
+	}
+	ignored, err := readIgnoreFile(localDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", IgnoreFile, err)
+	}
+	excl, err := parseExcludes(append(ignored, o.excludes...))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := c.Manifest(ctx, remoteDir, o.checksum)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	remote := make(map[string]*agentv1.ManifestEntry, len(manifest))
+	for _, entry := range manifest {
+		remote[entry.Path] = entry
+	}
+
+	plan, err := planSync(localDir, remote, excl, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.dryRun {
+		return plan, nil
+	}
+	for _, rel := range plan.Deleted {
+		if err := c.RemoveAll(ctx, path.Join(remoteDir, rel)); err != nil {
+			return nil, err
+		}
+	}
+	if len(plan.Uploaded) == 0 {
+		return plan, nil
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(archive.CreateEntries(pw, localDir, plan.Uploaded, o.compression))
+	}()
+	_, err = c.PushDir(ctx, remoteDir, pr, WithCompression(o.compression))
+	_ = pr.CloseWithError(err)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func isNotFound(err error) bool {
+	return statusCode(err) == codes.NotFound
+}
+
+// statusCode returns the code of the gRPC status wrapped by err, or codes.Unknown if there is none.
+func statusCode(err error) codes.Code {
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) {
+		return s.GRPCStatus().Code()
+	}
+	return codes.Unknown
+}
+
+// planSync compares the local directory with the manifest of the remote one and returns which entries
+// need to be uploaded and deleted.
+func planSync(
+	localDir string, remote map[string]*agentv1.ManifestEntry, excl excludes, o *syncOptions,
+) (*SyncResult, error) {
+	result := &SyncResult{}
+	seen := make(map[string]bool, len(remote))
+	var deleted []string
+	err := filepath.WalkDir(localDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if excl.excluded(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&fs.ModeSocket != 0 {
+			return nil
+		}
+		seen[rel] = true
+		entry, ok := remote[rel]
+		if ok && entry.Type != fileType(info.Mode()) {
+			deleted = append(deleted, rel)
+			ok = false
+		}
+		changed := !ok
+		if ok {
+			if changed, err = entryChanged(file, info, entry, o.checksum); err != nil {
+				return err
+			}
+		}
+		if !changed {
+			result.Unchanged++
+			return nil
+		}
+		result.Uploaded = append(result.Uploaded, rel)
+		if info.Mode().IsRegular() {
+			result.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", localDir, err)
+	}
+	if o.delete {
+		for rel, entry := range remote {
+			if !seen[rel] && !excl.excluded(rel, entry.Type == agentv1.FileType_FILE_TYPE_DIRECTORY) {
+				deleted = append(deleted, rel)
+			}
+		}
+	}
+	result.Deleted = topmost(deleted)
+	return result, nil
+}
+
+// entryChanged reports whether the local file differs from the remote entry of the same type.
+func entryChanged(path string, info fs.FileInfo, entry *agentv1.ManifestEntry, checksum bool) (bool, error) {
+	if unixMode(info.Mode()) != entry.Mode {
+		return true, nil
+	}
+	switch {
+	case info.Mode().IsRegular():
+		if info.Size() != entry.Size {
+			return true, nil
+		}
+		if checksum && entry.Sha256 != nil {
+			sum, err := localChecksum(path)
+			if err != nil {
+				return false, err
+			}
+			return !bytes.Equal(sum, entry.Sha256), nil
+		}
+		// Archives store modification times in seconds.
+		return !info.ModTime().Round(time.Second).Equal(entry.Mtime.AsTime().Round(time.Second)), nil
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false, err
+		}
+		return target != entry.SymlinkTarget, nil
+	default:
+		return false, nil
+	}
+}
+
+func localChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// topmost sorts the paths and drops the ones below another one.
+func topmost(paths []string) []string {
+	sort.Strings(paths)
+	kept := make(map[string]bool, len(paths))
+	var result []string
+	for _, p := range paths {
+		if !hasParent(p, kept) {
+			kept[p] = true
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// hasParent reports whether any parent of the slash separated path is in the set.
+func hasParent(p string, set map[string]bool) bool {
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		if set[strings.Join(parts[:i], "/")] {
+			return true
+		}
+	}
+	return false
+}
+
+// fileType returns the type of a file as reported by the agent.
+func fileType(mode os.FileMode) agentv1.FileType {
+	for t, bits := range fileTypes {
+		if mode.Type() == bits {
+			return t
+		}
+	}
+	if mode.IsRegular() {
+		return agentv1.FileType_FILE_TYPE_REGULAR
+	}
+	return agentv1.FileType_FILE_TYPE_UNSPECIFIED
+}
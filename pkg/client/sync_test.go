@@ -0,0 +1,101 @@
+package client
+
+import (
+	agentv1 "github.com/sirkrypt0/pyro/api/agent/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExcludes(t *testing.T) {
+	excl, err := parseExcludes([]string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"/vendor",
+		"docs/*.tmp",
+	})
+	require.NoError(t, err)
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{path: "app.log", excluded: true},
+		{path: "sub/app.log", excluded: true},
+		{path: "keep.log", excluded: false},
+		{path: "build", isDir: true, excluded: true},
+		{path: "build", excluded: false},
+		{path: "sub/build/out", excluded: true},
+		{path: "vendor", isDir: true, excluded: true},
+		{path: "sub/vendor", isDir: true, excluded: false},
+		{path: "docs/a.tmp", excluded: true},
+		{path: "docs/sub/a.tmp", excluded: false},
+		{path: "main.go", excluded: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.excluded, excl.excluded(tt.path, tt.isDir), tt.path)
+	}
+
+	_, err = parseExcludes([]string{"[a-"})
+	assert.Error(t, err)
+}
+
+func TestPlanSync(t *testing.T) {
+	local := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeFile := func(name, content string) {
+		path := filepath.Join(local, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	writeFile("unchanged", "same")
+	writeFile("modified", "new content")
+	writeFile("touched", "same")
+	writeFile("new/file", "new")
+	writeFile("replaced", "was a directory")
+	writeFile("app.log", "excluded")
+	require.NoError(t, os.Chtimes(filepath.Join(local, "touched"), mtime.Add(time.Hour), mtime.Add(time.Hour)))
+
+	file := func(path, content string) *agentv1.ManifestEntry {
+		return &agentv1.ManifestEntry{
+			Path: path, Type: agentv1.FileType_FILE_TYPE_REGULAR, Mode: 0o644,
+			Size: int64(len(content)), Mtime: timestamppb.New(mtime),
+		}
+	}
+	dir := func(path string) *agentv1.ManifestEntry {
+		return &agentv1.ManifestEntry{Path: path, Type: agentv1.FileType_FILE_TYPE_DIRECTORY, Mode: 0o755}
+	}
+	remote := map[string]*agentv1.ManifestEntry{}
+	for _, entry := range []*agentv1.ManifestEntry{
+		file("unchanged", "same"),
+		file("modified", "old"),
+		file("touched", "same"),
+		dir("replaced"),
+		file("replaced/child", ""),
+		dir("extraneous"),
+		file("extraneous/file", ""),
+		file("other.log", "excluded remote files are kept"),
+	} {
+		remote[entry.Path] = entry
+	}
+	excl, err := parseExcludes([]string{"*.log"})
+	require.NoError(t, err)
+
+	result, err := planSync(local, remote, excl, &syncOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"modified", "touched", "new", "new/file", "replaced"}, result.Uploaded)
+	assert.Equal(t, []string{"replaced"}, result.Deleted)
+	assert.Equal(t, 1, result.Unchanged)
+
+	result, err = planSync(local, remote, excl, &syncOptions{delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extraneous", "replaced"}, result.Deleted)
+}
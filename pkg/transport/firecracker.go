@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxHandshakeResponseSize limits the response read during the hybrid vsock handshake.
+const maxHandshakeResponseSize = 64
+
+// errHandshakeResponseTooLong is returned if the handshake response is not terminated in time.
+var errHandshakeResponseTooLong = errors.New("handshake response too long")
+
+// DialFirecrackerVsock connects to the given port of a Firecracker guest through the unix socket
+// at path, which Firecracker exposes on the host for the guest's vsock device.
+// After connecting, it performs the handshake, i.e. it sends "CONNECT <port>\n" and expects
+// "OK <host port>\n" as answer. Afterwards, the connection is forwarded to the guest.
+func DialFirecrackerVsock(ctx context.Context, path string, port uint32) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := firecrackerHandshake(ctx, conn, port); err != nil {
+		_ = conn.Close()
+		err = fmt.Errorf("error connecting to port %d through %s: %w", port, path, err)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &handshakeError{err: err}
+	}
+	return conn, nil
+}
+
+// handshakeError is returned if the handshake failed, e.g. because nothing listens on the port in the guest.
+// Unlike failing to connect to the unix socket, retrying is unlikely to help, so it is not temporary.
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *handshakeError) Unwrap() error {
+	return e.err
+}
+
+// Temporary allows gRPC to fail instead of retrying, if configured to do so.
+func (e *handshakeError) Temporary() bool {
+	return false
+}
+
+// firecrackerHandshake performs the hybrid vsock handshake on conn, aborting once ctx is done.
+func firecrackerHandshake(ctx context.Context, conn net.Conn, port uint32) (err error) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// Unblock any pending read or write.
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if resetErr := conn.SetDeadline(time.Time{}); err == nil {
+			err = resetErr
+		}
+	}()
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %d\n", port); err != nil {
+		return fmt.Errorf("error sending handshake: %w", err)
+	}
+	response, err := readLine(conn, maxHandshakeResponseSize)
+	if err != nil {
+		return fmt.Errorf("error receiving handshake response: %w", err)
+	}
+	if !strings.HasPrefix(response, "OK ") {
+		return fmt.Errorf("unexpected handshake response %q", response)
+	}
+	return nil
+}
+
+// readLine reads a single line from conn without reading beyond it and returns it without the newline.
+// Reading byte by byte ensures that no data sent after the line is consumed.
+func readLine(conn net.Conn, maxSize int) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < maxSize {
+		n, err := conn.Read(b)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			continue
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errHandshakeResponseTooLong
+}
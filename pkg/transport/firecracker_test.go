@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFirecrackerVsock imitates the unix socket Firecracker exposes for a guest's vsock device.
+// It answers the handshake with the response returned by respond for the requested port,
+// closing the connection if it is empty. Afterwards, it echoes everything it receives.
+type fakeFirecrackerVsock struct {
+	net.Listener
+	respond func(port uint32) string
+}
+
+func newFakeFirecrackerVsock(t *testing.T, respond func(port uint32) string) (path string) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "v.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	f := &fakeFirecrackerVsock{Listener: l, respond: respond}
+	go f.serve()
+	return path
+}
+
+func (f *fakeFirecrackerVsock) serve() {
+	for {
+		conn, err := f.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeFirecrackerVsock) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	var port uint32
+	if _, err := fmt.Sscanf(line, "CONNECT %d\n", &port); err != nil {
+		return
+	}
+	response := f.respond(port)
+	if response == "" {
+		return
+	}
+	if _, err := io.WriteString(conn, response); err != nil {
+		return
+	}
+	_, _ = io.Copy(conn, r)
+}
+
+func acceptPort(port uint32) func(uint32) string {
+	return func(p uint32) string {
+		if p != port {
+			return ""
+		}
+		return "OK 1073741824\n"
+	}
+}
+
+func TestParseFirecrackerVsockAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		path    string
+		port    uint32
+		wantErr bool
+	}{
+		{address: "fc-vsock:///tmp/v.sock:1024", path: "/tmp/v.sock", port: 1024},
+		{address: "fc-vsock://v.sock:52", path: "v.sock", port: 52},
+		{address: "fc-vsock:///tmp/v.sock", wantErr: true},
+		{address: "fc-vsock://:1024", wantErr: true},
+		{address: "fc-vsock:///tmp/v.sock:port", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			path, port, err := parseFirecrackerVsockAddress(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.path, path)
+			assert.Equal(t, tt.port, port)
+		})
+	}
+}
+
+func TestDialFirecrackerVsock(t *testing.T) {
+	path := newFakeFirecrackerVsock(t, acceptPort(1024))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := Dial(ctx, "fc-vsock://"+path+":1024")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Everything after the handshake belongs to the forwarded connection.
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestDialFirecrackerVsockHandshakeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(uint32) string
+		errMsg  string
+	}{
+		{name: "rejected", respond: acceptPort(1), errMsg: "EOF"},
+		{
+			name:    "unexpected",
+			respond: func(uint32) string { return "NOPE\n" },
+			errMsg:  `unexpected handshake response "NOPE"`,
+		},
+		{
+			name:    "too long",
+			respond: func(uint32) string { return strings.Repeat("OK", maxHandshakeResponseSize) },
+			errMsg:  errHandshakeResponseTooLong.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := newFakeFirecrackerVsock(t, tt.respond)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := DialFirecrackerVsock(ctx, path, 1024)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+			var temporary interface{ Temporary() bool }
+			require.ErrorAs(t, err, &temporary)
+			assert.False(t, temporary.Temporary())
+		})
+	}
+}
+
+func TestDialFirecrackerVsockCanceled(t *testing.T) {
+	// The listener never answers, so the handshake blocks until the context is done.
+	path := filepath.Join(t.TempDir(), "v.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = DialFirecrackerVsock(ctx, path, 1024)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,152 @@
+// Package transport provides the connections between the pyro cli and the pyro agent.
+// Addresses are either plain host:port pairs for TCP, vsock://CID:PORT for AF_VSOCK, unix:///path for
+// unix domain sockets or fc-vsock:///path:PORT for Firecracker's hybrid vsock exposed on the host.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	vsockScheme            = "vsock://"
+	unixScheme             = "unix://"
+	firecrackerVsockScheme = "fc-vsock://"
+)
+
+// Listen listens on the given address.
+// A stale unix socket left behind by a previous listener is removed, see listenUnix.
+// Firecracker's hybrid vsock addresses are only supported for dialing.
+func Listen(address string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(address, vsockScheme):
+		cid, port, err := parseVsockAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return ListenVsock(cid, port)
+	case strings.HasPrefix(address, unixScheme):
+		path, err := parseUnixAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return listenUnix(path)
+	case strings.HasPrefix(address, firecrackerVsockScheme):
+		return nil, fmt.Errorf("cannot listen on %q: hybrid vsock addresses are only supported for dialing", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// listenUnix listens on the unix socket at path.
+// If a socket nobody listens on anymore exists at path, e.g. because the previous agent crashed, it is removed first.
+// Sockets still in use and any other files are left untouched, so listening fails for them.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+		} else if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error removing stale socket %s: %w", path, err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// Dial connects to the given address. Its signature allows it to be used as gRPC context dialer.
+func Dial(ctx context.Context, address string) (net.Conn, error) {
+	var d net.Dialer
+	switch {
+	case strings.HasPrefix(address, vsockScheme):
+		cid, port, err := parseVsockAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return DialVsock(ctx, cid, port)
+	case strings.HasPrefix(address, unixScheme):
+		path, err := parseUnixAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return d.DialContext(ctx, "unix", path)
+	case strings.HasPrefix(address, firecrackerVsockScheme):
+		path, port, err := parseFirecrackerVsockAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		return DialFirecrackerVsock(ctx, path, port)
+	}
+	return d.DialContext(ctx, "tcp", address)
+}
+
+// IsTCP returns whether the given address is a TCP address, i.e. does not use any of the other schemes.
+func IsTCP(address string) bool {
+	for _, scheme := range []string{vsockScheme, unixScheme, firecrackerVsockScheme} {
+		if strings.HasPrefix(address, scheme) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUnixAddress parses an address of the form unix:///path and returns the path.
+func parseUnixAddress(address string) (string, error) {
+	path := strings.TrimPrefix(address, unixScheme)
+	if path == "" {
+		return "", fmt.Errorf("invalid unix address %q: missing path", address)
+	}
+	return path, nil
+}
+
+// parseFirecrackerVsockAddress parses an address of the form fc-vsock:///path:PORT.
+func parseFirecrackerVsockAddress(address string) (path string, port uint32, err error) {
+	pathPort := strings.TrimPrefix(address, firecrackerVsockScheme)
+	i := strings.LastIndexByte(pathPort, ':')
+	if i < 0 {
+		return "", 0, fmt.Errorf("invalid hybrid vsock address %q: missing port", address)
+	}
+	if i == 0 {
+		return "", 0, fmt.Errorf("invalid hybrid vsock address %q: missing path", address)
+	}
+	p, err := strconv.ParseUint(pathPort[i+1:], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid hybrid vsock address %q: invalid port: %w", address, err)
+	}
+	return pathPort[:i], uint32(p), nil
+}
+
+// parseVsockAddress parses an address of the form vsock://CID:PORT.
+func parseVsockAddress(address string) (cid, port uint32, err error) {
+	hostPort := strings.TrimPrefix(address, vsockScheme)
+	i := strings.LastIndexByte(hostPort, ':')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid vsock address %q: missing port", address)
+	}
+	c, err := strconv.ParseUint(hostPort[:i], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vsock address %q: invalid cid: %w", address, err)
+	}
+	p, err := strconv.ParseUint(hostPort[i+1:], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vsock address %q: invalid port: %w", address, err)
+	}
+	return uint32(c), uint32(p), nil
+}
+
+// VsockAddr is the address of an AF_VSOCK socket.
+type VsockAddr struct {
+	CID  uint32
+	Port uint32
+}
+
+var _ net.Addr = (*VsockAddr)(nil)
+
+func (a *VsockAddr) Network() string {
+	return "vsock"
+}
+
+func (a *VsockAddr) String() string {
+	return fmt.Sprintf("%s%d:%d", vsockScheme, a.CID, a.Port)
+}
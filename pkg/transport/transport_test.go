@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseVsockAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		cid     uint32
+		port    uint32
+		wantErr bool
+	}{
+		{address: "vsock://3:1024", cid: 3, port: 1024},
+		{address: "vsock://4294967295:1", cid: CIDAny, port: 1},
+		{address: "vsock://3", wantErr: true},
+		{address: "vsock://host:1024", wantErr: true},
+		{address: "vsock://3:port", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			cid, port, err := parseVsockAddress(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.cid, cid)
+			assert.Equal(t, tt.port, port)
+		})
+	}
+}
+
+func TestListenAndDialTCP(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	testRoundTrip(t, l, l.Addr().String())
+}
+
+func TestListenAndDialUnix(t *testing.T) {
+	address := "unix://" + filepath.Join(t.TempDir(), "agent.sock")
+	l, err := Listen(address)
+	require.NoError(t, err)
+	defer l.Close()
+	testRoundTrip(t, l, address)
+}
+
+func TestListenUnixRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	// Keep the socket file around, like a crashed agent would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	l, err := Listen("unix://" + path)
+	require.NoError(t, err)
+	defer l.Close()
+	testRoundTrip(t, l, "unix://"+path)
+}
+
+func TestListenUnixKeepsSocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := Listen("unix://" + path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	_, err = Listen("unix://" + path)
+	assert.Error(t, err)
+	_, err = os.Lstat(path)
+	assert.NoError(t, err)
+}
+
+func TestListenUnixKeepsRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+	_, err := Listen("unix://" + path)
+	assert.Error(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(content))
+}
+
+func TestListenFirecrackerVsock(t *testing.T) {
+	_, err := Listen("fc-vsock:///tmp/v.sock:1024")
+	assert.Error(t, err)
+}
+
+func TestIsTCP(t *testing.T) {
+	assert.True(t, IsTCP("127.0.0.1:3000"))
+	assert.False(t, IsTCP("vsock://3:3000"))
+	assert.False(t, IsTCP("unix:///run/pyro.sock"))
+	assert.False(t, IsTCP("fc-vsock:///run/v.sock:3000"))
+}
+
+func TestListenAndDialVsock(t *testing.T) {
+	l, err := ListenVsock(CIDAny, PortAny)
+	if err != nil {
+		t.Skipf("vsock is not available: %v", err)
+	}
+	defer l.Close()
+	addr, ok := l.Addr().(*VsockAddr)
+	require.True(t, ok)
+	assert.Equal(t, "vsock", addr.Network())
+	assert.NotZero(t, addr.Port)
+
+	// Connecting requires the vsock loopback transport.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	loopback := (&VsockAddr{CID: 1, Port: addr.Port}).String()
+	conn, err := Dial(ctx, loopback)
+	if err != nil {
+		t.Skipf("vsock loopback is not available: %v", err)
+	}
+	require.NoError(t, conn.Close())
+	testRoundTrip(t, l, loopback)
+}
+
+func testRoundTrip(t *testing.T, l net.Listener, address string) {
+	t.Helper()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err := Dial(ctx, address)
+	require.NoError(t, err)
+	defer client.Close()
+	server := <-accepted
+	require.NotNil(t, server)
+	defer server.Close()
+
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(server, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+	assert.Equal(t, client.LocalAddr().String(), server.RemoteAddr().String())
+}
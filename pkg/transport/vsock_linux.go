@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// CIDAny binds a listener to any CID of the local machine.
+	CIDAny = unix.VMADDR_CID_ANY
+	// PortAny binds a listener to any free port.
+	PortAny = unix.VMADDR_PORT_ANY
+)
+
+// ListenVsock listens on the given AF_VSOCK CID and port.
+func ListenVsock(cid, port uint32) (net.Listener, error) {
+	fd, err := vsockSocket()
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("error binding vsock socket: %w", err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("error listening on vsock socket: %w", err)
+	}
+	addr, err := localVsockAddr(fd)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	// The file registers the non-blocking socket with the runtime's network poller.
+	return &vsockListener{f: os.NewFile(uintptr(fd), "vsock-listener"), addr: addr}, nil
+}
+
+// DialVsock connects to the given AF_VSOCK CID and port.
+func DialVsock(ctx context.Context, cid, port uint32) (net.Conn, error) {
+	fd, err := vsockSocket()
+	if err != nil {
+		return nil, err
+	}
+	remote := &VsockAddr{CID: cid, Port: port}
+	err = unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port})
+	if err != nil && !errors.Is(err, unix.EINPROGRESS) {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("error connecting to %s: %w", remote, err)
+	}
+	f := os.NewFile(uintptr(fd), "vsock")
+	if err != nil {
+		if err := waitConnected(ctx, f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("error connecting to %s: %w", remote, err)
+		}
+	}
+	local, err := localVsockAddr(fd)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &vsockConn{File: f, local: local, remote: remote}, nil
+}
+
+func vsockSocket() (int, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error creating vsock socket: %w", err)
+	}
+	return fd, nil
+}
+
+func localVsockAddr(fd int) (*VsockAddr, error) {
+	sa, err := unix.Getsockname(fd)
+	if err != nil {
+		return nil, fmt.Errorf("error getting vsock socket name: %w", err)
+	}
+	vm, ok := sa.(*unix.SockaddrVM)
+	if !ok {
+		return nil, fmt.Errorf("unexpected vsock socket name %T", sa)
+	}
+	return &VsockAddr{CID: vm.CID, Port: vm.Port}, nil
+}
+
+// waitConnected waits until the non-blocking connect of the socket completed or ctx is done.
+func waitConnected(ctx context.Context, f *os.File) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblocks the wait below.
+			_ = f.SetWriteDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	var connectErr error
+	waited := false
+	err = rc.Write(func(fd uintptr) bool {
+		// The socket becomes writable once the connect completed, either successfully or not.
+		if !waited {
+			waited = true
+			return false
+		}
+		var errno int
+		errno, connectErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ERROR)
+		if connectErr == nil && errno != 0 {
+			connectErr = unix.Errno(errno)
+		}
+		return !errors.Is(connectErr, unix.EINPROGRESS) && !errors.Is(connectErr, unix.EALREADY)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if connectErr != nil {
+		return connectErr
+	}
+	return f.SetWriteDeadline(time.Time{})
+}
+
+type vsockListener struct {
+	f    *os.File
+	addr *VsockAddr
+}
+
+var _ net.Listener = (*vsockListener)(nil)
+
+func (l *vsockListener) Accept() (net.Conn, error) {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var nfd int
+	var sa unix.Sockaddr
+	var acceptErr error
+	err = rc.Read(func(fd uintptr) bool {
+		nfd, sa, acceptErr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		return !errors.Is(acceptErr, unix.EAGAIN)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, fmt.Errorf("error accepting vsock connection: %w", acceptErr)
+	}
+	remote := &VsockAddr{}
+	if vm, ok := sa.(*unix.SockaddrVM); ok {
+		remote = &VsockAddr{CID: vm.CID, Port: vm.Port}
+	}
+	return &vsockConn{File: os.NewFile(uintptr(nfd), "vsock"), local: l.addr, remote: remote}, nil
+}
+
+func (l *vsockListener) Close() error {
+	return l.f.Close()
+}
+
+func (l *vsockListener) Addr() net.Addr {
+	return l.addr
+}
+
+// vsockConn is a connected AF_VSOCK socket. The file provides reading, writing and deadlines.
+type vsockConn struct {
+	*os.File
+	local  *VsockAddr
+	remote *VsockAddr
+}
+
+var _ net.Conn = (*vsockConn)(nil)
+
+func (c *vsockConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *vsockConn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+const (
+	// CIDAny binds a listener to any CID of the local machine.
+	CIDAny = 0xffffffff
+	// PortAny binds a listener to any free port.
+	PortAny = 0xffffffff
+)
+
+var errVsockUnsupported = errors.New("vsock is only supported on linux")
+
+// ListenVsock listens on the given AF_VSOCK CID and port.
+func ListenVsock(_, _ uint32) (net.Listener, error) {
+	return nil, errVsockUnsupported
+}
+
+// DialVsock connects to the given AF_VSOCK CID and port.
+func DialVsock(_ context.Context, _, _ uint32) (net.Conn, error) {
+	return nil, errVsockUnsupported
+}